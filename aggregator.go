@@ -0,0 +1,203 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Aggregator 使用 map 按照 word 聚合 wordCount，不需要预先排序，调用 Reset 后可以重复使用。
+// pipeline 的 map 聚合、-repl 以及 -serve 和 -grpc 的请求都使用它，也可以直接通过 Add 和 Result 计数。
+type Aggregator struct {
+	counts map[string]wordCount
+	reduce func(acc, next wordCount) wordCount
+
+	// limit 不为 0 时最多保留 limit 个不同的 word，entries 和 evictions 用于找出下一个被淘汰的 word
+	limit     int
+	entries   map[string]*evictionEntry
+	evictions evictionHeap
+	tick      int64
+	evicted   int
+}
+
+// WordCount 是 Aggregator.Result 返回的一个 word 及其计数
+type WordCount struct {
+	Word  string
+	Count int
+}
+
+// NewAggregator 创建与命令行使用相同方式合并计数的 Aggregator
+func NewAggregator() *Aggregator {
+	return newAggregator(reduceFn)
+}
+
+// newAggregator 创建使用 fn 合并相同 word 的 aggregator
+func newAggregator(fn func(acc, next wordCount) wordCount) *Aggregator {
+	return &Aggregator{counts: make(map[string]wordCount), reduce: fn}
+}
+
+// newCappedAggregator 创建最多保留 limit 个不同 word 的 aggregator（limit 为 0 时不限制）。
+// 已满时加入新的 word 会先淘汰计数最小的 word，计数相同时淘汰最久没有出现的 word；
+// 被淘汰的 word 再次出现时从头开始计数，因此结果是偏向高频 word 的近似值。
+func newCappedAggregator(fn func(acc, next wordCount) wordCount, limit int) *Aggregator {
+	a := newAggregator(fn)
+	if limit > 0 {
+		a.limit = limit
+		a.entries = make(map[string]*evictionEntry, limit)
+	}
+	return a
+}
+
+// Add 将 token 的计数加 1，token 原样作为 word，不经过 mapFn 的分词和规范化
+func (a *Aggregator) Add(token string) {
+	a.add(wordCount{word: token, count: 1})
+}
+
+func (a *Aggregator) add(wc wordCount) {
+	if acc, ok := a.counts[wc.word]; ok {
+		wc = a.reduce(acc, wc)
+	} else if a.limit > 0 && len(a.counts) >= a.limit {
+		a.evict()
+	}
+	a.counts[wc.word] = wc
+	if a.limit > 0 {
+		a.touch(wc)
+	}
+}
+
+// touch 更新 wc.word 在淘汰堆中的计数和最后出现的时刻
+func (a *Aggregator) touch(wc wordCount) {
+	a.tick++
+	if e, ok := a.entries[wc.word]; ok {
+		e.count, e.tick = wc.count, a.tick
+		heap.Fix(&a.evictions, e.index)
+		return
+	}
+	e := &evictionEntry{word: wc.word, count: wc.count, tick: a.tick}
+	a.entries[wc.word] = e
+	heap.Push(&a.evictions, e)
+}
+
+// evict 淘汰计数最小的 word
+func (a *Aggregator) evict() {
+	e := heap.Pop(&a.evictions).(*evictionEntry)
+	delete(a.entries, e.word)
+	delete(a.counts, e.word)
+	a.evicted++
+}
+
+// Len 返回已聚合的不同 word 的数量
+func (a *Aggregator) Len() int {
+	return len(a.counts)
+}
+
+// Result 返回按照 word 排序的聚合结果
+func (a *Aggregator) Result() []WordCount {
+	sorted := a.sorted()
+	result := make([]WordCount, len(sorted))
+	for i, wc := range sorted {
+		result[i] = WordCount{Word: wc.word, Count: wc.count}
+	}
+	return result
+}
+
+// sorted 返回按照 word 排序的 wordCount，保留 forms 等附加信息
+func (a *Aggregator) sorted() []wordCount {
+	result := make([]wordCount, 0, len(a.counts))
+	for _, wc := range a.counts {
+		result = append(result, wc)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].word < result[j].word })
+	return result
+}
+
+// drainSorted 按照 word 的顺序将聚合结果依次交给 emit，并同时将其从 aggregator 中删除。
+// 与 sorted 相比只需要排序 word 而不需要第二份完整结果的副本，已输出结果中引用的内存可以尽早释放。
+func (a *Aggregator) drainSorted(emit func(wordCount) error) error {
+	words := make([]string, 0, len(a.counts))
+	for w := range a.counts {
+		words = append(words, w)
+	}
+	sort.Strings(words)
+
+	for _, w := range words {
+		wc := a.counts[w]
+		delete(a.counts, w)
+		if err := emit(wc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset 清空已聚合的结果
+func (a *Aggregator) Reset() {
+	clear(a.counts)
+	clear(a.entries)
+	a.evictions = a.evictions[:0]
+	a.tick, a.evicted = 0, 0
+}
+
+// aggregate 使用 aggregator 聚合 wordCount 流，输入结束后输出结果，可以代替 sorter 和 reducer 的组合。
+// ordered 为 true 时按照 word 排序输出，下游会重新排序时可以传入 false 以省去排序。
+// top 不为 nil 时只输出由 top 从聚合结果中直接选出的前 N 个结果。
+func aggregate(ctx context.Context, eg *errgroup.Group, input <-chan wordCount, fn func(acc, next wordCount) wordCount, ordered bool, top *topSelector) <-chan wordCount {
+	return aggregateInto(ctx, eg, input, newCappedAggregator(fn, lruCap), ordered, top)
+}
+
+// aggregateInto 与 aggregate 相同，但使用调用方提供的空 agg 聚合，使 -serve 的请求可以重复使用 Aggregator。
+// agg 在 eg.Wait 返回之前不能被其他调用使用。
+func aggregateInto(ctx context.Context, eg *errgroup.Group, input <-chan wordCount, agg *Aggregator, ordered bool, top *topSelector) <-chan wordCount {
+	ch := make(chan wordCount)
+
+	eg.Go(func() error {
+		defer func() { close(ch); logger.Debug("aggregator exits") }()
+		for wc := range input {
+			agg.add(wc)
+			wordsAggregated.Store(int64(agg.Len()))
+		}
+		if agg.evicted > 0 {
+			logger.Warn("words were evicted by -lru-cap, counts are approximate", "evicted", agg.evicted)
+		}
+
+		if top != nil {
+			for _, wc := range agg.counts {
+				top.add(wc)
+			}
+			return sendAll(ctx, ch, top.result())
+		}
+		if !ordered {
+			for _, wc := range agg.counts {
+				select {
+				case ch <- wc:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		}
+
+		if streamSorted {
+			return agg.drainSorted(func(wc wordCount) error {
+				select {
+				case ch <- wc:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+		}
+		for _, wc := range agg.sorted() {
+			select {
+			case ch <- wc:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	return ch
+}
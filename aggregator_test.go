@@ -0,0 +1,142 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestAggregator 检查 Add 累加相同 token 的计数，Result 按照 word 排序返回结果，Reset 之后可以重新计数
+func TestAggregator(t *testing.T) {
+	agg := NewAggregator()
+	if got := agg.Result(); len(got) != 0 {
+		t.Errorf("Result of an empty Aggregator = %v, want none", got)
+	}
+	for _, token := range strings.Fields("the cat and the dog and the bird") {
+		agg.Add(token)
+	}
+	want := []WordCount{{"and", 2}, {"bird", 1}, {"cat", 1}, {"dog", 1}, {"the", 3}}
+	if got := agg.Result(); !slices.Equal(got, want) {
+		t.Errorf("Result = %v, want %v", got, want)
+	}
+	// Result 不改变已聚合的结果
+	agg.Add("cat")
+	want[2].Count = 2
+	if got := agg.Result(); !slices.Equal(got, want) {
+		t.Errorf("Result after adding cat = %v, want %v", got, want)
+	}
+	// Add 不对 token 进行规范化
+	agg.Add("The")
+	if got := agg.Result(); len(got) != 6 || got[0] != (WordCount{"The", 1}) {
+		t.Errorf("Result after adding The = %v, want The counted separately", got)
+	}
+
+	agg.Reset()
+	if got := agg.Result(); len(got) != 0 || agg.Len() != 0 {
+		t.Errorf("Result after Reset = %v, want none", got)
+	}
+	agg.Add("dog")
+	agg.Add("dog")
+	if got, want := agg.Result(), []WordCount{{"dog", 2}}; !slices.Equal(got, want) {
+		t.Errorf("Result after Reset and adding dog twice = %v, want %v", got, want)
+	}
+}
+
+// TestCappedAggregator 检查 -lru-cap 的 aggregator 已满时淘汰计数最小的 word，计数相同时淘汰最久没有出现的 word，
+// 高频 word 的计数保留下来，被淘汰的 word 再次出现时从头开始计数
+func TestCappedAggregator(t *testing.T) {
+	tests := []struct {
+		tokens  string
+		want    []WordCount
+		evicted int
+	}{
+		{"the the the a b c the d", []WordCount{{"d", 1}, {"the", 4}}, 3},
+		{"x y z", []WordCount{{"y", 1}, {"z", 1}}, 1},
+		{"x y x z", []WordCount{{"x", 2}, {"z", 1}}, 1},
+		{"a a b c b", []WordCount{{"a", 2}, {"b", 1}}, 2},
+	}
+	for _, tt := range tests {
+		agg := newCappedAggregator(reduceFn, 2)
+		for _, token := range strings.Fields(tt.tokens) {
+			agg.Add(token)
+		}
+		if got := agg.Result(); !slices.Equal(got, tt.want) || agg.evicted != tt.evicted {
+			t.Errorf("%q: Result = %v with %d evicted, want %v with %d evicted", tt.tokens, got, agg.evicted, tt.want, tt.evicted)
+		}
+	}
+
+	stdout, stderr, code := runMain(t, "the the the a b c the d\n", "-f", "/dev/stdin", "-lru-cap", "2")
+	if code != 0 || stdout != "d                 1\nthe               4\n" {
+		t.Errorf("-lru-cap 2: exit status %d, output %q", code, stdout)
+	}
+	if !strings.Contains(stderr, "counts are approximate") || !strings.Contains(stderr, "evicted=3") {
+		t.Errorf("-lru-cap 2: stderr %q does not warn about the evicted words", stderr)
+	}
+}
+
+// TestStreamSorted 检查 drainSorted 按照 word 的顺序输出与 sorted 相同的结果并清空 aggregator，
+// 以及 -stream-sorted 的输出按照 word 排序且与不指定时相同
+func TestStreamSorted(t *testing.T) {
+	agg := newAggregator(reduceFn)
+	for _, wc := range zipfTokens(10000, 500) {
+		agg.add(wc)
+	}
+	want := agg.sorted()
+
+	var got []wordCount
+	if err := agg.drainSorted(func(wc wordCount) error {
+		got = append(got, wc)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !sort.SliceIsSorted(got, func(i, j int) bool { return got[i].word < got[j].word }) {
+		t.Error("drainSorted output is not sorted by word")
+	}
+	if !slices.EqualFunc(got, want, func(a, b wordCount) bool { return a.word == b.word && a.count == b.count }) {
+		t.Errorf("drainSorted returned %d results, want the %d results of Result", len(got), len(want))
+	}
+	if agg.Len() != 0 {
+		t.Errorf("aggregator still holds %d words after drainSorted", agg.Len())
+	}
+
+	text := "delta alpha charlie\nbravo alpha echo delta\n"
+	stdout, stderr, code := runMain(t, text, "-f", "/dev/stdin", "-strategy", "map", "-stream-sorted")
+	if want := "alpha             2\nbravo             1\ncharlie           1\ndelta             2\necho              1\n"; code != 0 || stdout != want {
+		t.Errorf("-stream-sorted: exit status %d, output %q, want %q (stderr %q)", code, stdout, want, stderr)
+	}
+}
+
+// BenchmarkStreamSorted 比较复制全部结果后用 sort.Slice 排序（Result）和只排序 word（drainSorted）的耗时与内存分配
+func BenchmarkStreamSorted(b *testing.B) {
+	tokens := zipfTokens(200000, 100000)
+	newFilled := func() *Aggregator {
+		agg := newAggregator(reduceFn)
+		for _, wc := range tokens {
+			agg.add(wc)
+		}
+		return agg
+	}
+
+	b.Run("sort.Slice", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			agg := newFilled()
+			b.StartTimer()
+			for _, wc := range agg.sorted() {
+				_ = wc
+			}
+		}
+	})
+	b.Run("stream-sorted", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			agg := newFilled()
+			b.StartTimer()
+			_ = agg.drainSorted(func(wordCount) error { return nil })
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// loadConfigFile 读取配置文件，将其中的配置项作为对应 flag 的默认值。
+// 命令行中显式指定的 flag 优先级更高，不会被配置文件覆盖；未知的配置项只输出警告。
+//
+// 配置文件支持 TOML 和 YAML 的一个扁平子集：每行一个 `key = value`（TOML）或
+// `key: value`（YAML，以 .yaml/.yml 后缀识别），key 即 flag 名称（`_` 等价于 `-`），
+// 以 `#` 开头的行为注释，数组 `["a", "b"]` 会对 flag 逐个赋值。
+func loadConfigFile(path string, explicit map[string]bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sep := "="
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		sep = ":"
+	}
+
+	sc := bufio.NewScanner(f)
+	for lineNum := 1; sc.Scan(); lineNum++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, sep)
+		if !ok {
+			warnf("%s:%d: ignoring malformed line %q", path, lineNum, line)
+			continue
+		}
+		key = strings.ReplaceAll(strings.TrimSpace(key), "_", "-")
+		if key == "config" || flag.Lookup(key) == nil {
+			warnf("%s:%d: unknown config key %q", path, lineNum, key)
+			continue
+		}
+		if explicit[key] {
+			continue
+		}
+
+		for _, v := range parseConfigValue(value) {
+			if err := flag.Set(key, v); err != nil {
+				return fmt.Errorf("%s:%d: invalid value for %q: %w", path, lineNum, key, err)
+			}
+		}
+	}
+
+	return sc.Err()
+}
+
+// envAliases 为部分 flag 指定更直观的环境变量名称
+var envAliases = map[string]string{
+	"f": "WC_INPUT",
+}
+
+// envName 返回 flag 对应的环境变量名称，默认为 `WC_` 加上大写的 flag 名称（`-` 替换为 `_`）
+func envName(name string) string {
+	if alias, ok := envAliases[name]; ok {
+		return alias
+	}
+	return "WC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnv 使用环境变量填充命令行中未显式指定的 flag
+func applyEnv(explicit map[string]bool) error {
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if err != nil || explicit[f.Name] || f.Name == "config" {
+			return
+		}
+		if v, ok := os.LookupEnv(envName(f.Name)); ok {
+			// 可以重复指定的 flag 每次赋值都会追加，环境变量需要替换配置文件中的取值而不是追加
+			if l, ok := f.Value.(*stringList); ok {
+				*l = nil
+			}
+			if e := flag.Set(f.Name, v); e != nil {
+				err = fmt.Errorf("invalid value for %s: %w", envName(f.Name), e)
+			}
+		}
+	})
+	return err
+}
+
+// parseConfigValue 解析配置项的值，去掉行尾注释和引号，数组会被拆分成多个值
+func parseConfigValue(value string) []string {
+	value = stripComment(strings.TrimSpace(value))
+
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		var values []string
+		for _, v := range strings.Split(value[1:len(value)-1], ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, unquote(v))
+			}
+		}
+		return values
+	}
+
+	return []string{unquote(value)}
+}
+
+// stripComment 去掉引号之外以空白加 `#` 开始的行尾注释，引号内的 `#` 是值的一部分
+func stripComment(value string) string {
+	var quote byte
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || value[i-1] == ' ' || value[i-1] == '\t'):
+			return strings.TrimSpace(value[:i])
+		}
+	}
+	return value
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// writeEffectiveConfig 以配置文件的格式输出合并命令行、环境变量和配置文件之后生效的所有选项，
+// 输入为展开后的文件列表，输出可以直接作为 -config 使用
+func writeEffectiveConfig(w io.Writer, files []string) error {
+	quoted := make([]string, len(files))
+	for i, f := range files {
+		quoted[i] = fmt.Sprintf("%q", f)
+	}
+	if _, err := fmt.Fprintf(w, "f = [%s]\n", strings.Join(quoted, ", ")); err != nil {
+		return err
+	}
+
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Name == "f" || f.Name == "config" || f.Name == "dry-run" {
+			return
+		}
+		value := f.Value.String()
+		if g, ok := f.Value.(flag.Getter); ok {
+			switch g.Get().(type) {
+			case bool, int, int64, uint, uint64, float64:
+			default:
+				value = fmt.Sprintf("%q", value)
+			}
+		}
+		_, err = fmt.Fprintf(w, "%s = %s\n", f.Name, value)
+	})
+	return err
+}
+
+// explicitFlags 返回命令行中显式指定的 flag 名称集合
+func explicitFlags() map[string]bool {
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	return explicit
+}
+
+func warnf(format string, args ...any) {
+	_, _ = fmt.Fprintf(os.Stderr, "warning: "+format+"\n", args...)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// restoreFlags 在测试结束后把所有 flag 恢复为测试开始时的取值
+func restoreFlags(t *testing.T) {
+	t.Helper()
+	values := make(map[string]string)
+	lists := make(map[string][]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		if l, ok := f.Value.(*stringList); ok {
+			lists[f.Name] = slices.Clone(*l)
+			return
+		}
+		values[f.Name] = f.Value.String()
+	})
+	t.Cleanup(func() {
+		flag.VisitAll(func(f *flag.Flag) {
+			if l, ok := f.Value.(*stringList); ok {
+				*l = lists[f.Name]
+				return
+			}
+			_ = f.Value.Set(values[f.Name])
+		})
+	})
+}
+
+func TestParseConfigValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{`count`, []string{"count"}},
+		{`count # sort by count`, []string{"count"}},
+		{`"count"`, []string{"count"}},
+		{`"count" # sort by count`, []string{"count"}},
+		{`'a # b' # comment`, []string{"a # b"}},
+		{`"#"`, []string{"#"}},
+		{`a#b`, []string{"a#b"}},
+		{`["a.txt", "b # c.txt"] # inputs`, []string{"a.txt", "b # c.txt"}},
+		{`[a, b]`, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		if got := parseConfigValue(tt.value); !slices.Equal(got, tt.want) {
+			t.Errorf("parseConfigValue(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	restoreFlags(t)
+	path := filepath.Join(t.TempDir(), "wc.toml")
+	config := "# defaults\nsort = \"count\" # most frequent first\nn = 5\nformat = json\nunknown_key = 1\n"
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 命令行中显式指定的 -format 不会被配置文件覆盖
+	if err := loadConfigFile(path, map[string]bool{"format": true}); err != nil {
+		t.Fatal(err)
+	}
+	if sortOrder != "count" || topN != 5 || format != "text" {
+		t.Errorf("got -sort %q -n %d -format %q, want count 5 text", sortOrder, topN, format)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	restoreFlags(t)
+	path := filepath.Join(t.TempDir(), "wc.yaml")
+	if err := os.WriteFile(path, []byte("f: [a.txt, b.txt]\nsort: count\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("WC_INPUT", "c.txt")
+	t.Setenv("WC_SORT", "length")
+	t.Setenv("WC_N", "3")
+
+	// 显式指定的 -n 优先于环境变量，环境变量优先于配置文件
+	explicit := map[string]bool{"n": true}
+	if err := loadConfigFile(path, explicit); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyEnv(explicit); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(inputFiles, stringList{"c.txt"}) {
+		t.Errorf("got -f %q, want WC_INPUT to replace the config file inputs", inputFiles)
+	}
+	if sortOrder != "length" {
+		t.Errorf("got -sort %q, want length from WC_SORT", sortOrder)
+	}
+	if topN != 0 {
+		t.Errorf("got -n %d, want the explicit flag to ignore WC_N", topN)
+	}
+
+	t.Setenv("WC_N", "many")
+	if err := applyEnv(nil); err == nil {
+		t.Error("applyEnv succeeded with an invalid WC_N")
+	}
+}
+
+// TestDryRun 检查 -dry-run 在选项合法时输出生效的配置并以状态 0 退出而不读取输入，选项不合法时输出具体的问题并以非零状态退出
+func TestDryRun(t *testing.T) {
+	// 输入是二进制文件，如果被读取会因为 errBinaryInput 而失败
+	path := filepath.Join(t.TempDir(), "input.dat")
+	if err := os.WriteFile(path, []byte("alpha\x00beta\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, code := runMain(t, "", "-f", path, "-sort", "count", "-n", "5", "-include-regex", "^a", "-dry-run")
+	if code != 0 {
+		t.Fatalf("exit status %d, stderr %q", code, stderr)
+	}
+	for _, want := range []string{`f = ["` + path + `"]`, `sort = "count"`, "n = 5", `include-regex = "^a"`, `strategy = "map"`} {
+		if !strings.Contains(stdout, want+"\n") {
+			t.Errorf("summary %q does not contain %q", stdout, want)
+		}
+	}
+	if strings.Contains(stdout, "beta") || stderr != "" {
+		t.Errorf("the input was read: stdout %q, stderr %q", stdout, stderr)
+	}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-f", path, "-include-regex", "("}, "invalid options: invalid -include-regex: error parsing regexp: missing closing )"},
+		{[]string{"-f", path, "-format", "nope"}, `invalid options: unknown -format "nope"`},
+		{[]string{"-f", path + ".missing"}, "failed to open file: stat " + path + ".missing"},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, "", append(tt.args, "-dry-run")...)
+		if code == 0 {
+			t.Errorf("%v: exit status 0, want an error (stdout %q)", tt.args, stdout)
+		}
+		if !strings.Contains(stderr, tt.want) {
+			t.Errorf("%v: stderr %q does not contain %q", tt.args, stderr, tt.want)
+		}
+	}
+}
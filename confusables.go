@@ -0,0 +1,32 @@
+package main
+
+import "strings"
+
+// confusables 是 Unicode TR39 confusables.txt 中与 ASCII 字母外形相同的常见字符的子集，
+// 包括西里尔字母、希腊字母和全角拉丁字母，每个字符映射到它的 ASCII 骨架（skeleton）
+var confusables = map[rune]rune{
+	// 西里尔字母
+	'а': 'a', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j', 'ӏ': 'l', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'с': 'c',
+	'ѕ': 's', 'у': 'y', 'ԝ': 'w', 'х': 'x', 'ԁ': 'd',
+	'А': 'A', 'В': 'B', 'Е': 'E', 'Һ': 'H', 'І': 'I', 'Ј': 'J', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O',
+	'Р': 'P', 'Ԛ': 'Q', 'С': 'C', 'Ѕ': 'S', 'Т': 'T', 'У': 'Y', 'Ԝ': 'W', 'Х': 'X',
+	// 希腊字母
+	'α': 'a', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'υ': 'u',
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M', 'Ν': 'N', 'Ο': 'O',
+	'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+}
+
+// foldConfusables 将 s 中与 ASCII 字母外形相同的字符替换成对应的 ASCII 字母，
+// 使仅在视觉上相同（如拉丁字母 "a" 与西里尔字母 "а"）的 word 合并为同一个 word
+func foldConfusables(s string) string {
+	return strings.Map(func(r rune) rune {
+		// 全角拉丁字母 Ａ-Ｚ、ａ-ｚ
+		if r >= 'Ａ' && r <= 'Ｚ' || r >= 'ａ' && r <= 'ｚ' {
+			return r - 'Ａ' + 'A'
+		}
+		if c, ok := confusables[r]; ok {
+			return c
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"io"
+	"math/rand"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Options 是 CountAll 的选项，零值字段使用命令行中对应 flag 的取值。
+// 其他所有选项（过滤、-n、-tiebreak 等）都直接读取包级别的 flag 变量，没有对应的字段。
+type Options struct {
+	// TopN 不为 0 时只返回计数最高的 TopN 个 word（计数相同时按照 -tie-break 排序），在 -n 的基础上生效
+	TopN int
+	// Seed 不为 0 时代替 -seed 作为抽样等随机化处理的种子
+	Seed int64
+}
+
+// CountAll 读取 r 中的全部文本，按照当前的选项（过滤、-n 等）和 opts 运行与 -serve 的请求相同的 pipeline，
+// 并以 map 的形式返回最终的计数，适合只需要结果而不需要流式输出的调用方。
+// ctx 被取消时返回 nil 和 ctx.Err()，不会返回部分结果。CountAll 总是等待 pipeline 的所有 goroutine 退出后才返回，
+// 而读取 r 的 goroutine 阻塞在 Read 中时不会察觉 ctx 被取消，因此调用方需要在取消 ctx 时关闭 r（如 io.PipeReader）使 Read 返回。
+//
+// CountAll 不能与修改 flag 变量的代码同时运行：pipeline 的每个阶段以及 byCount 使用的 tieBreaker 都在运行期间读取包级别的变量，
+// flag.Parse、flag.Set 或加载配置文件与 CountAll 并发时会发生数据竞争，结果也可能混合两组选项。
+// 多个 CountAll 之间只有 opts 不同，可以像 -serve 的多个请求一样并发调用，但是它们总是共享相同的 flag 取值。
+func CountAll(ctx context.Context, r io.Reader, opts Options) (map[string]int, error) {
+	eg, egCtx := errgroup.WithContext(ctx)
+	// 与 HTTP 请求一样使用独立的随机数生成器，指定 -seed 时结果可以复现
+	s := seed
+	if opts.Seed != 0 {
+		s = opts.Seed
+	}
+	rng := rand.New(rand.NewSource(s))
+	lines := make(chan inputLine)
+	eg.Go(func() error {
+		defer close(lines)
+		return readLines(egCtx, r, 0, lines, rand.New(rand.NewSource(rng.Int63())))
+	})
+
+	var top *topSelector
+	if opts.TopN > 0 {
+		top = newTopSelector(opts.TopN, byCount)
+	}
+	counts := make(map[string]int)
+	reduced := countLines(egCtx, eg, lines, newCappedAggregator(reduceFn, lruCap), rng, requestRunStats())
+	eg.Go(func() error {
+		for wc := range reduced {
+			if top != nil {
+				top.add(wc)
+				continue
+			}
+			counts[wc.word] = wc.count
+		}
+		return nil
+	})
+
+	err := eg.Wait()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if top != nil {
+		for _, wc := range top.result() {
+			counts[wc.word] = wc.count
+		}
+	}
+	return counts, nil
+}
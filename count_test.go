@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCountAll(t *testing.T) {
+	text := "the quick brown fox\njumps over the lazy dog\nthe end"
+	counts, err := CountAll(context.Background(), strings.NewReader(text), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"the": 3, "quick": 1, "brown": 1, "fox": 1, "jumps": 1, "over": 1, "lazy": 1, "dog": 1, "end": 1}
+	if !maps.Equal(counts, want) {
+		t.Errorf("counts %v, want %v", counts, want)
+	}
+
+	// 计数相同时按照 word 排序，取前两个
+	counts, err = CountAll(context.Background(), strings.NewReader(text), Options{TopN: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"the": 3, "brown": 1}; !maps.Equal(counts, want) {
+		t.Errorf("TopN 2: counts %v, want %v", counts, want)
+	}
+}
+
+// TestCountAllCancel 检查 ctx 被取消且 r 被关闭后 CountAll 返回 ctx.Err()，并且没有遗留的 goroutine
+func TestCountAllCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	pr, pw := io.Pipe()
+	go func() { _, _ = io.WriteString(pw, "partial input\n") }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	var counts map[string]int
+	var err error
+	go func() {
+		defer close(done)
+		counts, err = CountAll(ctx, pr, Options{})
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+		t.Fatal("CountAll returned before r was closed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// 关闭 r 使阻塞的 Read 返回
+	_ = pr.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("CountAll did not return after the context was cancelled and r was closed")
+	}
+	if !errors.Is(err, context.Canceled) || counts != nil {
+		t.Errorf("CountAll returned %v, %v, want nil and %v", counts, err, context.Canceled)
+	}
+	_ = pw.Close()
+
+	// CountAll 返回时 pipeline 的 goroutine 都已经退出
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines are still running after CountAll returned, %d before", n, before)
+	}
+
+	// 已经取消的 ctx
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if counts, err := CountAll(ctx, strings.NewReader("alpha beta"), Options{}); !errors.Is(err, context.Canceled) || counts != nil {
+		t.Errorf("CountAll with a cancelled context returned %v, %v, want nil and %v", counts, err, context.Canceled)
+	}
+}
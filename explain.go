@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// explainWord 是 -explain 指定的 word 经过 normalizeToken 处理后的形式，为空时不跟踪
+var explainWord string
+
+// explained 记录 -explain 跟踪到的 word 的原始形式及其出现次数，以及合并后的最终计数
+var explained struct {
+	mu     sync.Mutex
+	forms  map[string]int
+	tokens int
+	count  int
+	found  bool
+}
+
+// explainKey 返回 word 作为计数使用的 word 的形式，使 -explain Running 在指定 -stem 时跟踪 run。
+// word 本身会被过滤掉时原样返回。
+func explainKey(word string) string {
+	for _, wc := range mapFn(word) {
+		return wc.word
+	}
+	return word
+}
+
+// explainToken 向 stderr 输出 mapFn 从行 l 中得到的 wc 的来历：所在的文件、行和列，所在的原始字段，
+// 以及拆分 token 之后依次改变了它的处理步骤
+func explainToken(wc wordCount, l inputLine) {
+	line := prepareLine(l.text)
+	pos := int(wc.offset)
+	var orig, raw string
+	for _, tok := range splitTokens(line) {
+		if tok.pos == pos {
+			orig, raw = tok.text, tok.field
+			break
+		}
+	}
+
+	field := fieldAt(line, pos)
+	steps := []string{fmt.Sprintf("%q", field)}
+	if orig != field {
+		steps = append(steps, fmt.Sprintf("%q (split)", orig))
+	}
+	last := orig
+	normalizeTokenTrace(orig, raw, func(step, w string) {
+		steps = append(steps, fmt.Sprintf("%q (%s)", w, step))
+		last = w
+	})
+	if last != wc.word {
+		// 如 -char-digrams 从 word 中拆出的字符对
+		steps = append(steps, fmt.Sprintf("%q", wc.word))
+	}
+
+	name := "-"
+	if l.file < len(sourceNames) {
+		name = sourceNames[l.file]
+	}
+
+	explained.mu.Lock()
+	defer explained.mu.Unlock()
+	if explained.forms == nil {
+		explained.forms = make(map[string]int)
+	}
+	explained.forms[orig]++
+	explained.tokens++
+	_, _ = fmt.Fprintf(os.Stderr, "explain: %s:%d:%d: %s\n", name, l.num, pos+1, strings.Join(steps, " -> "))
+}
+
+// fieldAt 返回 line 中包含字节位置 pos 的以分隔符分隔的字段
+func fieldAt(line string, pos int) string {
+	start := pos
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(line[:start])
+		if isSeparator(r) {
+			break
+		}
+		start -= size
+	}
+	end := pos
+	for end < len(line) {
+		r, size := utf8.DecodeRuneInString(line[end:])
+		if isSeparator(r) {
+			break
+		}
+		end += size
+	}
+	return line[start:end]
+}
+
+// explainResult 记录 -explain 跟踪的 word 合并后的计数，作为 wordFilter 的 keep 函数使用，不过滤任何结果
+func explainResult(wc wordCount) bool {
+	if wc.word == explainWord {
+		explained.mu.Lock()
+		explained.count, explained.found = wc.count, true
+		explained.mu.Unlock()
+	}
+	return true
+}
+
+// writeExplain 输出 -explain 跟踪的 word 的最终计数和它的各种原始形式，需要在 pipeline 结束后调用
+func writeExplain(w io.Writer) error {
+	explained.mu.Lock()
+	defer explained.mu.Unlock()
+	if !explained.found {
+		_, err := fmt.Fprintf(w, "explain: %q is not in the results (%d tokens)\n", explainWord, explained.tokens)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "explain: %q counted %d from %d tokens %s\n",
+		explainWord, explained.count, explained.tokens, countBreakdown(explained.forms))
+	return err
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(a, []byte("The cat.\nA CAT, and cat\ndog\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("cats\ncat\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, code := runMain(t, "", "-f", a, "-f", b, "-explain", "cat")
+	if code != 0 {
+		t.Fatalf("exit status %d, stderr %q", code, stderr)
+	}
+	if got := parseCounts(t, stdout)["cat"]; got != 4 {
+		t.Errorf("count of cat = %d, want 4", got)
+	}
+
+	// 每一次出现都单独输出一行，"cats" 不是 cat 的出现
+	var got []string
+	for _, line := range strings.Split(strings.TrimSuffix(stderr, "\n"), "\n") {
+		got = append(got, strings.TrimPrefix(line, "explain: "))
+	}
+	slices.Sort(got)
+	want := []string{
+		`"cat" counted 4 from 4 tokens (cat:3, CAT:1)`,
+		a + `:1:5: "cat." -> "cat" (split)`,
+		a + `:2:12: "cat"`,
+		a + `:2:3: "CAT," -> "CAT" (split) -> "cat" (lowercase)`,
+		b + `:2:1: "cat"`,
+	}
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("explain output:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"path/filepath"
+)
+
+// fileSet 是记录 word 出现在哪些输入文件中的位图，第 i 位对应第 i 个输入文件，
+// 只在指定 -common 或 -unique-to 时记录
+type fileSet []uint64
+
+// newFileSet 返回只包含第 file 个输入文件的 fileSet
+func newFileSet(file int) fileSet {
+	s := make(fileSet, file/64+1)
+	s[file/64] |= 1 << (file % 64)
+	return s
+}
+
+// union 将 o 合并到 s 中并返回结果，可能会修改 s
+func (s fileSet) union(o fileSet) fileSet {
+	for len(s) < len(o) {
+		s = append(s, 0)
+	}
+	for i, b := range o {
+		s[i] |= b
+	}
+	return s
+}
+
+// has 判断 s 是否包含第 file 个输入文件
+func (s fileSet) has(file int) bool {
+	return file/64 < len(s) && s[file/64]&(1<<(file%64)) != 0
+}
+
+// remove 从 s 中删除第 file 个输入文件
+func (s fileSet) remove(file int) {
+	if file/64 < len(s) {
+		s[file/64] &^= 1 << (file % 64)
+	}
+}
+
+// len 返回 s 中的文件数量
+func (s fileSet) len() int {
+	var n int
+	for _, b := range s {
+		n += bits.OnesCount64(b)
+	}
+	return n
+}
+
+// trackFiles 判断是否需要记录每个 word 出现在哪些输入文件中
+func trackFiles() bool {
+	return commonWords || uniqueTo != ""
+}
+
+// trackSources 判断是否需要记录每个 word 在每个输入文件中的计数。
+// 指定 -keep-going 时需要从结果中减去中途读取失败的文件已经贡献的计数；-fast-tokenize 按文件聚合，失败的文件不会输出部分结果。
+func trackSources() bool {
+	return sourceBreakdown || rankCorr || (keepGoing && !fastTokenize)
+}
+
+// fileIndex 返回 path 在输入文件列表 files 中的位置
+func fileIndex(files []string, path string) (int, error) {
+	for i, f := range files {
+		if filepath.Clean(f) == filepath.Clean(path) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%s is not one of the input files", path)
+}
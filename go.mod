@@ -2,4 +2,18 @@ module github.com/TomCN0803/wc-example
 
 go 1.21.6
 
-require golang.org/x/sync v0.6.0
+require (
+	github.com/rivo/uniseg v0.4.7
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	golang.org/x/sync v0.6.0
+	google.golang.org/grpc v1.64.0
+	google.golang.org/protobuf v1.33.0
+)
+
+require (
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	golang.org/x/net v0.22.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+)
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+)
+
+// isASCII 判断 s 是否只包含 ASCII 字符，此时每个字节都是一个字素簇
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// wordLen 返回 word 的长度，默认为字符（rune）数，指定 -grapheme-length 时为 UAX #29 的字素簇（grapheme cluster）数。
+// 默认的分词规则只保留 ASCII 字母，只有 -token-regex、-raw-words 等保留了非 ASCII 字符的 word 才需要分段。
+func wordLen(s string) int {
+	if isASCII(s) {
+		return len(s)
+	}
+	if graphemeLength {
+		return uniseg.GraphemeClusterCount(s)
+	}
+	return utf8.RuneCountInString(s)
+}
+
+// truncateWord 将 s 截断为最多 n 个字符，指定 -grapheme-length 时截断为最多 n 个字素簇
+func truncateWord(s string, n int) string {
+	if !graphemeLength || isASCII(s) {
+		return truncateRunes(s, n)
+	}
+	end, state := 0, -1
+	for ; n > 0 && end < len(s); n-- {
+		var cluster string
+		cluster, _, _, state = uniseg.FirstGraphemeClusterInString(s[end:], state)
+		end += len(cluster)
+	}
+	return s[:end]
+}
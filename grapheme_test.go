@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestGraphemeLength 检查含组合字符的 word 和带肤色修饰符的 emoji 的字素簇长度与字符长度不同
+func TestGraphemeLength(t *testing.T) {
+	restoreFlags(t)
+	tests := []struct {
+		word            string
+		runes, clusters int
+	}{
+		{"alpha", 5, 5},
+		{"cafe\u0301", 5, 4},
+		{"👍🏽", 2, 1},
+		{"👨‍👩‍👧", 5, 1},
+	}
+	for _, tt := range tests {
+		graphemeLength = false
+		if got := wordLen(tt.word); got != tt.runes {
+			t.Errorf("wordLen(%q) = %d, want %d runes", tt.word, got, tt.runes)
+		}
+		graphemeLength = true
+		if got := wordLen(tt.word); got != tt.clusters {
+			t.Errorf("wordLen(%q) with -grapheme-length = %d, want %d grapheme clusters", tt.word, got, tt.clusters)
+		}
+	}
+
+	graphemeLength = false
+	if got := truncateWord("👍🏽ok", 1); got != "👍" {
+		t.Errorf("truncateWord to 1 rune = %q, want %q", got, "👍")
+	}
+	graphemeLength = true
+	if got := truncateWord("👍🏽ok", 2); got != "👍🏽o" {
+		t.Errorf("truncateWord to 2 grapheme clusters = %q, want %q", got, "👍🏽o")
+	}
+
+	text := "👍🏽 ok cafe\u0301 abc\n"
+	if stdout, stderr, code := runMain(t, text, "-f", "/dev/stdin", "-raw-words", "-min-len", "2", "-max-len", "4"); code != 0 || stdout != "abc               1\nok                1\n👍🏽                1\n" {
+		t.Errorf("-min-len 2 -max-len 4: exit status %d, output %q (stderr %q)", code, stdout, stderr)
+	}
+	if stdout, stderr, code := runMain(t, text, "-f", "/dev/stdin", "-raw-words", "-min-len", "2", "-max-len", "4", "-grapheme-length"); code != 0 || stdout != "abc               1\ncafe\u0301             1\nok                1\n" {
+		t.Errorf("-min-len 2 -max-len 4 -grapheme-length: exit status %d, output %q (stderr %q)", code, stdout, stderr)
+	}
+}
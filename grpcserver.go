@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/TomCN0803/wc-example/wordcount"
+)
+
+// serveGRPC 在 addr 上提供 wordcount/wordcount.proto 中定义的 WordCounter 服务，直到 ctx 被取消
+func serveGRPC(ctx context.Context, addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	srv := grpc.NewServer()
+	wordcount.RegisterWordCounterServer(srv, wordCounterServer{})
+	// 收到信号时停止接收新的调用，并等待正在处理的调用结束
+	stop := context.AfterFunc(ctx, srv.GracefulStop)
+	defer stop()
+
+	logger.Info("serving gRPC", "addr", lis.Addr().String())
+	return srv.Serve(lis)
+}
+
+type wordCounterServer struct {
+	wordcount.UnimplementedWordCounterServer
+}
+
+// Count 将客户端发送的行送入 pipeline，客户端关闭发送端后按照输出顺序返回最终的计数结果。
+// 客户端取消调用时 stream 的 context 被取消，pipeline 随之退出。
+func (wordCounterServer) Count(stream wordcount.WordCounter_CountServer) error {
+	start := time.Now()
+	defer func() { serverMetrics.observe(time.Since(start)) }()
+
+	eg, ctx := errgroup.WithContext(stream.Context())
+	rng := rand.New(rand.NewSource(seed))
+	run := requestRunStats()
+	lines := make(chan inputLine)
+	eg.Go(func() error {
+		defer close(lines)
+		for num := 1; ; num++ {
+			msg, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			linesRead.Add(1)
+			bytesRead.Add(int64(len(msg.GetText())))
+			run.bytes.Add(int64(len(msg.GetText())))
+			select {
+			case lines <- inputLine{text: msg.GetText(), num: num}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+
+	agg := requestAggregators.Get().(*Aggregator)
+	defer releaseAggregator(agg)
+	reduced := countLines(ctx, eg, countStage(ctx, eg, lines, run.lines), agg, rng, run)
+	eg.Go(func() error {
+		for wc := range reduced {
+			if err := stream.Send(&wordcount.WordCount{Word: displayWord(wc), Count: int64(wc.count)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err := eg.Wait(); err != nil {
+		serverMetrics.failures.Add(1)
+		return status.FromContextError(err).Err()
+	}
+	return nil
+}
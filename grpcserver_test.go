@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/TomCN0803/wc-example/wordcount"
+)
+
+// dialWordCounter 在内存中的连接上启动 WordCounter 服务，返回连接到它的客户端
+func dialWordCounter(t *testing.T) wordcount.WordCounterClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	wordcount.RegisterWordCounterServer(srv, wordCounterServer{})
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return wordcount.NewWordCounterClient(conn)
+}
+
+func TestWordCounterCount(t *testing.T) {
+	client := dialWordCounter(t)
+	stream, err := client.Count(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{"the quick brown fox", "jumps over the lazy dog", "The end"} {
+		if err := stream.Send(&wordcount.Line{Text: text}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]int)
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[msg.GetWord()] = int(msg.GetCount())
+	}
+	want := map[string]int{"the": 3, "quick": 1, "brown": 1, "fox": 1, "jumps": 1, "over": 1, "lazy": 1, "dog": 1, "end": 1}
+	if !maps.Equal(got, want) {
+		t.Errorf("counts %v, want %v", got, want)
+	}
+}
+
+// TestWordCounterCancel 检查客户端取消调用后服务端的 pipeline 退出，调用以 Canceled 结束
+func TestWordCounterCancel(t *testing.T) {
+	client := dialWordCounter(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.Count(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(&wordcount.Line{Text: "never finished"}); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := stream.Recv(); status.Code(err) != codes.Canceled {
+		t.Errorf("Recv after cancel returned %v, want Canceled", err)
+	}
+}
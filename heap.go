@@ -1,25 +1,69 @@
 package main
 
-type wordCountHeap []wordCount
+// wordCountHeap 是按照 less 排序的 wordCount 堆
+type wordCountHeap struct {
+	items []wordCount
+	less  func(a, b wordCount) bool
+}
 
 func (w *wordCountHeap) Len() int {
-	return len(*w)
+	return len(w.items)
 }
 
 func (w *wordCountHeap) Less(i int, j int) bool {
-	return (*w)[i].word < (*w)[j].word
+	return w.less(w.items[i], w.items[j])
 }
 
 func (w *wordCountHeap) Swap(i int, j int) {
-	(*w)[i], (*w)[j] = (*w)[j], (*w)[i]
+	w.items[i], w.items[j] = w.items[j], w.items[i]
 }
 
 func (w *wordCountHeap) Pop() any {
-	v := (*w)[len(*w)-1]
-	*w = (*w)[:len(*w)-1]
+	v := w.items[len(w.items)-1]
+	w.items = w.items[:len(w.items)-1]
 	return v
 }
 
 func (w *wordCountHeap) Push(x any) {
-	*w = append(*w, x.(wordCount))
+	w.items = append(w.items, x.(wordCount))
+}
+
+// evictionEntry 是 -lru-cap 淘汰堆中的一项，tick 为 word 最后一次出现的时刻，index 为其在堆中的位置
+type evictionEntry struct {
+	word  string
+	count int
+	tick  int64
+	index int
+}
+
+// evictionHeap 按照计数从小到大排序，计数相同时最久没有出现的 word 在前，堆顶即下一个被淘汰的 word
+type evictionHeap []*evictionEntry
+
+func (h evictionHeap) Len() int {
+	return len(h)
+}
+
+func (h evictionHeap) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h evictionHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *evictionHeap) Push(x any) {
+	e := x.(*evictionEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *evictionHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
 }
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// resolveInputs 展开输入路径中的通配符，目录在指定 -r 时展开为其中的所有普通文件，否则返回错误。
+// 以 @ 开头的路径表示从列表文件中读取输入路径。指定 -dedup 时，指向同一个文件的多个路径只保留第一个。
+func resolveInputs(patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		if listFile, ok := strings.CutPrefix(pattern, "@"); ok {
+			listed, err := readListFile(listFile)
+			if err != nil {
+				return nil, err
+			}
+			if listed, err = resolveInputs(listed); err != nil {
+				return nil, err
+			}
+			files = append(files, listed...)
+			continue
+		}
+
+		paths := []string{pattern}
+		if strings.ContainsAny(pattern, "*?[") {
+			var err error
+			if paths, err = filepath.Glob(pattern); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+			if len(paths) == 0 {
+				return nil, fmt.Errorf("no files match %q", pattern)
+			}
+		}
+
+		for _, path := range paths {
+			expanded, err := expandPath(path)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, expanded...)
+		}
+	}
+
+	if dedup {
+		return dedupFiles(files)
+	}
+	return files, nil
+}
+
+// readListFile 读取每行一个输入路径的列表文件，忽略空行和以 # 开头的注释行
+func readListFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var paths []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			paths = append(paths, line)
+		}
+	}
+	return paths, sc.Err()
+}
+
+// expandPath 在 path 为目录时返回其中的所有普通文件
+func expandPath(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	if !recursive {
+		return nil, fmt.Errorf("%s is a directory; use -r to recurse", path)
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// dedupFiles 通过绝对路径和符号链接解析后的真实路径去掉重复的文件
+func dedupFiles(files []string) ([]string, error) {
+	seen := make(map[string]bool, len(files))
+	result := files[:0]
+	for _, f := range files {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return nil, err
+		}
+		if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+			abs = resolved
+		} else if info, statErr := os.Stat(abs); statErr != nil || info.Mode().IsRegular() {
+			return nil, err
+		}
+		// 进程替换（如 -f <(cmd)）得到的 /dev/fd/N 链接到无法解析的 pipe:[inode]，每个管道都不会重复，保留原路径即可
+		if seen[abs] {
+			logger.Debug("skip duplicate input", "file", f, "path", abs)
+			continue
+		}
+		seen[abs] = true
+		result = append(result, f)
+	}
+	return result, nil
+}
+
+// inputLine 是从输入中读到的一行数据，file 为所属文件在输入列表中的序号，num 为该行在所属文件中的行号（从 1 开始），
+// offset 为该行在所属文件中的起始字节偏移量
+type inputLine struct {
+	text   string
+	file   int
+	num    int
+	offset int64
+}
+
+// getInputStream 为每个输入文件启动一个 goroutine 并发读取（同时读取的文件数不超过 limit），
+// 并将所有文件读到的行汇聚到返回的 channel 中。rng 用于为每个文件派生独立的随机数生成器。
+func getInputStream(ctx context.Context, eg *errgroup.Group, paths []string, limit int, rng *rand.Rand) <-chan inputLine {
+	sem := make(chan struct{}, limit)
+	streams := make([]<-chan inputLine, 0, len(paths))
+
+	for i, path := range paths {
+		i, path := i, path
+		// 每个文件使用独立的随机数生成器，避免并发读取时共享 rand.Rand
+		rng := rand.New(rand.NewSource(rng.Int63()))
+		ch := make(chan inputLine)
+		if inQuotes {
+			// 引号状态需要按照每个文件中行的顺序跟踪，因此在汇聚之前处理
+			streams = append(streams, quotedText(ctx, eg, ch, singleQuotes))
+		} else {
+			streams = append(streams, ch)
+		}
+
+		eg.Go(func() error {
+			defer func() { close(ch); logger.Debug("file has been read", "file", path) }()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			err := readFile(ctx, path, i, ch, rng)
+			if err != nil && ctx.Err() == nil && keepGoing {
+				// 指定 -keep-going 时单个文件读取失败不会取消整个 pipeline
+				logger.Error("failed to read file, skipping", "file", path, "err", err)
+				recordFailure(i)
+				return nil
+			}
+			return err
+		})
+	}
+
+	return mergeStreams(ctx, eg, streams...)
+}
+
+// failedInputs 记录指定 -keep-going 时读取失败的文件数量，failedFiles 记录它们在输入文件列表中的位置
+var (
+	failedInputs atomic.Int64
+	failedMu     sync.Mutex
+	failedFiles  fileSet
+)
+
+// recordFailure 记录第 file 个输入文件读取失败
+func recordFailure(file int) {
+	failedMu.Lock()
+	defer failedMu.Unlock()
+	failedFiles = failedFiles.union(newFileSet(file))
+	failedInputs.Add(1)
+}
+
+// failedSet 返回读取失败的文件
+func failedSet() fileSet {
+	failedMu.Lock()
+	defer failedMu.Unlock()
+	return slices.Clone(failedFiles)
+}
+
+// readFile 读取 path 中的每一行并发送到 ch 中
+func readFile(ctx context.Context, path string, file int, ch chan<- inputLine, rng *rand.Rand) error {
+	f, err := openFile(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// 取消时关闭文件，使阻塞在 FIFO 等读取操作上的 goroutine 能够退出
+	stop := context.AfterFunc(ctx, func() { _ = f.Close() })
+	defer stop()
+
+	if err := readLines(ctx, f, file, ch, rng); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, errInvalidUTF8) {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// openFile 在单独的 goroutine 中打开文件，使得打开 FIFO 时阻塞在等待写入端的 os.Open 能够被 ctx 取消
+func openFile(ctx context.Context, path string) (*os.File, error) {
+	type result struct {
+		f   *os.File
+		err error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		f, err := os.Open(path)
+		done <- result{f, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.f, r.err
+	case <-ctx.Done():
+		// os.Open 返回后关闭已经打开的文件
+		go func() {
+			if r := <-done; r.f != nil {
+				_ = r.f.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// mergeStreams 将多个 channel 中的数据汇聚到一个 channel 中，所有输入 channel 关闭后才关闭返回的 channel
+func mergeStreams[T any](ctx context.Context, eg *errgroup.Group, streams ...<-chan T) <-chan T {
+	if len(streams) == 1 {
+		return streams[0]
+	}
+
+	ch := make(chan T)
+	var wg sync.WaitGroup
+	wg.Add(len(streams))
+	for _, s := range streams {
+		s := s
+		eg.Go(func() error {
+			defer wg.Done()
+			for v := range s {
+				select {
+				case ch <- v:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		})
+	}
+
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+
+	return ch
+}
+
+// readLines 逐行读取第 file 个输入文件 r 中的数据，并将读到的每一行发送到 ch 中，rng 用于按比例抽样。
+// 指定 -tail 时只在读到结尾后发送最后几行；指定 -no-line-boundaries 时读到结尾后将所有行用空格连接成一行发送。从 r 中读到的字节数会累加到 bytesRead 中。
+func readLines(ctx context.Context, r io.Reader, file int, ch chan<- inputLine, rng *rand.Rand) error {
+	br := bufio.NewReader(countingReader{r, &bytesRead})
+	if err := checkBinary(br); err != nil {
+		return err
+	}
+
+	// doc 为指定 -no-line-boundaries 时已经读到的所有行
+	var doc strings.Builder
+	// send 对一行进行抽样和编码检查后发送到 ch 中
+	send := func(line inputLine) error {
+		if sampleRate < 1 && rng.Float64() >= sampleRate {
+			return nil
+		}
+		if strictUTF8 && !utf8.ValidString(line.text) {
+			return fmt.Errorf("line %d: %w", line.num, errInvalidUTF8)
+		}
+		logger.Debug("read line", "num", line.num, "line", line.text)
+		if noLineBoundaries {
+			// 先将各行用空格连接起来，读完之后作为一行发送
+			if doc.Len() > 0 {
+				doc.WriteByte(' ')
+			}
+			doc.WriteString(line.text)
+			return nil
+		}
+		select {
+		case ch <- line:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if chunkBytes > 0 {
+		return readChunks(br, file, send)
+	}
+
+	// lineLen 记录分行时当前行（包括换行符）实际占用的字节数，用于计算每一行的起始偏移量
+	var offset, lineLen int64
+	sc := bufio.NewScanner(br)
+	split := bufio.ScanLines
+	if universalEOL {
+		split = scanUniversalLines
+	}
+	sc.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := split(data, atEOF)
+		if token != nil {
+			lineLen = int64(advance)
+		}
+		return advance, token, err
+	})
+	// 指定 -tail 时 tail 是保存最后 tailLines 行的环形缓冲区，kept 为放入过缓冲区的行数
+	var tail []inputLine
+	var kept int
+	for num := 1; sc.Scan(); num, offset = num+1, offset+lineLen {
+		linesRead.Add(1)
+		// 只读取 [fromLine, toLine] 范围内的行，超出范围后提前停止读取
+		if num < fromLine {
+			continue
+		}
+		if toLine > 0 && num > toLine {
+			break
+		}
+
+		line := inputLine{text: sc.Text(), file: file, num: num, offset: offset}
+		if tailLines > 0 {
+			// 只保留最后 tailLines 行，读到结尾后再发送
+			if len(tail) < tailLines {
+				tail = append(tail, line)
+			} else {
+				tail[kept%tailLines] = line
+			}
+			kept++
+			continue
+		}
+		if err := send(line); err != nil {
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	// 环形缓冲区已满时最早的一行位于 kept % tailLines 处
+	start := 0
+	if tailLines > 0 && len(tail) == tailLines {
+		start = kept % tailLines
+	}
+	for i := range tail {
+		if err := send(tail[(start+i)%len(tail)]); err != nil {
+			return err
+		}
+	}
+
+	if noLineBoundaries && doc.Len() > 0 {
+		select {
+		case ch <- inputLine{text: doc.String(), file: file, num: 1}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// readChunks 指定 -chunk-bytes 时代替逐行扫描，每次从 br 中读取 chunkBytes 个字节，不依赖输入中的换行符。
+// 每个 chunk 在最后一个分隔符处截断，之后不完整的 word 留到下一个 chunk 的开头，因此跨越 chunk 边界的 word
+// 只会被计数一次，截断处也不会落在多字节的 UTF-8 字符中间。截断后的每一段作为一个 inputLine 交给 send，
+// num 为段的序号，offset 为段在输入中的起始偏移量。一个 word 比 chunk 还长时会一直累积到遇到分隔符或输入结束。
+func readChunks(br *bufio.Reader, file int, send func(inputLine) error) error {
+	buf := make([]byte, 0, chunkBytes)
+	var offset int64
+	for num := 1; ; {
+		n, err := io.ReadFull(br, buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		eof := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !eof {
+			return err
+		}
+
+		cut := len(buf)
+		if !eof {
+			cut = lastSeparator(buf)
+		}
+		if cut < 0 {
+			// chunk 中没有分隔符，扩大缓冲区继续读取
+			buf = slices.Grow(buf, chunkBytes)
+			continue
+		}
+
+		if cut > 0 {
+			linesRead.Add(int64(bytes.Count(buf[:cut], []byte{'\n'})))
+			if err := send(inputLine{text: string(buf[:cut]), file: file, num: num, offset: offset}); err != nil {
+				return err
+			}
+			num++
+		}
+		if eof {
+			return nil
+		}
+		offset += int64(cut)
+		buf = buf[:copy(buf, buf[cut:])]
+	}
+}
+
+// lastSeparator 返回 data 中最后一个分隔符之后的位置，data 中没有分隔符时返回 -1
+func lastSeparator(data []byte) int {
+	for end := len(data); end > 0; {
+		r, size := utf8.DecodeLastRune(data[:end])
+		if isSeparator(r) {
+			return end
+		}
+		end -= size
+	}
+	return -1
+}
+
+// scanUniversalLines 是将 \n、\r\n 和单独的 \r 都作为换行符的 bufio.SplitFunc，返回的行不包括换行符
+func scanUniversalLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		// 遇到 \r 时需要看到下一个字节才能判断是否为 \r\n
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// checkBinary 检查 br 开头的数据，输入看起来是二进制数据且没有指定 -force 时返回 errBinaryInput
+func checkBinary(br *bufio.Reader) error {
+	if head, err := br.Peek(sniffLen); err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return err
+	} else if looksBinary(head) {
+		if !force {
+			return errBinaryInput
+		}
+		logger.Warn("input looks like a binary file, processing anyway")
+	}
+	return nil
+}
+
+// sniffLen 是检测输入是否为二进制数据时读取的字节数
+const sniffLen = 4096
+
+// stopInput 停止读取输入，已经读到的行仍会被正常处理，只有通过 startInput 读取输入时才有效
+var stopInput = func() {}
+
+// errTokenLimit 表示输入因为达到 -max-tokens 而停止读取
+var errTokenLimit = errors.New("token limit reached")
+
+// startInput 与 getInputStream 一样读取 paths 中的文件，但读取输入的 goroutine 使用单独的 errgroup，
+// 调用 stopInput 后它们会提前结束，而 eg 中的其他阶段不会被取消
+func startInput(ctx context.Context, eg *errgroup.Group, paths []string, limit int, rng *rand.Rand) <-chan inputLine {
+	inputCtx, stop := context.WithCancelCause(ctx)
+	ieg, inputCtx := errgroup.WithContext(inputCtx)
+	input := getInputStream(inputCtx, ieg, paths, limit, rng)
+
+	stopInput = sync.OnceFunc(func() {
+		logger.Warn("reached -max-tokens, stopping reading input", "max", maxTokens)
+		stop(errTokenLimit)
+	})
+	eg.Go(func() error {
+		defer stop(nil)
+		err := ieg.Wait()
+		if errors.Is(context.Cause(inputCtx), errTokenLimit) {
+			return nil
+		}
+		return err
+	})
+	return input
+}
+
+var (
+	errBinaryInput = errors.New("input looks like a binary file, use -force to process it anyway")
+	errInvalidUTF8 = errors.New("invalid UTF-8 sequence")
+)
+
+// looksBinary 采用与 grep 类似的启发式规则判断数据是否为二进制：
+// 包含 NUL 字节，或者不可打印的控制字符超过 30%。
+func looksBinary(data []byte) bool {
+	var ctrl int
+	for _, b := range data {
+		switch {
+		case b == 0:
+			return true
+		case b < 0x20 && b != '\t' && b != '\n' && b != '\r' && b != '\f' && b != '\b', b == 0x7f:
+			ctrl++
+		}
+	}
+	return len(data) > 0 && ctrl*10 > len(data)*3
+}
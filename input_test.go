@@ -0,0 +1,634 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// writeInputFiles 在临时目录中创建 n 个文件，每个文件有 lines 行
+func writeInputFiles(tb testing.TB, n, lines int) []string {
+	tb.Helper()
+	dir := tb.TempDir()
+	line := strings.Repeat("the quick brown fox jumps over the lazy dog ", 4) + "\n"
+	paths := make([]string, n)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("%d.txt", i))
+		if err := os.WriteFile(paths[i], []byte(strings.Repeat(line, lines)), 0o644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return paths
+}
+
+// countInputLines 读取 paths 中的所有文件，返回每个文件读到的行数
+func countInputLines(tb testing.TB, paths []string, limit int) []int {
+	tb.Helper()
+	eg, ctx := errgroup.WithContext(context.Background())
+	counts := make([]int, len(paths))
+	for line := range getInputStream(ctx, eg, paths, limit, rand.New(rand.NewSource(1))) {
+		counts[line.file]++
+	}
+	if err := eg.Wait(); err != nil {
+		tb.Fatal(err)
+	}
+	return counts
+}
+
+func TestGetInputStream(t *testing.T) {
+	paths := writeInputFiles(t, 5, 100)
+	for _, limit := range []int{1, 2, len(paths)} {
+		// 汇聚后的 channel 只有在所有文件读完后才会关闭
+		for i, n := range countInputLines(t, paths, limit) {
+			if n != 100 {
+				t.Errorf("limit %d: read %d lines from file %d, want 100", limit, n, i)
+			}
+		}
+	}
+}
+
+func BenchmarkGetInputStream(b *testing.B) {
+	paths := writeInputFiles(b, 8, 20000)
+	for _, bm := range []struct {
+		name  string
+		limit int
+	}{
+		{"sequential", 1},
+		{"parallel", runtime.GOMAXPROCS(0)},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				countInputLines(b, paths, bm.limit)
+			}
+		})
+	}
+}
+
+func TestKeepGoing(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.txt": "apple banana\n",
+		"b.txt": "apple cherry\n",
+		// 第二行不是合法的 UTF-8，指定 -strict-utf8 时在读完第一行之后失败
+		"bad.txt": "apple durian\n\xff\n",
+		// 包含 NUL 字节，在读取第一行之前就会因为是二进制文件而失败
+		"binary.dat": "apple\x00\x01\x02\n",
+	}
+	var args []string
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		args = append(args, "-f", path)
+	}
+	args = append(args, "-keep-going", "-strict-utf8")
+
+	for _, strategy := range []string{"heap", "map"} {
+		stdout, stderr, code := runMain(t, "", append(args, "-strategy", strategy)...)
+		if code != 2 {
+			t.Errorf("-strategy %s: exit status %d, want 2 (stderr %q)", strategy, code, stderr)
+		}
+		if want := "2 of 4 files could not be read\n"; !strings.Contains(stderr, want) {
+			t.Errorf("-strategy %s: stderr %q does not contain %q", strategy, stderr, want)
+		}
+		// bad.txt 在失败之前读到的 apple 和 durian 不计入结果
+		want := map[string]int{"apple": 2, "banana": 1, "cherry": 1}
+		if got := parseCounts(t, stdout); !maps.Equal(got, want) {
+			t.Errorf("-strategy %s: counts %v, want %v", strategy, got, want)
+		}
+	}
+}
+
+// TestStrictUTF8 检查 -strict-utf8 遇到不合法的 UTF-8 时以状态 1 退出并报告行号，不指定时照常统计
+func TestStrictUTF8(t *testing.T) {
+	input := "good line\nbad \xff\xfe here\nok\n"
+	_, stderr, code := runMain(t, input, "-f", "/dev/stdin", "-strict-utf8")
+	if code != 1 {
+		t.Errorf("-strict-utf8: exit status %d, want 1", code)
+	}
+	if want := "failed to process file: /dev/stdin: line 2: invalid UTF-8 sequence\n"; !strings.Contains(stderr, want) {
+		t.Errorf("-strict-utf8: stderr %q does not contain %q", stderr, want)
+	}
+
+	stdout, stderr, code := runMain(t, input, "-f", "/dev/stdin")
+	if code != 0 {
+		t.Fatalf("exit status %d, stderr %q", code, stderr)
+	}
+	if want := map[string]int{"bad": 1, "good": 1, "here": 1, "line": 1, "ok": 1}; !maps.Equal(parseCounts(t, stdout), want) {
+		t.Errorf("counts %v, want %v", parseCounts(t, stdout), want)
+	}
+}
+
+// TestListFile 检查 -f @file 读取列表文件中的每个路径，跳过空行和以 # 开头的注释行
+func TestListFile(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	for path, text := range map[string]string{a: "apple banana\n", b: "apple cherry\n"} {
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := filepath.Join(dir, "files.txt")
+	if err := os.WriteFile(list, []byte("# inputs\n"+a+"\n\n"+b+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, code := runMain(t, "", "-f", "@"+list)
+	if code != 0 {
+		t.Fatalf("exit status %d, stderr %q", code, stderr)
+	}
+	if want := map[string]int{"apple": 2, "banana": 1, "cherry": 1}; !maps.Equal(parseCounts(t, stdout), want) {
+		t.Errorf("counts %v, want %v", parseCounts(t, stdout), want)
+	}
+
+	if _, stderr, code := runMain(t, "", "-f", "@"+filepath.Join(dir, "missing.txt")); code != 1 || !strings.Contains(stderr, "failed to open file: ") {
+		t.Errorf("missing list file: exit status %d, stderr %q", code, stderr)
+	}
+}
+
+// TestSeed 检查并发读取多个文件时，相同的 -seed 使 -sample 和 -sample-words 的结果完全相同，
+// 不指定 -seed 时 -debug 输出的随机数种子可以复现同样的结果
+func TestSeed(t *testing.T) {
+	dir := t.TempDir()
+	var args []string
+	for i := 0; i < 3; i++ {
+		var text strings.Builder
+		for j := 0; j < 300; j++ {
+			fmt.Fprintf(&text, "%s %s\n", letterWord(i*300+j), letterWord(j))
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%d.txt", i))
+		if err := os.WriteFile(path, []byte(text.String()), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		args = append(args, "-f", path)
+	}
+	args = append(args, "-sample", "0.5", "-sample-words", "20", "-map-workers", "4")
+
+	first, stderr, code := runMain(t, "", append(args, "-seed", "7")...)
+	if code != 0 {
+		t.Fatalf("exit status %d, stderr %q", code, stderr)
+	}
+	if n := len(parseCounts(t, first)); n != 20 {
+		t.Fatalf("-sample-words 20 output %d words", n)
+	}
+	for i := 0; i < 3; i++ {
+		if again, _, _ := runMain(t, "", append(args, "-seed", "7")...); again != first {
+			t.Fatalf("-seed 7 gave different samples:\n%s\n%s", first, again)
+		}
+	}
+
+	unseeded, stderr, _ := runMain(t, "", append(args, "-debug")...)
+	m := regexp.MustCompile(`msg="random seed" seed=(-?\d+)`).FindStringSubmatch(stderr)
+	if m == nil {
+		t.Fatalf("-debug stderr %q does not log the random seed", stderr)
+	}
+	if again, _, _ := runMain(t, "", append(args, "-seed", m[1])...); again != unseeded {
+		t.Errorf("-seed %s did not reproduce the unseeded run:\n%s\n%s", m[1], unseeded, again)
+	}
+}
+
+// TestTail 检查 -tail N 只统计每个输入文件最后 N 行中的 word，与 -to 一起使用时为 -to 之前的最后 N 行，行号保持不变
+func TestTail(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.txt"), filepath.Join(dir, "second.txt")
+	for path, text := range map[string]string{first: "a\nb\n", second: "c\nd\ne\n"} {
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		input string
+		args  []string
+		want  string
+	}{
+		{"a b\nc d\ne f\ng\n", []string{"-tail", "2"}, "e 1\nf 1\ng 1\n"},
+		{"a b\nc d\n", []string{"-tail", "5"}, "a 1\nb 1\nc 1\nd 1\n"},
+		{"a\nb\nc\nd\ne\n", []string{"-tail", "2", "-to", "3"}, "b 1\nc 1\n"},
+		{"a\nb\nc\nb\n", []string{"-tail", "2", "-first-line"}, "b 1 4\nc 1 3\n"},
+		{"", []string{"-tail", "1", "-f", first, "-f", second}, "b 1\ne 1\n"},
+	}
+	for _, tt := range tests {
+		args := append([]string{"-sep", " ", "-pad-width", "0"}, tt.args...)
+		if tt.input != "" {
+			args = append(args, "-f", "/dev/stdin")
+		}
+		stdout, stderr, code := runMain(t, tt.input, args...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("%v: output %q, want %q", tt.args, stdout, tt.want)
+		}
+	}
+}
+
+// TestUniversalNewlines 检查 -universal-newlines 把单独的 \r、\n 和 \r\n 都作为换行，行号与混合换行方式的输入一致，
+// 跨越读取缓冲区边界的 \r\n 也只算一个换行
+func TestUniversalNewlines(t *testing.T) {
+	tests := []struct {
+		input string
+		args  []string
+		want  string
+	}{
+		{"one\rtwo\r\nthree\nfour\rfive", []string{"-universal-newlines"}, "five 1 5\nfour 1 4\none 1 1\nthree 1 3\ntwo 1 2\n"},
+		{"one\rtwo\r\nthree\nfour\rfive", nil, "five 1 3\nfour 1 3\none 1 1\nthree 1 2\ntwo 1 1\n"},
+		{"a\r\rb\n", []string{"-universal-newlines"}, "a 1 1\nb 1 3\n"},
+	}
+	for _, tt := range tests {
+		args := append([]string{"-f", "/dev/stdin", "-first-line", "-sep", " ", "-pad-width", "0"}, tt.args...)
+		stdout, stderr, code := runMain(t, tt.input, args...)
+		if code != 0 {
+			t.Fatalf("%q %v: exit status %d, stderr %q", tt.input, tt.args, code, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("%q %v: output %q, want %q", tt.input, tt.args, stdout, tt.want)
+		}
+	}
+
+	for _, n := range []int{4095, 4096, 8191} {
+		input := strings.Repeat("a", n) + "\r\nx\n"
+		stdout, _, code := runMain(t, input, "-f", "/dev/stdin", "-universal-newlines", "-first-line", "-max-len", "1", "-sep", " ", "-pad-width", "0")
+		if want := "x 1 2\n"; code != 0 || stdout != want {
+			t.Errorf("\\r\\n after %d bytes: exit status %d, output %q, want %q", n, code, stdout, want)
+		}
+	}
+}
+
+// TestSourceBreakdown 检查 -source-breakdown 在每个 word 之后按计数从大到小列出它在每个输入文件中的计数
+func TestSourceBreakdown(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	for path, text := range map[string]string{a: "word word word other\n", b: "other word solo\n"} {
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := fmt.Sprintf("other 2 (%[1]s:1, %[2]s:1)\nsolo 1 (%[2]s:1)\nword 4 (%[1]s:3, %[2]s:1)\n", a, b)
+	for _, extra := range [][]string{nil, {"-map-workers", "3"}, {"-strategy", "heap"}} {
+		args := append([]string{"-f", a, "-f", b, "-source-breakdown", "-sep", " ", "-pad-width", "0"}, extra...)
+		stdout, stderr, code := runMain(t, "", args...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", extra, code, stderr)
+		}
+		if stdout != want {
+			t.Errorf("%v: output %q, want %q", extra, stdout, want)
+		}
+	}
+}
+
+// TestDirectoryInput 检查 -f 指定目录时提示使用 -r 并以非零状态退出，指定 -r 时读取目录中的所有文件
+func TestDirectoryInput(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, text := range map[string]string{"a.txt": "apple banana\n", "sub/b.txt": "apple cherry\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stdout, stderr, code := runMain(t, "", "-f", dir)
+	if code == 0 {
+		t.Errorf("exit status 0, want an error (stdout %q)", stdout)
+	}
+	if want := dir + " is a directory; use -r to recurse"; !strings.Contains(stderr, want) {
+		t.Errorf("stderr %q does not contain %q", stderr, want)
+	}
+
+	stdout, stderr, code = runMain(t, "", "-f", dir, "-r")
+	if code != 0 {
+		t.Fatalf("-r: exit status %d, stderr %q", code, stderr)
+	}
+	if want := map[string]int{"apple": 2, "banana": 1, "cherry": 1}; !maps.Equal(parseCounts(t, stdout), want) {
+		t.Errorf("-r: counts %v, want %v", parseCounts(t, stdout), want)
+	}
+}
+
+// TestDedup 检查同一个文件通过显式路径、glob、符号链接和 -r 目录多次出现时，-dedup 只统计一次
+func TestDedup(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, text := range map[string]string{"sub/a.txt": "apple banana\n", "sub/b.txt": "apple\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, link := filepath.Join(dir, "sub", "a.txt"), filepath.Join(dir, "link.txt")
+	if err := os.Symlink(a, link); err != nil {
+		t.Skipf("symlink: %s", err)
+	}
+
+	tests := []struct {
+		args []string
+		want map[string]int
+	}{
+		{[]string{"-f", a, "-f", filepath.Join(dir, "sub", "*.txt"), "-f", link}, map[string]int{"apple": 4, "banana": 3}},
+		{[]string{"-dedup", "-f", a, "-f", filepath.Join(dir, "sub", "*.txt"), "-f", link}, map[string]int{"apple": 2, "banana": 1}},
+		{[]string{"-dedup", "-f", filepath.Join(dir, "sub", ".", "a.txt"), "-f", a}, map[string]int{"apple": 1, "banana": 1}},
+		{[]string{"-dedup", "-r", "-f", filepath.Join(dir, "sub"), "-f", link}, map[string]int{"apple": 2, "banana": 1}},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, "", tt.args...)
+		if code != 0 {
+			t.Fatalf("%q: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if got := parseCounts(t, stdout); !maps.Equal(got, tt.want) {
+			t.Errorf("%q: counts %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+// TestBinaryInput 检查包含 NUL 字节或大量控制字符的输入被拒绝，指定 -force 时仍然统计
+func TestBinaryInput(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{"", false},
+		{"plain text\twith tabs\r\n", false},
+		{"apple\x00banana\n", true},
+		// 10 个字节中有 3 个控制字符不超过 30%，4 个则超过
+		{"abcdefg\x01\x02\x03", false},
+		{"abcdef\x01\x02\x03\x7f", true},
+	}
+	for _, tt := range tests {
+		if got := looksBinary([]byte(tt.data)); got != tt.want {
+			t.Errorf("looksBinary(%q) = %t, want %t", tt.data, got, tt.want)
+		}
+	}
+
+	input := "apple\x00banana\napple\n"
+	stdout, stderr, code := runMain(t, input, "-f", "/dev/stdin")
+	if code != 1 || stdout != "" {
+		t.Errorf("exit status %d, stdout %q, want 1 and no output", code, stdout)
+	}
+	if want := "failed to process file: " + errBinaryInput.Error(); !strings.Contains(stderr, want) {
+		t.Errorf("stderr %q does not contain %q", stderr, want)
+	}
+
+	stdout, stderr, code = runMain(t, input, "-f", "/dev/stdin", "-force")
+	if code != 0 {
+		t.Fatalf("-force: exit status %d, stderr %q", code, stderr)
+	}
+	// NUL 字节不是分隔符，与其他非字母字符一样被去掉
+	if want := map[string]int{"applebanana": 1, "apple": 1}; !maps.Equal(parseCounts(t, stdout), want) {
+		t.Errorf("-force: counts %v, want %v", parseCounts(t, stdout), want)
+	}
+	if !strings.Contains(stderr, "processing anyway") {
+		t.Errorf("-force: stderr %q does not warn about the binary input", stderr)
+	}
+}
+
+// TestLineRange 检查 -from 和 -to 只统计范围内的行（包括两端），范围不合法时启动失败，读到 -to 之后不再等待剩余的输入
+func TestLineRange(t *testing.T) {
+	var text strings.Builder
+	for i := 1; i <= 10; i++ {
+		fmt.Fprintf(&text, "line %s\n", letterWord(i))
+	}
+	path := filepath.Join(t.TempDir(), "ten.txt")
+	if err := os.WriteFile(path, []byte(text.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args []string
+		want map[string]int
+	}{
+		{[]string{"-from", "3", "-to", "5"}, map[string]int{"line": 3, "d": 1, "e": 1, "f": 1}},
+		{[]string{"-from", "9"}, map[string]int{"line": 2, "j": 1, "k": 1}},
+		{[]string{"-to", "2"}, map[string]int{"line": 2, "b": 1, "c": 1}},
+		{[]string{"-from", "4", "-to", "4"}, map[string]int{"line": 1, "e": 1}},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, "", append([]string{"-f", path}, tt.args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if got := parseCounts(t, stdout); !maps.Equal(got, tt.want) {
+			t.Errorf("%v: counts %v, want %v", tt.args, got, tt.want)
+		}
+	}
+
+	if _, stderr, code := runMain(t, "", "-f", path, "-from", "6", "-to", "5"); code != 1 || !strings.Contains(stderr, "-from 6 is greater than -to 5") {
+		t.Errorf("-from 6 -to 5: exit status %d, stderr %q, want 1 and the invalid range", code, stderr)
+	}
+
+	// 输入一直没有结束，读到第 2 行之后就输出结果并退出；检测二进制输入需要先读到 sniffLen 字节
+	cmd := mainCommand("-f", "/dev/stdin", "-to", "2")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	var stdout strings.Builder
+	cmd.Stdout = &stdout
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(stdin, "alpha\nbeta\n"+strings.Repeat("gamma\n", sniffLen)); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("-to 2: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		_ = cmd.Process.Kill()
+		t.Fatal("-to 2 did not stop reading after line 2")
+	}
+	if want := map[string]int{"alpha": 1, "beta": 1}; !maps.Equal(parseCounts(t, stdout.String()), want) {
+		t.Errorf("-to 2 on an open input: counts %v, want %v", parseCounts(t, stdout.String()), want)
+	}
+}
+
+// TestSample 检查 -sample 按照 rng 的 Float64 以概率 P 保留每一行，相同的 -seed 得到相同的样本
+func TestSample(t *testing.T) {
+	restoreFlags(t)
+	sampleRate = 0.5
+	var text strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&text, "%s\n", letterWord(i))
+	}
+
+	// 种子为 1 时被保留的行
+	r := rand.New(rand.NewSource(1))
+	var want []int
+	for num := 1; num <= 200; num++ {
+		if r.Float64() < sampleRate {
+			want = append(want, num)
+		}
+	}
+	lines := make(chan inputLine, 200)
+	if err := readLines(context.Background(), strings.NewReader(text.String()), 0, lines, rand.New(rand.NewSource(1))); err != nil {
+		t.Fatal(err)
+	}
+	close(lines)
+	var got []int
+	for l := range lines {
+		if l.text != letterWord(l.num-1) {
+			t.Errorf("line %d is %q, want %q", l.num, l.text, letterWord(l.num-1))
+		}
+		got = append(got, l.num)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("sampled lines %v, want %v", got, want)
+	}
+	if len(got) < 70 || len(got) > 130 {
+		t.Errorf("kept %d of 200 lines with -sample 0.5", len(got))
+	}
+
+	// 通过命令行运行时相同的 -seed 得到相同的结果，不同的 -seed 通常不同
+	first, _, _ := runMain(t, text.String(), "-f", "/dev/stdin", "-sample", "0.5", "-seed", "1")
+	again, _, _ := runMain(t, text.String(), "-f", "/dev/stdin", "-sample", "0.5", "-seed", "1")
+	other, _, _ := runMain(t, text.String(), "-f", "/dev/stdin", "-sample", "0.5", "-seed", "2")
+	if first != again {
+		t.Errorf("-seed 1 gave different samples:\n%s\n%s", first, again)
+	}
+	if first == other {
+		t.Errorf("-seed 1 and -seed 2 gave the same sample")
+	}
+	if _, stderr, code := runMain(t, text.String(), "-f", "/dev/stdin", "-sample", "0"); code != 1 || !strings.Contains(stderr, "-sample must be in (0, 1]") {
+		t.Errorf("-sample 0: exit status %d, stderr %q, want 1 and the valid range", code, stderr)
+	}
+}
+
+// TestCommon 检查 -common 只保留出现在每个成功读取的文件中的 word，指定 -keep-going 时读取失败的文件不计入
+func TestCommon(t *testing.T) {
+	dir := t.TempDir()
+	var args []string
+	for i, text := range []string{"apple banana cherry\n", "apple banana\n", "apple cherry\n", "apple banana\x00\n"} {
+		path := filepath.Join(dir, fmt.Sprintf("%d.txt", i))
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		args = append(args, "-f", path)
+	}
+
+	// banana 和 cherry 只出现在三个文件中的两个里
+	stdout, stderr, code := runMain(t, "", append(slices.Clone(args[:6]), "-common")...)
+	if want := map[string]int{"apple": 3}; code != 0 || !maps.Equal(parseCounts(t, stdout), want) {
+		t.Errorf("exit status %d, counts %v, want %v (stderr %q)", code, parseCounts(t, stdout), want, stderr)
+	}
+
+	// 第四个文件是二进制文件，读取失败后 apple 仍然出现在所有成功读取的文件中
+	for _, strategy := range []string{"heap", "map"} {
+		stdout, stderr, code := runMain(t, "", append(args, "-common", "-keep-going", "-strategy", strategy)...)
+		if want := map[string]int{"apple": 3}; code != 2 || !maps.Equal(parseCounts(t, stdout), want) {
+			t.Errorf("-strategy %s: exit status %d, counts %v, want status 2 and %v (stderr %q)", strategy, code, parseCounts(t, stdout), want, stderr)
+		}
+	}
+}
+
+// TestUniqueTo 检查 -unique-to 只输出出现在指定文件而不出现在其他输入文件中的 word 及其计数，指定的文件不在输入中时报错
+func TestUniqueTo(t *testing.T) {
+	dir := t.TempDir()
+	var paths, args []string
+	for i, text := range []string{"alpha beta beta only only\n", "beta gamma\n", "alpha delta\n"} {
+		path := filepath.Join(dir, fmt.Sprintf("%d.txt", i))
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+		args = append(args, "-f", path)
+	}
+
+	tests := []struct {
+		args []string
+		want map[string]int
+	}{
+		// alpha 和 beta 也出现在其他文件中
+		{append(slices.Clone(args), "-unique-to", paths[0]), map[string]int{"only": 2}},
+		{append(slices.Clone(args), "-unique-to", paths[1], "-strategy", "heap"), map[string]int{"gamma": 1}},
+		{append(slices.Clone(args[:4]), "-unique-to", paths[0]), map[string]int{"alpha": 1, "only": 2}},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, "", tt.args...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if got := parseCounts(t, stdout); !maps.Equal(got, tt.want) {
+			t.Errorf("%v: counts %v, want %v", tt.args, got, tt.want)
+		}
+	}
+
+	missing := filepath.Join(dir, "missing.txt")
+	if _, stderr, code := runMain(t, "", append(slices.Clone(args), "-unique-to", missing)...); code != 1 || !strings.Contains(stderr, missing+" is not one of the input files") {
+		t.Errorf("-unique-to a file that is not an input: exit status %d, stderr %q", code, stderr)
+	}
+}
+
+// TestReadChunks 检查 -chunk-bytes 读取没有换行符的输入时只在分隔符处截断：跨越 chunk 边界的 word 只计数一次，
+// 多字节的 UTF-8 字符和比 chunk 还长的 word 不会被拆开
+func TestReadChunks(t *testing.T) {
+	restoreFlags(t)
+	text := "alpha beta gamma café extraordinarily delta alpha"
+	want := map[string]int{"alpha": 2, "beta": 1, "gamma": 1, "caf": 1, "extraordinarily": 1, "delta": 1}
+	for _, size := range []int{1, 3, 4, 7, 16, len(text) + 1} {
+		chunkBytes = size
+		var segments []string
+		got := make(map[string]int)
+		err := readChunks(bufio.NewReader(strings.NewReader(text)), 0, func(line inputLine) error {
+			segments = append(segments, line.text)
+			for _, wc := range mapFn(line.text) {
+				got[wc.word] += wc.count
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if joined := strings.Join(segments, ""); joined != text {
+			t.Errorf("-chunk-bytes %d: segments %q do not add up to the input", size, segments)
+		}
+		if !maps.Equal(got, want) {
+			t.Errorf("-chunk-bytes %d: counts %v from segments %q, want %v", size, got, segments, want)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(path, []byte(strings.Repeat(text+" ", 100)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wantOut, _, _ := runMain(t, "", "-f", path)
+	if stdout, stderr, code := runMain(t, "", "-f", path, "-chunk-bytes", "5"); code != 0 || stdout != wantOut {
+		t.Errorf("-chunk-bytes 5: exit status %d, output %q, want %q (stderr %q)", code, stdout, wantOut, stderr)
+	}
+}
+
+// TestNoLineBoundaries 检查指定 -no-line-boundaries 时 -token-regex 匹配的两个单词可以跨越换行，不指定时不会
+func TestNoLineBoundaries(t *testing.T) {
+	text := "the quick brown\nfox jumps\n"
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "fox jumps         1\nthe quick         1\n"},
+		{[]string{"-no-line-boundaries"}, "brown fox         1\nthe quick         1\n"},
+	}
+	for _, tt := range tests {
+		args := append([]string{"-f", "/dev/stdin", "-token-regex", "[a-z]+ [a-z]+"}, tt.args...)
+		if stdout, stderr, code := runMain(t, text, args...); code != 0 || stdout != tt.want {
+			t.Errorf("%v: exit status %d, output %q, want %q (stderr %q)", tt.args, code, stdout, tt.want, stderr)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+//go:build unix
+
+package main
+
+import (
+	"bufio"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestFIFOInputs 检查多个 FIFO（如 -f <(cmd1) -f <(cmd2)）与普通文件一样被读取和合并，不会因为获取文件大小而失败。
+// 写入的数据超过管道的缓冲区，读取端需要在写入端写入的同时阻塞等待数据
+func TestFIFOInputs(t *testing.T) {
+	dir := t.TempDir()
+	texts := []string{strings.Repeat("apple banana\n", 10000), strings.Repeat("apple cherry\n", 10000)}
+	var paths []string
+	for i := range texts {
+		path := filepath.Join(dir, "fifo"+string(rune('a'+i)))
+		if err := syscall.Mkfifo(path, 0o600); err != nil {
+			t.Skipf("mkfifo: %s", err)
+		}
+		paths = append(paths, path)
+	}
+
+	for _, extra := range [][]string{nil, {"-dedup"}} {
+		done := make(chan error, len(paths))
+		for i, path := range paths {
+			go func(path, text string) {
+				f, err := os.OpenFile(path, os.O_WRONLY, 0)
+				if err != nil {
+					done <- err
+					return
+				}
+				_, err = f.WriteString(text)
+				if closeErr := f.Close(); err == nil {
+					err = closeErr
+				}
+				done <- err
+			}(path, texts[i])
+		}
+
+		args := append([]string{"-f", paths[0], "-f", paths[1]}, extra...)
+		stdout, stderr, code := runMain(t, "", args...)
+		if code != 0 {
+			// 读取端没有打开时写入端会一直阻塞，以读写方式打开 FIFO 使它们返回
+			for _, path := range paths {
+				if f, err := os.OpenFile(path, os.O_RDWR, 0); err == nil {
+					defer f.Close()
+				}
+			}
+			t.Fatalf("%q: exit status %d: %s", args, code, stderr)
+		}
+		for range paths {
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+		}
+		if want := map[string]int{"apple": 20000, "banana": 10000, "cherry": 10000}; !maps.Equal(parseCounts(t, stdout), want) {
+			t.Errorf("%q: counts %v, want %v", args, parseCounts(t, stdout), want)
+		}
+	}
+}
+
+// TestFIFOCancel 检查 FIFO 一直没有写入端时，-timeout 到期或收到 SIGINT 后阻塞在打开 FIFO 上的进程以状态 1 退出
+func TestFIFOCancel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fifo")
+	if err := syscall.Mkfifo(path, 0o600); err != nil {
+		t.Skipf("mkfifo: %s", err)
+	}
+
+	for _, sigint := range []bool{false, true} {
+		args := []string{"-f", path, "-debug", "-timeout", "100ms"}
+		if sigint {
+			args = []string{"-f", path, "-debug"}
+		}
+		cmd := mainCommand(args...)
+		stderr, err := cmd.StderrPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		sc := bufio.NewScanner(stderr)
+		// 输出随机数种子之后紧接着注册信号处理，稍等片刻再发送信号
+		for sc.Scan() && !strings.Contains(sc.Text(), "random seed") {
+		}
+		if sigint {
+			time.Sleep(100 * time.Millisecond)
+			if err := cmd.Process.Signal(syscall.SIGINT); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		lines := make(chan []string, 1)
+		go func() {
+			var ls []string
+			for sc.Scan() {
+				ls = append(ls, sc.Text())
+			}
+			lines <- ls
+		}()
+		var rest []string
+		select {
+		case rest = <-lines:
+		case <-time.After(5 * time.Second):
+			_ = cmd.Process.Kill()
+			t.Fatalf("%q: process blocked opening a FIFO without a writer", args)
+		}
+		_ = cmd.Wait()
+		if code := cmd.ProcessState.ExitCode(); code != 1 {
+			t.Errorf("%q: exit status %d, want 1", args, code)
+		}
+		want := "failed to process file: context deadline exceeded"
+		if sigint {
+			want = "failed to process file: context canceled"
+		}
+		if !slices.Contains(rest, want) {
+			t.Errorf("%q: stderr %q does not contain %q", args, rest, want)
+		}
+	}
+}
@@ -1,21 +1,138 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"crypto/sha256"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
+	"hash"
 	"log/slog"
+	"math/rand"
 	"os"
 	"os/signal"
 	"runtime"
+	"slices"
+	"strings"
 	"syscall"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 )
 
-var inputFile string
+var (
+	inputFiles       stringList
+	configFile       string
+	timeout          time.Duration
+	force            bool
+	firstLine        bool
+	fromLine         int
+	toLine           int
+	sampleRate       float64
+	seed             int64
+	sampleSize       int
+	dictFile         string
+	onlyUnknown      bool
+	stemWords        bool
+	format           string
+	htmlStandalone   bool
+	wordCloudScale   string
+	padWidth         int
+	separator        string
+	uniqueCount      bool
+	sortOrder        string
+	topN             int
+	recursive        bool
+	preserveCase     bool
+	redactFile       string
+	reverse          bool
+	flushInterval    time.Duration
+	strategy         string
+	perLineUnique    bool
+	dedup            bool
+	keepGoing        bool
+	top1             bool
+	strictUTF8       bool
+	onlyFile         string
+	mapWorkers       int
+	timing           bool
+	checksum         bool
+	repl             bool
+	tieBreak         string
+	groupByInitial   bool
+	palindromes      bool
+	bytesPerWord     bool
+	acronyms         bool
+	freqSpectrum     bool
+	truncateLen      int
+	minLen           int
+	maxLen           int
+	vocab            bool
+	outputFile       string
+	jsonOutFile      string
+	weightsFile      string
+	tokenPattern     string
+	includePattern   string
+	excludePattern   string
+	positions        bool
+	dryRun           bool
+	mergeInFile      string
+	saveStateFile    string
+	inQuotes         bool
+	singleQuotes     bool
+	maxStreak        bool
+	maxDistinct      int
+	normalizePunct   bool
+	serveAddr        string
+	grpcAddr         string
+	keepPunct        bool
+	growthEvery      int
+	dropPossessive   bool
+	localAggregate   bool
+	scriptName       string
+	scriptThreshold  float64
+	entropy          bool
+	showVersion      bool
+	lruCap           int
+	maxMemory        int
+	excludeWords     stringList
+	dumpTokensFile   string
+	tailLines        int
+	freqTable        bool
+	universalEOL     bool
+	foldSpace        bool
+	commonWords      bool
+	uniqueTo         string
+	maxTokens        int64
+	sortKeys         string
+	caseBreakdown    bool
+	showForms        bool
+	maxRows          int
+	foldConfusable   bool
+	stopwordRatio    bool
+	stopwordsFile    string
+	zOut             bool
+	fastTokenize     bool
+	stageStats       bool
+	foldMapFile      string
+	sourceBreakdown  bool
+	streamSorted     bool
+	charDigrams      bool
+	logBins          bool
+	chunkBytes       int
+	graphemeLength   bool
+	metricsJSON      bool
+	foldCasePattern  string
+	dataHeader       bool
+	reduceCmd        string
+	rankCorr         bool
+	noLineBoundaries bool
+	reportMemory     bool
+	rawWords         bool
+	bucketPattern    string
+	bucketOnly       bool
+	explainFor       string
+)
 
 var (
 	logger *slog.Logger
@@ -23,50 +140,847 @@ var (
 )
 
 func init() {
-	flag.StringVar(&inputFile, "f", "", "specify the input file")
+	flag.Var(&inputFiles, "f", "specify the input `file` or glob pattern (@list reads paths from the file list), can be repeated to count several files")
+	flag.BoolVar(&recursive, "r", false, "count all files under input directories recursively")
+	flag.BoolVar(&dedup, "dedup", false, "count each input file only once even if several paths or patterns resolve to it")
 	flag.BoolVar(&debug, "debug", false, "enable debug mode")
-	flag.Parse()
+	flag.DurationVar(&timeout, "timeout", 0, "cancel processing after the given `duration` (e.g. 30s), 0 means no timeout")
+	flag.BoolVar(&force, "force", false, "process the input even if it looks like a binary file")
+	flag.BoolVar(&firstLine, "first-line", false, "show the line number of each word's first occurrence")
+	flag.BoolVar(&positions, "positions", false, "show the byte offset of each word's first occurrence")
+	flag.IntVar(&fromLine, "from", 1, "only count words from `line` L1 onwards")
+	flag.IntVar(&toLine, "to", 0, "only count words up to `line` L2 (inclusive), 0 means the end of the input")
+	flag.BoolVar(&rankCorr, "rank-corr", false, "compare the two input files: output the Spearman rank correlation of the counts of the words they share and the number of shared words")
+	flag.BoolVar(&sourceBreakdown, "source-breakdown", false, "show how many times each word occurred in every input file, e.g. (a.txt:40, b.txt:10)")
+	flag.BoolVar(&commonWords, "common", false, "only output words that appear in every input file, with their combined count")
+	flag.StringVar(&uniqueTo, "unique-to", "", "only output words that appear in input `file` and in no other input file")
+	flag.StringVar(&foldMapFile, "fold-map", "", "apply the substitutions in `file` (from<TAB>to per line, e.g. ß to ss) to the input before tokenizing")
+	flag.BoolVar(&foldConfusable, "fold-confusables", false, "map Cyrillic, Greek and fullwidth letters that look like ASCII letters to those letters before tokenizing")
+	flag.BoolVar(&foldSpace, "fold-space", false, "also split words at zero-width spaces (U+200B, U+2060, U+FEFF); non-breaking spaces always split words")
+	flag.BoolVar(&universalEOL, "universal-newlines", false, "treat a lone \\r as a line break as well as \\n and \\r\\n (old Mac OS line endings)")
+	flag.Int64Var(&maxTokens, "max-tokens", 0, "stop reading input after `N` tokens and output the counts so far, 0 means no limit")
+	flag.IntVar(&tailLines, "tail", 0, "only count words in the last `N` lines of each input file (within -from/-to)")
+	flag.Float64Var(&sampleRate, "sample", 1, "randomly keep each line with probability `P` (0 < P <= 1)")
+	flag.Int64Var(&seed, "seed", 0, "`seed` of the random number generator used by sampling, 0 means a time-based seed")
+	flag.IntVar(&sampleSize, "sample-words", 0, "output `K` distinct words chosen uniformly at random")
+	flag.StringVar(&dictFile, "dict", "", "mark words not found in the dictionary `file` (one word per line)")
+	flag.BoolVar(&onlyUnknown, "only-unknown", false, "with -dict, only output words not found in the dictionary")
+	flag.BoolVar(&stemWords, "stem", false, "count words by their English stem (Porter2 algorithm)")
+	flag.StringVar(&format, "format", "text", "output `format`: text, md (Markdown table), html (HTML table), wordcloud (JSON for word cloud libraries), protobuf (length-delimited messages), msgpack, json, ndjson, json-summary (JSON object with metadata and counts), nul (word and count terminated by NUL bytes) or data (rank and count columns for plotting)")
+	flag.BoolVar(&zOut, "z-out", false, "gzip-compress the output (implied when the -o file name ends in .gz)")
+	flag.StringVar(&outputFile, "o", "", "write the results to `file` instead of stdout")
+	flag.StringVar(&jsonOutFile, "json-out", "", "additionally write the results as JSON to `file`")
+	flag.DurationVar(&flushInterval, "flush-interval", 0, "flush streaming output (ndjson) every `duration` instead of after each record")
+	flag.BoolVar(&htmlStandalone, "html-standalone", false, "with -format html, output a complete HTML document")
+	flag.StringVar(&wordCloudScale, "wordcloud-scale", "linear", "`scale` of the word weights with -format wordcloud: linear or log")
+	flag.IntVar(&padWidth, "pad-width", 15, "`width` of the word column in text output, 0 disables padding")
+	flag.StringVar(&separator, "sep", "", "`separator` between columns in text output")
+	flag.BoolVar(&uniqueCount, "unique-count", false, "only print the number of distinct words")
+	flag.StringVar(&sortOrder, "sort", "word", "sort `order` of the output: word, count or length")
+	flag.StringVar(&sortKeys, "sort-keys", "", "sort the output by a comma-separated list of `keys` (word, count, length, first-seen) with optional :asc or :desc, e.g. count:asc,length:desc; overrides -sort")
+	flag.BoolVar(&reverse, "reverse", false, "reverse the sort order")
+	flag.StringVar(&tieBreak, "tiebreak", "alpha", "`order` of words with equal counts when sorting by count: alpha, length or first-seen")
+	flag.IntVar(&topN, "n", 0, "only output the first `N` words in sort order, 0 means all")
+	flag.IntVar(&maxRows, "max-rows", 0, "only print the first `N` rows of text output followed by a line with the number of words omitted, 0 means all")
+	flag.IntVar(&maxDistinct, "max-distinct", 0, "fail if the output would contain more than `N` distinct words (without -n), 0 means no limit")
+	flag.BoolVar(&showForms, "show-forms", false, "with -stem or -bucket-regex, list the words that were counted under each stem or bucket with their counts")
+	flag.StringVar(&bucketPattern, "bucket-regex", "", "count the words matching `regex` under the text of its first capture group, e.g. ^(error)-\\d+ to count error-123 and error-456 as error; the pattern is matched against the lowercased whitespace-separated field before non-letters are stripped")
+	flag.BoolVar(&bucketOnly, "bucket-only", false, "with -bucket-regex, drop the words that do not match instead of counting them as they are")
+	flag.BoolVar(&caseBreakdown, "case-breakdown", false, "display each word in its most common original casing followed by the count of every casing, e.g. (the:80, The:18, THE:2)")
+	flag.BoolVar(&preserveCase, "preserve-case", false, "display each word in its most common original casing")
+	flag.Var(&excludeWords, "exclude-word", "do not output `words` (comma-separated, can be repeated)")
+	flag.StringVar(&redactFile, "redact", "", "replace words listed in `file` with asterisks in the output")
+	flag.StringVar(&strategy, "strategy", "auto", "aggregation `strategy`: heap (sort then reduce), map (hash map aggregation), merge (aggregate each file separately and merge the per-file counts by word) or auto (map, switching to spilling partial counts to temporary files when -max-memory is set and may be exceeded)")
+	flag.BoolVar(&streamSorted, "stream-sorted", false, "with -strategy map (or auto), output the aggregated words in order by sorting only the words instead of a copy of all results")
+	flag.IntVar(&maxMemory, "max-memory", 0, "with -strategy auto, bound the memory of the aggregation to about `MiB` mebibytes by writing sorted partial counts to temporary files and merging them at the end, 0 means no limit")
+	flag.IntVar(&lruCap, "lru-cap", 0, "with -strategy map (or auto), keep at most `N` distinct words by evicting the least frequent ones (approximate counts), 0 means no limit")
+	flag.BoolVar(&perLineUnique, "per-line-unique", false, "count each word at most once per line (number of lines containing the word)")
+	flag.BoolVar(&keepGoing, "keep-going", false, "skip input files that fail to read instead of aborting (exit status 2); the words already read from a file that fails are not counted, which needs the count of every word in each file")
+	flag.BoolVar(&top1, "top1", false, "only output the most frequent word (shorthand for -strategy map -sort count -n 1)")
+	flag.BoolVar(&strictUTF8, "strict-utf8", false, "fail on lines that are not valid UTF-8 instead of counting mangled words")
+	flag.StringVar(&onlyFile, "only", "", "only report the words listed in `file`, including those that never appear")
+	flag.IntVar(&mapWorkers, "map-workers", 1, "`number` of concurrent mapper goroutines")
+	flag.BoolVar(&noLineBoundaries, "no-line-boundaries", false, "join all lines of each input file with spaces and process the file as a single line, so per-line options and -token-regex matches span line breaks; each file is held in memory until it has been read completely")
+	flag.IntVar(&chunkBytes, "chunk-bytes", 0, "read the input in chunks of this many bytes instead of by line, for input without line breaks (0 to read lines)")
+	flag.BoolVar(&fastTokenize, "fast-tokenize", false, "split tokens directly from the input bytes and aggregate them per file, skipping line-based processing (only supports word-level options)")
+	flag.BoolVar(&localAggregate, "local-aggregate", false, "let each mapper worker aggregate its counts locally and merge the partial counts at the end")
+	flag.StringVar(&dumpTokensFile, "dump-tokens", "", "write every token produced by the mappers to `file`, one per line, for debugging the tokenizer")
+	flag.StringVar(&reduceCmd, "reduce-cmd", "", "pipe the tokens sorted by word (word<TAB>count lines) to the standard input of `command` and write its standard output as the result instead of counting them")
+	flag.BoolVar(&dataHeader, "data-header", false, "with -format data, start the output with a \"# rank count\" comment line")
+	flag.StringVar(&explainFor, "explain", "", "trace `word` through the pipeline: print every token counted as word with its position and the transformations applied, and its final count, to stderr")
+	flag.BoolVar(&reportMemory, "report-memory", false, "print the peak heap size, the total memory allocated and the memory obtained from the OS to stderr at the end")
+	flag.BoolVar(&metricsJSON, "metrics-json", false, "after processing, print a one-line JSON object with the number of tokens, distinct words, lines and bytes, the duration and the strategy used to stderr")
+	flag.BoolVar(&stageStats, "stage-metrics", false, "print the number of items each pipeline stage passed on and the time spent waiting for it or for its consumer to stderr")
+	flag.BoolVar(&timing, "timing", false, "print the number of processed lines, bytes and tokens and the elapsed time to stderr")
+	flag.BoolVar(&checksum, "checksum", false, "print the SHA-256 of the results (as word<TAB>count lines) to stderr")
+	flag.BoolVar(&repl, "repl", false, "after counting the input, query the counts interactively with commands read from stdin")
+	flag.BoolVar(&groupByInitial, "group-by-initial", false, "insert a header line before each new initial letter in text output")
+	flag.BoolVar(&palindromes, "palindromes", false, "only output words that read the same forwards and backwards")
+	flag.BoolVar(&bytesPerWord, "bytes-per-word", false, "add a column with the size of each word in bytes")
+	flag.BoolVar(&inQuotes, "in-quotes", false, "only count words inside double quotation marks (quotes may span lines)")
+	flag.BoolVar(&singleQuotes, "single-quotes", false, "with -in-quotes, also treat single quotation marks as quotes")
+	flag.BoolVar(&keepPunct, "keep-punct", false, "count runs of punctuation as words of their own instead of stripping them")
+	flag.BoolVar(&dropPossessive, "strip-possessive", false, "remove a trailing possessive 's from words (\"dog's\" is counted as \"dog\")")
+	flag.BoolVar(&normalizePunct, "normalize-punct", false, "replace smart quotes, dashes and ellipses with their ASCII equivalents before tokenizing")
+	flag.BoolVar(&acronyms, "acronyms", false, "only count all-caps tokens of at least two letters (e.g. NASA, HTTP)")
+	flag.BoolVar(&maxStreak, "max-streak", false, "report the longest run of consecutive occurrences of each word instead of its count")
+	flag.BoolVar(&entropy, "entropy", false, "output the Shannon entropy (in bits) of the word distribution and its normalized value")
+	flag.IntVar(&growthEvery, "growth-curve", 0, "output the number of distinct words seen after every `K` tokens (tokens<TAB>distinct)")
+	flag.BoolVar(&freqSpectrum, "freq-spectrum", false, "output how many distinct words occur exactly once, twice, etc.")
+	flag.BoolVar(&graphemeLength, "grapheme-length", false, "measure word length (-min-len, -max-len, -sort length, -truncate-len, redaction) in grapheme clusters instead of characters, so combining marks and emoji sequences count as one")
+	flag.IntVar(&minLen, "min-len", 0, "only count words of at least `N` characters (grapheme clusters with -grapheme-length), 0 means no limit")
+	flag.IntVar(&maxLen, "max-len", 0, "only count words of at most `N` characters (grapheme clusters with -grapheme-length), 0 means no limit")
+	flag.IntVar(&truncateLen, "truncate-len", 0, "truncate words longer than `N` characters to their first N characters before counting")
+	flag.BoolVar(&stopwordRatio, "stopword-ratio", false, "output the number of stopword and content word tokens and the fraction of stopwords")
+	flag.StringVar(&stopwordsFile, "stopwords", "", "stopword list `file` used by -stopword-ratio (one word per line), defaults to a built-in English list")
+	flag.BoolVar(&charDigrams, "char-digrams", false, "count pairs of adjacent letters within words (e.g. th, he) instead of words, sorted by count")
+	flag.BoolVar(&logBins, "log-bins", false, "output how many distinct words have a count of 1, 2-9, 10-99, 100-999, etc.")
+	flag.BoolVar(&freqTable, "freq-table", false, "output an aligned table of rank, word, count and relative frequency, sorted by count")
+	flag.BoolVar(&vocab, "vocab", false, "only output the sorted list of distinct words")
+	flag.StringVar(&mergeInFile, "merge-in", "", "add the counts saved in `file` (text or JSON output of a previous run) to the results")
+	flag.StringVar(&saveStateFile, "save-state", "", "write the complete counts as word<TAB>count lines to `file` for a later -merge-in")
+	flag.StringVar(&weightsFile, "weights", "", "scale the counts of words listed in `file` (\"word weight\" per line)")
+	flag.BoolVar(&rawWords, "raw-words", false, "split lines only at whitespace and keep every word as it is, including punctuation and digits (e.g. c++, node.js); words are still lowercased")
+	flag.StringVar(&foldCasePattern, "fold-case-matching", "", "only lowercase the words matching `regex` (matched against the word as it appears), keeping the case of all others, e.g. [a-z] to keep all-caps acronyms")
+	flag.StringVar(&tokenPattern, "token-regex", "", "split lines into the substrings matching `regex` instead of whitespace-separated words")
+	flag.StringVar(&includePattern, "include-regex", "", "only count words matching `regex`")
+	flag.StringVar(&excludePattern, "exclude-regex", "", "do not count words matching `regex`")
+	flag.StringVar(&serveAddr, "serve", "", "serve counting requests over HTTP on `address` (e.g. :8080) instead of reading input files")
+	flag.StringVar(&grpcAddr, "grpc", "", "serve the WordCounter gRPC service (see wordcount/wordcount.proto) on `address` (e.g. :9090)")
+	flag.StringVar(&scriptName, "script", "", "only count words written predominantly in the Unicode `script` (e.g. latin, greek, cyrillic); the default tokenizer then keeps the letters of all scripts")
+	flag.Float64Var(&scriptThreshold, "script-threshold", 0.5, "with -script, minimum `fraction` of a word's letters that must belong to the script")
+	flag.BoolVar(&showVersion, "version", false, "print the version and build information and exit")
+	flag.StringVar(&configFile, "config", "", "load default options from a TOML/YAML `file`")
+	flag.BoolVar(&dryRun, "dry-run", false, "validate the options and print the effective configuration without reading the input")
 }
 
 func main() {
-	if inputFile == "" {
+	flag.Parse()
+	if showVersion {
+		_ = writeVersion(os.Stdout)
+		return
+	}
+
+	// 优先级：命令行 flag > 环境变量 > 配置文件 > 默认值
+	explicit := explicitFlags()
+	if configFile != "" {
+		if err := loadConfigFile(configFile, explicit); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to load config: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	if err := applyEnv(explicit); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to load environment: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if len(inputFiles) == 0 && serveAddr == "" && grpcAddr == "" {
 		flag.Usage()
 		return
 	}
 
+	if top1 {
+		strategy, sortOrder, topN = "map", "count", 1
+	}
+	if (charDigrams || format == "data") && !explicitFlags()["sort"] {
+		// 字符对和 -format data 默认按照计数从大到小排列，命令行、配置文件或环境变量指定了 -sort 时除外
+		sortOrder = "count"
+	}
+	if freqTable {
+		// 频率表总是按照计数从大到小排列
+		sortOrder, reverse = "count", false
+	}
+	if vocab {
+		// 词表总是按照字典序输出
+		sortOrder, reverse = "word", false
+	}
+
+	if err := validateFlags(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "invalid options: %s\n", err.Error())
+		os.Exit(1)
+	}
+
 	logger = slog.New(slog.NewTextHandler(os.Stderr, getLoggerOptions()))
+	tieBreaker = tieBreaks[tieBreak]
 
-	f, err := os.Open(inputFile)
+	// 替换规则需要在加载其他词表之前读取，以保证词表与输入的规范化方式一致
+	if foldMapFile != "" {
+		var err error
+		if foldReplacer, err = loadFoldMap(foldMapFile); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to load fold map: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	if explainFor != "" {
+		explainWord = explainKey(explainFor)
+	}
+	if dictFile != "" {
+		var err error
+		if dict, err = loadWordSet(dictFile); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to load dictionary: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	if onlyFile != "" {
+		var err error
+		if targets, err = loadWordSet(onlyFile); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to load target words: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	if weightsFile != "" {
+		var err error
+		if weights, err = loadWeights(weightsFile); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to load weights: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	if len(excludeWords) > 0 {
+		excludedWords = wordSetFromList(excludeWords)
+	}
+	if redactFile != "" {
+		var err error
+		if redactSet, err = loadWordSet(redactFile); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to load redaction list: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if stopwordsFile != "" {
+		var err error
+		if stopwords, err = loadWordSet(stopwordsFile); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to load stopwords: %s\n", err.Error())
+			os.Exit(1)
+		}
+	} else if stopwordRatio {
+		stopwords = wordSetFromList(defaultStopwords)
+	}
+
+	var prior []wordCount
+	if mergeInFile != "" {
+		var err error
+		if prior, err = loadCounts(mergeInFile); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to load saved counts: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	files, err := resolveInputs(inputFiles)
 	if err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "failed to open file: %s\n", err.Error())
 		os.Exit(1)
 	}
-	defer f.Close()
+	if strategy == "auto" {
+		strategy = chooseStrategy(files)
+	}
+
+	if dryRun {
+		if err := writeEffectiveConfig(os.Stdout, files); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to write config: %s\n", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	start := time.Now()
+	var uniqueIndex int
+	if uniqueTo != "" {
+		if uniqueIndex, err = fileIndex(files, uniqueTo); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "invalid options: -unique-to: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	if rankCorr && len(files) != 2 {
+		_, _ = fmt.Fprintf(os.Stderr, "invalid options: -rank-corr needs exactly two input files, got %d\n", len(files))
+		os.Exit(1)
+	}
+	run := globalRunStats(files, start)
+	sourceNames = files
+
+	// 所有随机化的处理都使用从同一个种子派生的随机数生成器，指定 -seed 时结果可以复现
+	if seed == 0 {
+		seed = start.UnixNano()
+	}
+	logger.Debug("random seed", "seed", seed)
+	rng := rand.New(rand.NewSource(seed))
 
 	// 监听系统信号，当收到 SIGTERM 或 SIGINT 信号时，取消程序执行
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer stop()
 
+	if serveAddr != "" || grpcAddr != "" {
+		serveFn, addr := serve, serveAddr
+		if grpcAddr != "" {
+			serveFn, addr = serveGRPC, grpcAddr
+		}
+		if err := serveFn(ctx, addr); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to serve: %s\n", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 收到 SIGUSR1 信号时输出当前的处理进度
+	notifyProgress(ctx, start)
+
+	// 设置了超时时间时，超时与收到信号一样会取消程序执行
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if reportMemory {
+		done := make(chan struct{})
+		defer close(done)
+		go sampleMemory(done)
+	}
+
+	// cancelled 在收到信号或超时后返回 true，errgroup 中的阶段出错导致的取消不计算在内
+	runCtx := ctx
+	cancelled := func() bool { return runCtx.Err() != nil }
 	eg, ctx := errgroup.WithContext(ctx)
-	eg.SetLimit(runtime.GOMAXPROCS(0)) // 设置 goroutine 数量为 CPU 核心数
-	input := getInputStream(ctx, eg, f)
-	mapped := mapper(ctx, eg, input, mapFn)
-	sorted := sorter(ctx, eg, mapped)
-	reduced := reducer(ctx, eg, sorted)
+	reduce := reduceFn
+	var mapped <-chan wordCount
+	if strategy == "merge" {
+		// 每个文件单独聚合并按照 word 排序输出，归并后相同的 word 相邻，不需要全局的 map 或对所有 token 排序
+		mapped = mergeSorted(ctx, eg, fileAggregates(ctx, eg, files, runtime.GOMAXPROCS(0), rng, reduce)...)
+	} else if fastTokenize {
+		// 直接从字节流中拆分 token 并按文件聚合，不经过按行读取和 mapper
+		mapped = tokenMapper(ctx, eg, files, runtime.GOMAXPROCS(0), reduce)
+	} else {
+		// 同时读取的文件数量不超过 CPU 核心数
+		input := measureStage(ctx, eg, "input", startInput(ctx, eg, files, runtime.GOMAXPROCS(0), rng))
+		// 多个 mapper 并发处理输入的行，输出汇聚到一个 channel 中
+		mappers := make([]<-chan wordCount, mapWorkers)
+		if maxStreak {
+			// 连续出现需要按照输入顺序处理，只能使用一个 mapper
+			mappers[0] = streakMapper(ctx, eg, input, mapFn)
+			reduce = streakReduceFn
+		} else {
+			for i := range mappers {
+				if localAggregate {
+					mappers[i] = localMapper(ctx, eg, input, mapFn, reduce)
+				} else {
+					mappers[i] = mapper(ctx, eg, input, mapFn)
+				}
+			}
+		}
+		mapped = mergeStreams(ctx, eg, mappers...)
+	}
+	mapped = measureStage(ctx, eg, "mapper", mapped)
+	if growthEvery > 0 {
+		// 增长曲线直接消费按照输入顺序到达的 token 流，不需要合并和排序
+		out, err := createOutput(outputFile, zOut)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to create output: %s\n", err.Error())
+			os.Exit(1)
+		}
+		eg.Go(func() error {
+			return writeGrowthCurve(out, mapped, growthEvery)
+		})
+		err = eg.Wait()
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			exitProcessing(err, cancelled(), start)
+		}
+		return
+	}
+	var dumpOut *outputWriter
+	if dumpTokensFile != "" {
+		if dumpOut, err = createOutput(dumpTokensFile, false); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to create output: %s\n", err.Error())
+			os.Exit(1)
+		}
+		mapped = tokenDumper(ctx, eg, mapped, dumpOut)
+	}
+	if prior != nil {
+		// 之前保存的计数与 mapper 的输出一起参与合并
+		mapped = mergeStreams(ctx, eg, mapped, countSource(ctx, eg, prior))
+	}
+	if reduceCmd != "" {
+		// 排序后的 token 流交给外部程序合并和输出，不经过内置的 reducer 和输出格式
+		sorted := measureStage(ctx, eg, "sorter", sorter(ctx, eg, mapped))
+		if keepGoing {
+			sorted = failedDiscarder(ctx, eg, sorted)
+		}
+		out, err := createOutput(outputFile, zOut)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to create output: %s\n", err.Error())
+			os.Exit(1)
+		}
+		eg.Go(func() error {
+			return runReduceCmd(ctx, reduceCmd, sorted, out)
+		})
+		err = eg.Wait()
+		for _, o := range []*outputWriter{out, dumpOut} {
+			if o == nil {
+				continue
+			}
+			if closeErr := o.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			exitProcessing(err, cancelled(), start)
+		}
+		return
+	}
+	// reducer 的输出已经按照 word 排序，其他排序方式需要重新排序
+	resort := needsResort()
+	// 只需要前 N 个结果时尽量在合并的同时选出
+	top := reductionTop()
+	var reduced <-chan wordCount
+	switch strategy {
+	case "map":
+		// 保存的状态总是按照 word 排序，以保证输出稳定
+		reduced = measureStage(ctx, eg, "aggregate", aggregate(ctx, eg, mapped, reduce, !resort || saveStateFile != "", top))
+	case "spill":
+		// 溢写后归并的结果已经按照 word 排序，reducer 合并不同临时文件中相同 word 的部分结果
+		spilled := measureStage(ctx, eg, "aggregate", spillAggregate(ctx, eg, mapped, reduce, spillLimit()))
+		reduced = measureStage(ctx, eg, "reducer", reducer(ctx, eg, spilled, reduce, top))
+	case "merge":
+		// 归并的结果已经按照 word 排序，reducer 合并各文件的部分结果，只需要前 N 个时同时用有界堆选出
+		reduced = measureStage(ctx, eg, "reducer", reducer(ctx, eg, mapped, reduce, top))
+	default:
+		sorted := measureStage(ctx, eg, "sorter", sorter(ctx, eg, mapped))
+		reduced = measureStage(ctx, eg, "reducer", reducer(ctx, eg, sorted, reduce, top))
+	}
+	if keepGoing {
+		// 读取失败的文件在失败之前已经读到的部分不计入结果
+		reduced = failedDiscarder(ctx, eg, reduced)
+	}
+	// 保存的状态是过滤、抽样和截取前 N 个之前的完整计数，这样之后才能无损地合并
+	var stateOut *outputWriter
+	if saveStateFile != "" {
+		if stateOut, err = createOutput(saveStateFile, false); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to create output: %s\n", err.Error())
+			os.Exit(1)
+		}
+
+		streams := teeStream(ctx, eg, reduced, 2)
+		reduced = streams[0]
+		eg.Go(func() error {
+			return writeState(stateOut, streams[1])
+		})
+	}
+	if explainWord != "" {
+		reduced = wordFilter(ctx, eg, reduced, explainResult)
+	}
+	if format == "json-summary" || freqTable || metricsJSON {
+		// 统计过滤和截取前 N 个之前的不同 word 数量和总计数
+		reduced = wordFilter(ctx, eg, reduced, func(wc wordCount) bool {
+			distinctWords.Add(1)
+			totalCount.Add(int64(wc.count))
+			return true
+		})
+	}
+	if stopwordRatio {
+		reduced = countStopwords(ctx, eg, reduced, run)
+	}
+	if rankCorr {
+		reduced = collectShared(ctx, eg, reduced, run)
+	}
+	if commonWords {
+		// 只保留出现在所有成功读取的输入文件中的 word，只有一个输入文件时所有 word 都满足条件。
+		// 结果在所有输入读完后才到达这里，此时读取失败的文件数已经确定
+		reduced = wordFilter(ctx, eg, reduced, func(wc wordCount) bool { return wc.files.len() == len(files)-int(failedInputs.Load()) })
+	}
+	if uniqueTo != "" {
+		// 只保留仅出现在 -unique-to 指定的文件中的 word
+		reduced = wordFilter(ctx, eg, reduced, func(wc wordCount) bool { return wc.files.len() == 1 && wc.files.has(uniqueIndex) })
+	}
+	reduced = finishResults(ctx, eg, reduced, resort, top != nil, rng)
+
+	var sum hash.Hash
+	if checksum {
+		sum = sha256.New()
+		reduced = checksummer(ctx, eg, reduced, sum)
+	}
 
+	out, err := createOutput(outputFile, zOut)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to create output: %s\n", err.Error())
+		os.Exit(1)
+	}
+	outputs := []*outputWriter{out}
+	for _, o := range []*outputWriter{stateOut, dumpOut} {
+		if o != nil {
+			outputs = append(outputs, o)
+		}
+	}
+	if streamingFormats[format] && flushInterval > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go out.flushEvery(flushInterval, done)
+	}
+	// 同时输出 JSON 文件时，结果流复制一份给 JSON 输出
+	if jsonOutFile != "" {
+		jsonOut, err := createOutput(jsonOutFile, false)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "failed to create output: %s\n", err.Error())
+			os.Exit(1)
+		}
+		outputs = append(outputs, jsonOut)
+
+		streams := teeStream(ctx, eg, reduced, 2)
+		reduced = streams[0]
+		eg.Go(func() error {
+			return writeJSON(jsonOut, streams[1])
+		})
+	}
+
+	reduced = measureStage(ctx, eg, "writer", reduced)
+	// REPL 模式下结果先聚合到 aggregator 中，pipeline 结束后再交互式查询
+	var agg *Aggregator
 	eg.Go(func() error {
-		for wc := range reduced {
-			if _, err := fmt.Printf("%-15s%4d\n", wc.word, wc.count); err != nil {
-				return err
+		if repl {
+			agg = newAggregator(reduceFn)
+			for wc := range reduced {
+				agg.add(wc)
 			}
+			return nil
 		}
-		return nil
+		return writeResults(ctx, eg, out, reduced, run)
 	})
 
-	if err := eg.Wait(); err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "failed to process file: %s\n", err.Error())
-		os.Exit(1)
+	err = eg.Wait()
+	for _, o := range outputs {
+		if closeErr := o.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		exitProcessing(err, cancelled(), start)
+	}
+	if timing {
+		_ = writeTiming(os.Stderr, time.Since(start))
+	}
+	if stageStats {
+		_ = writeStageMetrics(os.Stderr)
 	}
+	if metricsJSON {
+		_ = writeMetricsJSON(os.Stderr, time.Since(start))
+	}
+	if reportMemory {
+		_ = writeMemory(os.Stderr)
+	}
+	if explainWord != "" {
+		_ = writeExplain(os.Stderr)
+	}
+	if sum != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "sha256:%x\n", sum.Sum(nil))
+	}
+	failed := failedInputs.Load()
+	if failed > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "%d of %d files could not be read\n", failed, len(files))
+	}
+
+	if repl {
+		if err := runREPL(os.Stdin, os.Stdout, agg, run); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "repl: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	// 部分输入文件读取失败时，REPL 结束后同样以状态 2 退出
+	if failed > 0 {
+		os.Exit(2)
+	}
+}
+
+// finishResults 对合并后的结果依次进行过滤、抽样和排序（或截取前 N 个）。
+// resort 为 false 时 input 已经按照 word 排序，不需要重新排序；selected 为 true 时 input 已经是合并时选出的前 N 个结果。
+func finishResults(ctx context.Context, eg *errgroup.Group, reduced <-chan wordCount, resort, selected bool, rng *rand.Rand) <-chan wordCount {
+	if selected {
+		return reduced
+	}
+	if targets != nil {
+		reduced = targetFilter(ctx, eg, reduced, targets)
+	}
+	if excludedWords != nil {
+		reduced = wordFilter(ctx, eg, reduced, func(wc wordCount) bool { return !excludedWords[wc.word] })
+	}
+	if onlyUnknown {
+		reduced = wordFilter(ctx, eg, reduced, func(wc wordCount) bool { return !dict[wc.word] })
+	}
+	if palindromes {
+		reduced = wordFilter(ctx, eg, reduced, func(wc wordCount) bool { return isPalindrome(wc.word) })
+	}
+	if sampleSize > 0 {
+		reduced = wordSampler(ctx, eg, reduced, sampleSize, rand.New(rand.NewSource(rng.Int63())))
+	}
+
+	// 输出全部结果时排序和输出阶段需要缓存所有 word，前 N 个结果则使用有界堆，不受 -max-distinct 限制
+	if maxDistinct > 0 && topN == 0 {
+		reduced = distinctLimiter(ctx, eg, reduced, maxDistinct)
+	}
+
+	// 只需要前 N 个结果时使用有界堆
+	less := resultOrder()
+	switch {
+	case topN > 0:
+		reduced = topNSelector(ctx, eg, reduced, topN, less)
+	case resort:
+		reduced = resultSorter(ctx, eg, reduced, less)
+	}
+
+	return reduced
+}
+
+// resultOrder 返回 -sort、-sort-keys 和 -reverse 指定的输出顺序
+func resultOrder() func(a, b wordCount) bool {
+	less := sortOrders[sortOrder]
+	if sortKeyOrder != nil {
+		less = sortKeyOrder
+	}
+	if reverse {
+		less = reverseOrder(less)
+	}
+	return less
+}
+
+// exitProcessing 输出处理失败的原因后退出。被信号或超时取消时还会输出取消前已经处理的行数、字节数和 token 数，
+// 即使没有指定 -timing，用户也能知道中断时的进度。
+func exitProcessing(err error, cancelled bool, start time.Time) {
+	_, _ = fmt.Fprintf(os.Stderr, "failed to process file: %s\n", err.Error())
+	if cancelled {
+		_ = writeTiming(os.Stderr, time.Since(start))
+	}
+	os.Exit(1)
+}
+
+// validateFlags 在启动 pipeline 之前检查各 flag 的取值是否合法
+func validateFlags() error {
+	if fromLine < 1 {
+		return fmt.Errorf("-from must be at least 1, got %d", fromLine)
+	}
+	if toLine != 0 && fromLine > toLine {
+		return fmt.Errorf("-from %d is greater than -to %d", fromLine, toLine)
+	}
+	if tailLines < 0 {
+		return fmt.Errorf("-tail must not be negative, got %d", tailLines)
+	}
+	if sampleRate <= 0 || sampleRate > 1 {
+		return fmt.Errorf("-sample must be in (0, 1], got %v", sampleRate)
+	}
+	if sampleSize < 0 {
+		return fmt.Errorf("-sample-words must not be negative, got %d", sampleSize)
+	}
+	if stopwordsFile != "" && !stopwordRatio {
+		return errors.New("-stopwords requires -stopword-ratio")
+	}
+	if showForms && !stemWords && bucketPattern == "" {
+		return errors.New("-show-forms requires -stem or -bucket-regex")
+	}
+	if onlyUnknown && dictFile == "" {
+		return errors.New("-only-unknown requires -dict")
+	}
+	if serveAddr != "" && grpcAddr != "" {
+		return errors.New("-serve and -grpc cannot be used together")
+	}
+	if keepPunct && tokenPattern != "" {
+		return errors.New("-keep-punct only applies to the default tokenizer and cannot be used with -token-regex")
+	}
+	if rawWords && (keepPunct || tokenPattern != "" || dropPossessive) {
+		return errors.New("-raw-words keeps every whitespace-separated word as it is and cannot be used with -keep-punct, -token-regex or -strip-possessive")
+	}
+	if singleQuotes && !inQuotes {
+		return errors.New("-single-quotes requires -in-quotes")
+	}
+	if !slices.Contains(outputFormats, format) {
+		return fmt.Errorf("unknown -format %q, must be one of %s", format, strings.Join(outputFormats, ", "))
+	}
+	if truncateLen < 0 {
+		return fmt.Errorf("-truncate-len must not be negative, got %d", truncateLen)
+	}
+	if minLen < 0 || maxLen < 0 {
+		return fmt.Errorf("-min-len and -max-len must not be negative, got %d and %d", minLen, maxLen)
+	}
+	if maxLen > 0 && minLen > maxLen {
+		return fmt.Errorf("-min-len %d is greater than -max-len %d", minLen, maxLen)
+	}
+	var err error
+	if tokenRegex, err = compileUserRegex("token-regex", tokenPattern); err != nil {
+		return err
+	}
+	if includeRegex, err = compileUserRegex("include-regex", includePattern); err != nil {
+		return err
+	}
+	if excludeRegex, err = compileUserRegex("exclude-regex", excludePattern); err != nil {
+		return err
+	}
+	if foldCaseRegex, err = compileUserRegex("fold-case-matching", foldCasePattern); err != nil {
+		return err
+	}
+	if bucketRegex, err = compileUserRegex("bucket-regex", bucketPattern); err != nil {
+		return err
+	}
+	if bucketRegex != nil && bucketRegex.NumSubexp() == 0 {
+		return errors.New("-bucket-regex needs a capture group that defines the bucket, e.g. ^(error)-")
+	}
+	if bucketOnly && bucketPattern == "" {
+		return errors.New("-bucket-only requires -bucket-regex")
+	}
+	if foldCasePattern != "" && acronyms {
+		return errors.New("-fold-case-matching cannot be used with -acronyms")
+	}
+	if scriptName != "" {
+		if scriptTable, err = lookupScript(scriptName); err != nil {
+			return err
+		}
+	}
+	if scriptThreshold <= 0 || scriptThreshold > 1 {
+		return fmt.Errorf("-script-threshold must be in (0, 1], got %v", scriptThreshold)
+	}
+	if mapWorkers < 1 {
+		return fmt.Errorf("-map-workers must be at least 1, got %d", mapWorkers)
+	}
+	if growthEvery < 0 {
+		return fmt.Errorf("-growth-curve must not be negative, got %d", growthEvery)
+	}
+	if reduceCmd != "" && strings.TrimSpace(reduceCmd) == "" {
+		return errors.New("-reduce-cmd must not be empty")
+	}
+	if reduceCmd != "" && (serveAddr != "" || grpcAddr != "" || repl || growthEvery > 0 || saveStateFile != "") {
+		return errors.New("-reduce-cmd cannot be used with -serve, -grpc, -repl, -growth-curve or -save-state")
+	}
+	if growthEvery > 0 && (mapWorkers > 1 || maxStreak || mergeInFile != "" || localAggregate) {
+		return errors.New("-growth-curve processes tokens in input order and cannot be used with -map-workers, -max-streak, -merge-in or -local-aggregate")
+	}
+	if dumpTokensFile != "" && localAggregate {
+		return errors.New("-dump-tokens writes the tokens of the mappers and cannot be used with -local-aggregate, whose mappers only output partial counts")
+	}
+	if maxStreak && (mapWorkers > 1 || localAggregate) {
+		return errors.New("-max-streak processes tokens in input order and cannot be used with -map-workers or -local-aggregate")
+	}
+	if commonWords && uniqueTo != "" {
+		return errors.New("-common and -unique-to cannot be used together")
+	}
+	if (trackFiles() || sourceBreakdown || rankCorr) && (maxStreak || mergeInFile != "" || serveAddr != "" || grpcAddr != "") {
+		return errors.New("-common, -unique-to, -source-breakdown and -rank-corr need to know the input file of every word and cannot be used with -max-streak, -merge-in, -serve or -grpc")
+	}
+	if keepGoing && (maxStreak || growthEvery > 0 || serveAddr != "" || grpcAddr != "") {
+		return errors.New("-keep-going discards the counts of input files that fail to read and cannot be used with -max-streak, -growth-curve, -serve or -grpc")
+	}
+	if strategy != "heap" && strategy != "map" && strategy != "merge" && strategy != "auto" {
+		return fmt.Errorf("unknown -strategy %q, must be heap, map, merge or auto", strategy)
+	}
+	if lruCap < 0 {
+		return fmt.Errorf("-lru-cap must not be negative, got %d", lruCap)
+	}
+	if streamSorted && (strategy == "heap" || strategy == "merge") {
+		return errors.New("-stream-sorted requires -strategy map")
+	}
+	if lruCap > 0 && (strategy == "heap" || strategy == "merge") {
+		return errors.New("-lru-cap requires -strategy map")
+	}
+	if maxMemory < 0 {
+		return fmt.Errorf("-max-memory must not be negative, got %d", maxMemory)
+	}
+	if maxMemory > 0 && (strategy != "auto" || lruCap > 0 || streamSorted) {
+		return errors.New("-max-memory requires -strategy auto and cannot be used with -lru-cap or -stream-sorted")
+	}
+	if strategy == "merge" && (fastTokenize || mapWorkers > 1 || localAggregate || maxStreak || growthEvery > 0 ||
+		dumpTokensFile != "" || reduceCmd != "" || mergeInFile != "" || maxTokens > 0) {
+		return errors.New("-strategy merge reads and aggregates each file separately and cannot be used with -fast-tokenize, -map-workers, -local-aggregate, -max-streak, -growth-curve, -dump-tokens, -reduce-cmd, -merge-in or -max-tokens")
+	}
+	if _, ok := sortOrders[sortOrder]; !ok {
+		return fmt.Errorf("unknown -sort %q, must be word, count or length", sortOrder)
+	}
+	if sortKeys != "" {
+		if sortKeyOrder, err = parseSortKeys(sortKeys); err != nil {
+			return fmt.Errorf("invalid -sort-keys: %w", err)
+		}
+	}
+	if _, ok := tieBreaks[tieBreak]; !ok {
+		return fmt.Errorf("unknown -tiebreak %q, must be alpha, length or first-seen", tieBreak)
+	}
+	if topN < 0 {
+		return fmt.Errorf("-n must not be negative, got %d", topN)
+	}
+	if maxTokens < 0 {
+		return fmt.Errorf("-max-tokens must not be negative, got %d", maxTokens)
+	}
+	if maxTokens > 0 && (serveAddr != "" || grpcAddr != "") {
+		return errors.New("-max-tokens cannot be used with -serve or -grpc")
+	}
+	if fastTokenize {
+		if opt := lineBasedOption(); opt != "" {
+			return fmt.Errorf("-fast-tokenize does not read lines and cannot be used with -%s", opt)
+		}
+	}
+	if chunkBytes < 0 {
+		return fmt.Errorf("-chunk-bytes must not be negative, got %d", chunkBytes)
+	}
+	if noLineBoundaries && (chunkBytes > 0 || positions || firstLine || fastTokenize) {
+		return errors.New("-no-line-boundaries cannot be used with -chunk-bytes, -positions, -first-line or -fast-tokenize")
+	}
+	if chunkBytes > 0 {
+		if opt := lineNumberOption(); opt != "" {
+			return fmt.Errorf("-chunk-bytes does not read lines and cannot be used with -%s", opt)
+		}
+	}
+	if maxRows < 0 {
+		return fmt.Errorf("-max-rows must not be negative, got %d", maxRows)
+	}
+	if maxRows > 0 && format != "text" {
+		return errors.New("-max-rows only applies to -format text")
+	}
+	if dataHeader && format != "data" {
+		return errors.New("-data-header only applies to -format data")
+	}
+	if maxDistinct < 0 {
+		return fmt.Errorf("-max-distinct must not be negative, got %d", maxDistinct)
+	}
+	if wordCloudScale != "linear" && wordCloudScale != "log" {
+		return fmt.Errorf("unknown -wordcloud-scale %q, must be linear or log", wordCloudScale)
+	}
+	return nil
+}
+
+// lineNumberOption 返回已指定的依赖输入中行号或行边界的选项名称，-chunk-bytes 按照固定大小读取时这些选项没有意义
+func lineNumberOption() string {
+	options := []struct {
+		name    string
+		enabled bool
+	}{
+		{"from", fromLine > 1}, {"to", toLine > 0}, {"tail", tailLines > 0}, {"first-line", firstLine},
+		{"positions", positions}, {"per-line-unique", perLineUnique}, {"universal-newlines", universalEOL},
+		{"fast-tokenize", fastTokenize},
+	}
+	for _, opt := range options {
+		if opt.enabled {
+			return opt.name
+		}
+	}
+	return ""
+}
+
+// lineBasedOption 返回一个已启用的需要按行读取输入或处理整个字段的选项名称，都没有启用时返回空字符串
+func lineBasedOption() string {
+	options := []struct {
+		name    string
+		enabled bool
+	}{
+		{"token-regex", tokenPattern != ""}, {"raw-words", rawWords}, {"explain", explainFor != ""},
+		{"fold-case-matching", foldCasePattern != ""}, {"keep-punct", keepPunct}, {"normalize-punct", normalizePunct},
+		{"fold-confusables", foldConfusable}, {"fold-map", foldMapFile != ""}, {"char-digrams", charDigrams},
+		{"strip-possessive", dropPossessive}, {"preserve-case", preserveCase}, {"case-breakdown", caseBreakdown},
+		{"per-line-unique", perLineUnique}, {"in-quotes", inQuotes}, {"from", fromLine > 1}, {"to", toLine > 0},
+		{"tail", tailLines > 0}, {"sample", sampleRate < 1}, {"strict-utf8", strictUTF8}, {"first-line", firstLine},
+		{"positions", positions}, {"max-streak", maxStreak}, {"growth-curve", growthEvery > 0},
+		{"dump-tokens", dumpTokensFile != ""}, {"max-tokens", maxTokens > 0}, {"local-aggregate", localAggregate},
+		{"map-workers", mapWorkers > 1}, {"script", scriptName != ""},
+		{"bucket-regex", bucketPattern != ""},
+	}
+	for _, opt := range options {
+		if opt.enabled {
+			return opt.name
+		}
+	}
+	return ""
 }
 
 func getLoggerOptions() *slog.HandlerOptions {
@@ -82,24 +996,14 @@ func getLoggerOptions() *slog.HandlerOptions {
 	return logOpts
 }
 
-// getInputStream 启动一个 goroutine 来读取 r 中的数据，将所读到的数据发送到返回的 channel 中。
-func getInputStream(ctx context.Context, eg *errgroup.Group, r io.Reader) <-chan string {
-	ch := make(chan string)
+// stringList 是可以重复指定的字符串 flag
+type stringList []string
 
-	eg.Go(func() error {
-		defer func() { close(ch); slog.Debug("all text hash been read") }()
-		sc := bufio.NewScanner(r)
-		for sc.Scan() {
-			line := sc.Text()
-			logger.Debug("read line", "line", line)
-			select {
-			case ch <- line:
-			case <-ctx.Done():
-				return ctx.Err()
-			}
-		}
-		return sc.Err()
-	})
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
 
-	return ch
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
 }
@@ -3,40 +3,424 @@ package main
 import (
 	"container/heap"
 	"context"
+	"fmt"
 	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"golang.org/x/sync/errgroup"
 )
 
 type wordCount struct {
-	word  string
-	count int
+	word    string
+	count   int
+	line    int            // word 首次出现的行号
+	offset  int64          // word 首次出现的位置在文件中的字节偏移量
+	seq     int64          // 指定 -tiebreak first-seen 时为 word 首次出现的顺序，见 firstSeenSeq
+	forms   map[string]int // 指定 -preserve-case 或 -case-breakdown 时记录 word 的各种原始写法及其出现次数
+	files   fileSet        // 指定 -common 或 -unique-to 时记录 word 出现在哪些输入文件中
+	members map[string]int // 指定 -show-forms 时记录词干相同的各个单词（小写）及其出现次数
+	sources map[int]int    // 指定 -source-breakdown 时记录 word 在每个输入文件中的计数
+}
+
+// display 返回 word 用于输出的形式：记录了原始写法时为出现次数最多的写法（次数相同时取字典序最小的），否则为 word 本身
+func (wc wordCount) display() string {
+	if len(wc.forms) == 0 {
+		return wc.word
+	}
+
+	var best string
+	for form, n := range wc.forms {
+		if best == "" || n > wc.forms[best] || (n == wc.forms[best] && form < best) {
+			best = form
+		}
+	}
+	return best
 }
 
 var nonAlpha = regexp.MustCompile("[^a-zA-Z]+")
 
+// nonLetter 匹配 Unicode 字母和组合符号以外的字符，指定 -script 时默认分词规则使用它代替 nonAlpha，
+// 否则其他文字的字母都会被去掉，-script 永远不会匹配
+var nonLetter = regexp.MustCompile(`[^\p{L}\p{M}]+`)
+
+// letterFilter 返回默认分词规则用于去掉非字母字符的正则表达式
+func letterFilter() *regexp.Regexp {
+	if scriptTable != nil {
+		return nonLetter
+	}
+	return nonAlpha
+}
+
+// punctReplacer 将文字处理软件中常见的 Unicode 标点替换为对应的 ASCII 标点。
+// 破折号通常用于分隔两个短语，因此替换为两侧带空格的连字符，避免前后两个单词被拼接在一起。
+var punctReplacer = strings.NewReplacer(
+	"\u2018", "'", "\u2019", "'", "\u201a", "'", "\u2032", "'", // ‘ ’ ‚ ′
+	"\u201c", `"`, "\u201d", `"`, "\u201e", `"`, "\u2033", `"`, // “ ” „ ″
+	"\u2010", "-", "\u2011", "-", "\u2012", "-", "\u2013", "-", "\u2212", "-", // 连字符、数字间的短横线和减号
+	"\u2014", " - ", "\u2015", " - ", // — ―
+	"\u2026", "...", // …
+)
+
+// scriptTable 是 -script 指定的 Unicode 文字，不为 nil 时只统计主要由该文字组成的 word
+var scriptTable *unicode.RangeTable
+
+// lookupScript 不区分大小写地查找 Unicode 文字（如 latin、greek、cyrillic）
+func lookupScript(name string) (*unicode.RangeTable, error) {
+	for script, table := range unicode.Scripts {
+		if strings.EqualFold(script, name) {
+			return table, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown -script %q", name)
+}
+
+// inScript 判断 word 中属于 scriptTable 的字母是否至少占所有字母的 scriptThreshold，不含字母的 word 不计入
+func inScript(word string) bool {
+	var letters, matched int
+	for _, r := range word {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.Is(scriptTable, r) {
+				matched++
+			}
+		}
+	}
+	return letters > 0 && float64(matched) >= scriptThreshold*float64(letters)
+}
+
+// 用户通过 -token-regex、-include-regex、-exclude-regex、-fold-case-matching 和 -bucket-regex 指定的正则表达式
+var (
+	tokenRegex    *regexp.Regexp
+	includeRegex  *regexp.Regexp
+	excludeRegex  *regexp.Regexp
+	foldCaseRegex *regexp.Regexp
+	bucketRegex   *regexp.Regexp
+)
+
+const (
+	// maxPatternLen 是用户指定的正则表达式的最大长度
+	maxPatternLen = 1024
+	// maxTokensPerLine 是使用 -token-regex 分词时每行最多匹配的 token 数量
+	maxTokensPerLine = 1 << 16
+)
+
+// compileUserRegex 编译用户通过 flag 指定的正则表达式，拒绝过长的表达式
+func compileUserRegex(name, pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	if len(pattern) > maxPatternLen {
+		return nil, fmt.Errorf("-%s pattern is too long (%d bytes, at most %d)", name, len(pattern), maxPatternLen)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -%s: %w", name, err)
+	}
+	return re, nil
+}
+
+// token 是从一行中拆分出的原始 token，pos 为其在行中的字节偏移量。
+// 默认的拆分方式去掉非字母字符时 field 为去掉之前的整个字段，供 -bucket-regex 匹配，其他情况下为空
+type token struct {
+	text  string
+	field string
+	pos   int
+}
+
+// splitTokens 将一行拆分成原始 token：默认按照空白字符拆分并去掉非字母字符，指定 -token-regex 时为所有匹配的子串
+func splitTokens(line string) []token {
+	var tokens []token
+	if tokenRegex != nil {
+		for _, loc := range tokenRegex.FindAllStringIndex(line, maxTokensPerLine) {
+			tokens = append(tokens, token{text: stripPossessive(line[loc[0]:loc[1]]), pos: loc[0]})
+		}
+		return tokens
+	}
+
+	start := -1
+	for i, r := range line + " " {
+		switch {
+		case !isSeparator(r):
+			if start < 0 {
+				start = i
+			}
+		case start >= 0:
+			tokens = appendField(tokens, line[start:i], start)
+			start = -1
+		}
+	}
+	return tokens
+}
+
+// isSeparator 判断 r 是否分隔两个 word：unicode.IsSpace 已经包括不换行空格（U+00A0、U+202F 等），
+// 指定 -fold-space 时不可见的零宽空格也作为分隔符，否则它们会在去掉非字母字符后把前后两个单词拼接在一起
+func isSeparator(r rune) bool {
+	if unicode.IsSpace(r) {
+		return true
+	}
+	return foldSpace && (r == '\u200b' || r == '\u2060' || r == '\ufeff')
+}
+
+// appendField 将以空白分隔的字段 field（位于行中的 pos 处）转换成 token 追加到 tokens 中。
+// 默认去掉所有非字母字符；指定 -keep-punct 时连续的标点符号作为单独的 token，
+// 字母在标点处断开，其他字符（如数字）仍然被去掉；指定 -raw-words 时字段原样作为 token。
+func appendField(tokens []token, field string, pos int) []token {
+	if rawWords {
+		return append(tokens, token{text: field, pos: pos})
+	}
+	field = stripPossessive(field)
+	if !keepPunct {
+		// 通过正则替换掉掉非字母字符，位置为第一个字母所在的位置
+		re := letterFilter()
+		if letter := re.FindStringIndex(field); letter != nil && letter[0] == 0 {
+			pos += letter[1]
+		}
+		return append(tokens, token{text: re.ReplaceAllString(field, ""), field: field, pos: pos})
+	}
+
+	var cur strings.Builder
+	var curPos int
+	var curPunct bool
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, token{text: cur.String(), pos: curPos})
+			cur.Reset()
+		}
+	}
+	for i, r := range field {
+		isLetter := r < utf8.RuneSelf && isASCIILetter(byte(r)) || scriptTable != nil && (unicode.IsLetter(r) || unicode.Is(unicode.M, r))
+		isPunct := unicode.IsPunct(r) || unicode.IsSymbol(r)
+		if !isLetter && !isPunct {
+			continue
+		}
+		if cur.Len() > 0 && curPunct != isPunct {
+			flush()
+		}
+		if cur.Len() == 0 {
+			curPos, curPunct = pos+i, isPunct
+		}
+		cur.WriteRune(r)
+	}
+	flush()
+	return tokens
+}
+
+// contractionBases 中的单词加上 's 通常是缩写（如 it's = it is、let's = let us）而不是所有格
+var contractionBases = map[string]bool{
+	"it": true, "he": true, "she": true, "that": true, "there": true, "here": true,
+	"what": true, "where": true, "who": true, "how": true, "let": true,
+}
+
+// stripPossessive 在指定 -strip-possessive 时去掉 token 末尾（忽略其后的标点）的所有格 's 或 ’s，
+// 使 "dog's" 与 "dog" 合并。复数所有格（如 "dogs'"）末尾的撇号本来就会被去掉，因此保留为 "dogs"；
+// contractionBases 中的缩写保持不变。
+func stripPossessive(field string) string {
+	if !dropPossessive {
+		return field
+	}
+
+	end := len(field)
+	for end > 0 && !isASCIILetter(field[end-1]) {
+		end--
+	}
+	for _, suffix := range []string{"'s", "'S", "\u2019s", "\u2019S"} {
+		base, ok := strings.CutSuffix(field[:end], suffix)
+		if ok && base != "" && !contractionBases[strings.ToLower(nonAlpha.ReplaceAllString(base, ""))] {
+			return base + field[end:]
+		}
+	}
+	return field
+}
+
+func isASCIILetter(b byte) bool {
+	return b|0x20 >= 'a' && b|0x20 <= 'z'
+}
+
 // mapFn 将输入的每一行转换成 wordCount 列表
 func mapFn(line string) []wordCount {
+	line = prepareLine(line)
+
 	var result []wordCount
-	for _, w := range strings.Fields(line) {
-		// 通过正则替换掉掉非字母字符，并转换成小写
-		w = strings.ToLower(nonAlpha.ReplaceAllString(w, ""))
-		if w != "" {
-			result = append(result, wordCount{word: w, count: 1})
+	var seen map[string]bool
+	if perLineUnique {
+		seen = make(map[string]bool)
+	}
+
+	for _, tok := range splitTokens(line) {
+		orig := tok.text
+		w, surface, ok := normalizeToken(orig, tok.field)
+		if !ok || seen[w] {
+			continue
+		}
+		if seen != nil {
+			// 每个 word 在一行中只计数一次
+			seen[w] = true
 		}
+
+		wc := wordCount{word: w, count: 1, offset: int64(tok.pos)}
+		if preserveCase || caseBreakdown {
+			wc.forms = map[string]int{orig: 1}
+		}
+		if showForms {
+			wc.members = map[string]int{surface: 1}
+		}
+		result = append(result, wc)
+	}
+	if charDigrams {
+		return digrams(result)
 	}
 	return result
 }
 
+// digrams 将每个 word 拆分成其中相邻的两个字符组成的字符对，如 "the" 拆分成 "th" 和 "he"，
+// 字符对的位置为 word 的位置，只有一个字符的 word 被丢弃
+func digrams(words []wordCount) []wordCount {
+	var result []wordCount
+	for _, wc := range words {
+		runes := []rune(wc.word)
+		for i := 0; i+1 < len(runes); i++ {
+			pair := wc
+			pair.word = string(runes[i : i+2])
+			pair.forms, pair.members = nil, nil
+			result = append(result, pair)
+		}
+	}
+	return result
+}
+
+// prepareLine 在拆分 token 之前对整行进行 -normalize-punct、-fold-confusables 和 -fold-map 的替换
+func prepareLine(line string) string {
+	if normalizePunct {
+		line = punctReplacer.Replace(line)
+	}
+	if foldConfusable {
+		line = foldConfusables(line)
+	}
+	if foldReplacer != nil {
+		line = foldReplacer.Replace(line)
+	}
+	return line
+}
+
+// normalizeToken 将原始 token 转换成计数使用的 word：转换成小写（-acronyms 时只保留缩略词）、提取词干、截断，
+// 并按照 -include-regex、-exclude-regex 和 -script 过滤，不需要计数时 ok 为 false。
+// field 为 orig 去掉非字母字符之前的整个字段，不为空时 -bucket-regex 匹配 field 而不是 orig，使 ^(error)-\d+ 这样的模式在默认的拆分方式下也能匹配。
+// surface 为提取词干之前的形式。
+func normalizeToken(orig, field string) (w, surface string, ok bool) {
+	return normalizeTokenTrace(orig, field, nil)
+}
+
+// normalizeTokenTrace 与 normalizeToken 相同，trace 不为 nil 时每个改变了 word 的步骤完成后以步骤名称和结果调用 trace，
+// 用于 -explain
+func normalizeTokenTrace(orig, field string, trace func(step, w string)) (w, surface string, ok bool) {
+	// step 在 w 被步骤 name 改变时调用 trace
+	step := func(name, before string) {
+		if trace != nil && w != before {
+			trace(name, w)
+		}
+	}
+	if acronyms {
+		// 只统计全大写的缩略词，并保留其大写形式
+		if !isAcronym(orig) {
+			return "", "", false
+		}
+		w = orig
+	} else if foldCaseRegex != nil && !foldCaseRegex.MatchString(orig) {
+		// 指定 -fold-case-matching 时只将匹配的 token 转换成小写，其余 token 保留原有的大小写
+		w = orig
+	} else {
+		// 转换成小写
+		w = strings.ToLower(orig)
+		field = strings.ToLower(field)
+		step("lowercase", orig)
+	}
+	surface = w
+	if bucketRegex != nil {
+		if field == "" {
+			field = w
+		}
+		if key, ok := bucketKey(field); ok {
+			w, surface = key, field
+			step("bucket", field)
+		} else if bucketOnly {
+			return "", "", false
+		}
+	}
+	if stemWords {
+		before := w
+		w = stem(w)
+		step("stem", before)
+	}
+	if truncateLen > 0 {
+		before := w
+		w = truncateWord(w, truncateLen)
+		step("truncate", before)
+	}
+	if w == "" {
+		return "", "", false
+	}
+	if minLen > 0 || maxLen > 0 {
+		if n := wordLen(w); n < minLen || (maxLen > 0 && n > maxLen) {
+			return "", "", false
+		}
+	}
+	if (includeRegex != nil && !includeRegex.MatchString(w)) || (excludeRegex != nil && excludeRegex.MatchString(w)) {
+		return "", "", false
+	}
+	if scriptTable != nil && !inScript(w) {
+		return "", "", false
+	}
+	return w, surface, true
+}
+
+// bucketKey 返回 w 匹配 -bucket-regex 时第一个捕获组的内容，作为 w 计数所在的分组；
+// 不匹配或第一个捕获组没有参与匹配时返回 false
+func bucketKey(w string) (string, bool) {
+	m := bucketRegex.FindStringSubmatchIndex(w)
+	if m == nil || m[2] < 0 {
+		return "", false
+	}
+	return w[m[2]:m[3]], true
+}
+
+// truncateRunes 将 s 截断为最多 n 个字符
+func truncateRunes(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+// isAcronym 判断 token 是否为长度至少为 2 的全大写单词
+func isAcronym(token string) bool {
+	if utf8.RuneCountInString(token) < 2 {
+		return false
+	}
+	for _, r := range token {
+		if !unicode.IsUpper(r) {
+			return false
+		}
+	}
+	return true
+}
+
 // mapper 将输入的每一行转换成 wordCount 流
-func mapper(ctx context.Context, eg *errgroup.Group, input <-chan string, fn func(string) []wordCount) <-chan wordCount {
+func mapper(ctx context.Context, eg *errgroup.Group, input <-chan inputLine, fn func(string) []wordCount) <-chan wordCount {
 	ch := make(chan wordCount)
 
 	eg.Go(func() error {
 		defer func() { close(ch); logger.Debug("mapper exits") }()
 		for l := range input {
-			for _, wc := range fn(l) {
+			for _, wc := range fn(l.text) {
+				wc, ok := annotateToken(wc, l)
+				if !ok {
+					return nil
+				}
 				logger.Debug("mapFn outputs", "word", wc.word, "count", wc.count)
 				select {
 				case ch <- wc:
@@ -51,13 +435,93 @@ func mapper(ctx context.Context, eg *errgroup.Group, input <-chan string, fn fun
 	return ch
 }
 
+// annotateToken 为 mapFn 从行 l 中得到的 wordCount 补充位置、权重、出现顺序和所在的文件，并更新 token 计数。
+// 已经处理了 -max-tokens 个 token 时返回 false，调用方应停止处理输入。
+func annotateToken(wc wordCount, l inputLine) (wordCount, bool) {
+	n := tokensMapped.Add(1)
+	if tokenLimitReached(n) {
+		return wc, false
+	}
+	if explainWord != "" && wc.word == explainWord {
+		explainToken(wc, l)
+	}
+	wc.line = l.num
+	wc.offset += l.offset
+	if weight, ok := weights[wc.word]; ok {
+		// 每次出现贡献的计数按照权重放大，合并时直接累加即可
+		wc.count *= weight
+	}
+	if trackFirstSeen() {
+		wc.seq = firstSeenSeq(l.file, wc.offset)
+	}
+	if trackFiles() {
+		wc.files = newFileSet(l.file)
+	}
+	if trackSources() {
+		wc.sources = map[int]int{l.file: wc.count}
+	}
+	return wc, true
+}
+
+// firstSeenSeq 返回第 file 个输入文件中位置为 pos 的 token 的出现顺序：先按照文件在输入列表中的顺序，
+// 再按照 token 在文件中的位置（字节偏移量，-fast-tokenize 时为 token 的序号），
+// 因此与同时读取多个文件和多个 mapper 的调度顺序无关，每次运行的结果相同。
+func firstSeenSeq(file int, pos int64) int64 {
+	return int64(file)<<40 | pos
+}
+
+// tokenLimitReached 判断第 n 个 token 是否超出了 -max-tokens，超出时停止读取输入
+func tokenLimitReached(n int64) bool {
+	if maxTokens == 0 || n <= maxTokens {
+		return false
+	}
+	// 超出的 token 不算作已处理
+	tokensMapped.Add(-1)
+	stopInput()
+	return true
+}
+
+// localMapper 与 mapper 一样将输入的每一行转换成 wordCount，但先在 worker 内部通过 reduce 合并相同 word 的计数，
+// 输入结束后才输出部分结果，channel 的发送次数从 token 数降低为该 worker 中不同 word 的数量。
+// 多个 localMapper 的部分结果仍需经过 aggregate 或 sorter 和 reducer 合并。
+func localMapper(ctx context.Context, eg *errgroup.Group, input <-chan inputLine, fn func(string) []wordCount, reduce func(acc, next wordCount) wordCount) <-chan wordCount {
+	ch := make(chan wordCount)
+
+	eg.Go(func() error {
+		defer func() { close(ch); logger.Debug("local mapper exits") }()
+		agg := newCappedAggregator(reduce, lruCap)
+	loop:
+		for l := range input {
+			for _, wc := range fn(l.text) {
+				wc, ok := annotateToken(wc, l)
+				if !ok {
+					break loop
+				}
+				agg.add(wc)
+			}
+		}
+
+		logger.Debug("local mapper outputs partial counts", "words", agg.Len())
+		for _, wc := range agg.counts {
+			select {
+			case ch <- wc:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	return ch
+}
+
 // sorter 将 wordCount 流中数据按照 word 排序
 func sorter(ctx context.Context, eg *errgroup.Group, input <-chan wordCount) <-chan wordCount {
 	ch := make(chan wordCount)
 
 	eg.Go(func() error {
 		defer func() { close(ch); logger.Debug("sorter exits") }()
-		wcHeap := new(wordCountHeap)
+		wcHeap := &wordCountHeap{less: byWord}
 		for wc := range input {
 			logger.Debug("sorter got map output", "word", wc.word, "count", wc.count)
 			select {
@@ -82,26 +546,91 @@ func sorter(ctx context.Context, eg *errgroup.Group, input <-chan wordCount) <-c
 	return ch
 }
 
-// reducer 将排序后的 wordCount 流中相同 word 的数据合并，计算出每个 word 的总数
-func reducer(ctx context.Context, eg *errgroup.Group, input <-chan wordCount) <-chan wordCount {
+// reduceFn 将相同 word 的两个 wordCount 合并，计算出每个 word 的总数
+func reduceFn(acc, next wordCount) wordCount {
+	acc.count += next.count
+	// 记录了出现顺序时行号和偏移量取自最先出现的 token，它们只在同一个文件中才能直接比较
+	switch {
+	case next.seq < acc.seq:
+		acc.line, acc.offset = next.line, next.offset
+	case next.seq == acc.seq:
+		acc.line = min(acc.line, next.line)
+		acc.offset = min(acc.offset, next.offset)
+	}
+	acc.seq = min(acc.seq, next.seq)
+	if next.forms != nil {
+		if acc.forms == nil {
+			acc.forms = make(map[string]int, len(next.forms))
+		}
+		for form, n := range next.forms {
+			acc.forms[form] += n
+		}
+	}
+	if next.members != nil {
+		if acc.members == nil {
+			acc.members = make(map[string]int, len(next.members))
+		}
+		for member, n := range next.members {
+			acc.members[member] += n
+		}
+	}
+	if next.sources != nil {
+		if acc.sources == nil {
+			acc.sources = make(map[int]int, len(next.sources))
+		}
+		for file, n := range next.sources {
+			acc.sources[file] += n
+		}
+	}
+	if next.files != nil {
+		acc.files = acc.files.union(next.files)
+	}
+	return acc
+}
+
+// reducer 将排序后的 wordCount 流中相同 word 的数据通过 fn 合并，fn 的第一个参数为当前 word 已合并的结果。
+// top 不为 nil 时合并完的每个 word 都交给 top，输入结束后只输出选出的前 N 个结果。
+func reducer(ctx context.Context, eg *errgroup.Group, input <-chan wordCount, fn func(acc, next wordCount) wordCount, top *topSelector) <-chan wordCount {
 	ch := make(chan wordCount)
 
 	eg.Go(func() error {
 		defer func() { close(ch); logger.Debug("reducer exits") }()
+		emit := func(wc wordCount) error {
+			if top != nil {
+				top.add(wc)
+				return nil
+			}
+			select {
+			case ch <- wc:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
 		var wc wordCount
 		for in := range input {
 			logger.Debug("reducer got sorted output", "word", in.word, "count", in.count)
 			if wc.word != in.word {
 				if wc.word != "" {
-					select {
-					case ch <- wc:
-					case <-ctx.Done():
-						return ctx.Err()
+					if err := emit(wc); err != nil {
+						return err
 					}
 				}
+				wordsAggregated.Add(1)
 				wc = in
+				continue
 			}
-			wc.count += in.count
+			wc = fn(wc, in)
+		}
+
+		// 输入结束后还需要输出最后一个 word 的结果
+		if wc.word != "" {
+			if err := emit(wc); err != nil {
+				return err
+			}
+		}
+		if top != nil {
+			return sendAll(ctx, ch, top.result())
 		}
 		return nil
 	})
@@ -0,0 +1,629 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// countText 对 text 依次运行 readLines、mapper 和聚合（heap 为 sorter 加 reducer，map 为 aggregate），返回每个 word 的计数
+func countText(tb testing.TB, text, strategy string) map[string]int {
+	tb.Helper()
+	eg, ctx := errgroup.WithContext(context.Background())
+	lines := make(chan inputLine)
+	eg.Go(func() error {
+		defer close(lines)
+		return readLines(ctx, strings.NewReader(text), 0, lines, rand.New(rand.NewSource(1)))
+	})
+	mapped := mapper(ctx, eg, lines, mapFn)
+	var reduced <-chan wordCount
+	if strategy == "map" {
+		reduced = aggregate(ctx, eg, mapped, reduceFn, true, nil)
+	} else {
+		reduced = reducer(ctx, eg, sorter(ctx, eg, mapped), reduceFn, nil)
+	}
+
+	counts := make(map[string]int)
+	for wc := range reduced {
+		counts[wc.word] += wc.count
+	}
+	if err := eg.Wait(); err != nil {
+		tb.Fatal(err)
+	}
+	return counts
+}
+
+// TestReducerFn 检查 reducer 使用传入的 fn 合并相同 word 的数据：默认的 reduceFn 累加计数并保留最小的行号，
+// 自定义的 fn 可以计算其他结果，每个 word 的第一条数据只作为初始值而不会被合并两次
+func TestReducerFn(t *testing.T) {
+	sorted := []wordCount{
+		{word: "alpha", count: 2, line: 3}, {word: "alpha", count: 5, line: 1}, {word: "alpha", count: 1, line: 7},
+		{word: "beta", count: 4, line: 2},
+	}
+	maxCount := func(acc, next wordCount) wordCount {
+		acc.count = max(acc.count, next.count)
+		return acc
+	}
+	lastLine := func(acc, next wordCount) wordCount {
+		acc.line = next.line
+		return acc
+	}
+	tests := []struct {
+		name string
+		fn   func(acc, next wordCount) wordCount
+		want []wordCount
+	}{
+		{"sum", reduceFn, []wordCount{{word: "alpha", count: 8, line: 1}, {word: "beta", count: 4, line: 2}}},
+		{"max", maxCount, []wordCount{{word: "alpha", count: 5, line: 3}, {word: "beta", count: 4, line: 2}}},
+		{"last line", lastLine, []wordCount{{word: "alpha", count: 2, line: 7}, {word: "beta", count: 4, line: 2}}},
+	}
+	for _, tt := range tests {
+		got := collect(t, func(ctx context.Context, eg *errgroup.Group) <-chan wordCount {
+			return reducer(ctx, eg, feed(sorted...), tt.fn, nil)
+		})
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: results %+v, want %+v", tt.name, got, tt.want)
+		}
+		for i := range got {
+			if got[i].word != tt.want[i].word || got[i].count != tt.want[i].count || got[i].line != tt.want[i].line {
+				t.Errorf("%s: result %d = %+v, want %+v", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+// TestNoTrailingNewline 是 reducer 丢掉最后一个 word 的回归测试：没有换行符结尾的最后一行同样需要计数
+func TestNoTrailingNewline(t *testing.T) {
+	tests := []struct {
+		text string
+		want map[string]int
+	}{
+		{"alpha beta", map[string]int{"alpha": 1, "beta": 1}},
+		{"alpha\nbeta", map[string]int{"alpha": 1, "beta": 1}},
+		{"beta alpha\n\nalpha beta", map[string]int{"alpha": 2, "beta": 2}},
+	}
+	for _, tt := range tests {
+		for _, strategy := range []string{"heap", "map"} {
+			if got := countText(t, tt.text, strategy); !maps.Equal(got, tt.want) {
+				t.Errorf("-strategy %s: counts of %q = %v, want %v", strategy, tt.text, got, tt.want)
+			}
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(path, []byte("alpha beta"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, code := runMain(t, "", "-f", path)
+	if want := "alpha             1\nbeta              1\n"; code != 0 || stdout != want {
+		t.Errorf("exit status %d, output %q, want %q (stderr %q)", code, stdout, want, stderr)
+	}
+}
+
+// zipfLines 返回 n 行符合 Zipf 分布的文本，每行 perLine 个 word。
+// zipfTokens 中 word 的编号被转换为字母，保证默认的分词规则不会改变它们。
+func zipfLines(n, perLine int) []inputLine {
+	tokens := zipfTokens(n*perLine, 1000)
+	lines := make([]inputLine, n)
+	for i := range lines {
+		words := make([]string, perLine)
+		for j := range words {
+			words[j] = strings.Map(func(r rune) rune { return 'a' + (r-'0')%26 }, tokens[i*perLine+j].word[1:])
+		}
+		lines[i] = inputLine{text: strings.Join(words, " "), num: i + 1}
+	}
+	return lines
+}
+
+// countMapped 用 workers 个 mapper 处理 lines 并用 aggregate 合并，local 为 true 时使用 localMapper。
+// 返回每个 word 的计数和 mapper 向下游发送的 wordCount 数量。
+func countMapped(tb testing.TB, lines []inputLine, workers int, local bool) (map[string]int, int) {
+	tb.Helper()
+	eg, ctx := errgroup.WithContext(context.Background())
+	input := make(chan inputLine)
+	eg.Go(func() error {
+		defer close(input)
+		for _, l := range lines {
+			select {
+			case input <- l:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+	mappers := make([]<-chan wordCount, workers)
+	for i := range mappers {
+		if local {
+			mappers[i] = localMapper(ctx, eg, input, mapFn, reduceFn)
+		} else {
+			mappers[i] = mapper(ctx, eg, input, mapFn)
+		}
+	}
+
+	var sends int
+	merged := make(chan wordCount)
+	eg.Go(func() error {
+		defer close(merged)
+		for wc := range mergeStreams(ctx, eg, mappers...) {
+			sends++
+			select {
+			case merged <- wc:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+	counts := make(map[string]int)
+	for wc := range aggregate(ctx, eg, merged, reduceFn, false, nil) {
+		counts[wc.word] = wc.count
+	}
+	if err := eg.Wait(); err != nil {
+		tb.Fatal(err)
+	}
+	return counts, sends
+}
+
+// TestLocalAggregate 检查各 mapper 局部聚合后合并的结果与单个 mapper 逐个 token 发送的结果一致
+func TestLocalAggregate(t *testing.T) {
+	lines := zipfLines(2000, 8)
+	want, tokens := countMapped(t, lines, 1, false)
+	got, sends := countMapped(t, lines, 4, true)
+	if !maps.Equal(got, want) {
+		t.Errorf("-local-aggregate counts differ from the sequential counts")
+	}
+	// 每个 worker 对每个 word 至多发送一次
+	if sends > 4*len(want) || sends >= tokens {
+		t.Errorf("-local-aggregate sent %d wordCounts for %d tokens and %d distinct words", sends, tokens, len(want))
+	}
+}
+
+// BenchmarkLocalAggregate 比较逐个 token 发送与局部聚合后发送时的吞吐量和 channel 发送次数
+func BenchmarkLocalAggregate(b *testing.B) {
+	lines := zipfLines(20000, 8)
+	for _, bm := range []struct {
+		name  string
+		local bool
+	}{{"token-per-send", false}, {"local-aggregate", true}} {
+		b.Run(bm.name, func(b *testing.B) {
+			var sends int
+			for i := 0; i < b.N; i++ {
+				_, sends = countMapped(b, lines, 4, bm.local)
+			}
+			b.ReportMetric(float64(sends), "sends/op")
+		})
+	}
+}
+
+// TestScript 检查 -script 与默认分词规则一起使用时保留其他文字的字母（包括组合符号）
+func TestScript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(path, []byte("Καλημέρα κόσμε, hello мир!\nनमस्ते world\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args []string
+		want map[string]int
+	}{
+		{[]string{"-script", "greek"}, map[string]int{"καλημέρα": 1, "κόσμε": 1}},
+		{[]string{"-script", "greek", "-keep-punct"}, map[string]int{"καλημέρα": 1, "κόσμε": 1}},
+		{[]string{"-script", "cyrillic"}, map[string]int{"мир": 1}},
+		{[]string{"-script", "devanagari"}, map[string]int{"नमस्ते": 1}},
+		{[]string{"-script", "latin"}, map[string]int{"hello": 1, "world": 1}},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, "", append([]string{"-f", path}, tt.args...)...)
+		if code != 0 {
+			t.Fatalf("%q: exit status %d: %s", tt.args, code, stderr)
+		}
+		if got := parseCounts(t, stdout); !maps.Equal(got, tt.want) {
+			t.Errorf("%q: counts %v, want %v", tt.args, got, tt.want)
+		}
+	}
+
+	if _, stderr, code := runMain(t, "", "-f", path, "-script", "greek", "-fast-tokenize"); code != 1 || !strings.Contains(stderr, "-script") {
+		t.Errorf("-fast-tokenize with -script: exit status %d, stderr %q, want it to be rejected", code, stderr)
+	}
+}
+
+// TestMaxTokens 检查 -max-tokens 在一行很长的输入中途停止，只输出前 N 个 token 的计数
+func TestMaxTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.txt")
+	// 第一行有 9000 个 token，但仍在 bufio.Scanner 的默认行长度限制之内
+	text := strings.Repeat("alpha beta gamma ", 3000) + "\n" + strings.Repeat("delta ", 1000)
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, code := runMain(t, "", "-f", path, "-max-tokens", "7")
+	if want := map[string]int{"alpha": 3, "beta": 2, "gamma": 2}; code != 0 || !maps.Equal(parseCounts(t, stdout), want) {
+		t.Errorf("exit status %d, counts %v, want %v (stderr %q)", code, parseCounts(t, stdout), want, stderr)
+	}
+
+	// 多个 mapper 并发处理时哪些 token 被计入不确定，但总数不超过上限
+	stdout, stderr, code = runMain(t, "", "-f", path, "-max-tokens", "100", "-map-workers", "4")
+	var total int
+	for _, n := range parseCounts(t, stdout) {
+		total += n
+	}
+	if code != 0 || total != 100 {
+		t.Errorf("-map-workers 4: exit status %d, %d tokens counted, want 100 (stderr %q)", code, total, stderr)
+	}
+}
+
+// TestFoldCaseMatching 检查 -fold-case-matching '[a-z]' 保留全大写缩略词的大小写，同时将首字母大写的单词转换成小写
+func TestFoldCaseMatching(t *testing.T) {
+	text := "NASA launched The rocket\nnasa said THE END\n"
+	stdout, stderr, code := runMain(t, text, "-f", "/dev/stdin", "-fold-case-matching", "[a-z]")
+	if code != 0 {
+		t.Fatalf("exit status %d, stderr %q", code, stderr)
+	}
+	want := map[string]int{"END": 1, "NASA": 1, "THE": 1, "launched": 1, "nasa": 1, "rocket": 1, "said": 1, "the": 1}
+	if got := parseCounts(t, stdout); !maps.Equal(got, want) {
+		t.Errorf("counts = %v, want %v", got, want)
+	}
+}
+
+// TestPreserveCase 检查 -preserve-case 按小写形式计数，输出出现次数最多的原始形式
+func TestPreserveCase(t *testing.T) {
+	text := strings.Repeat("The ", 10) + strings.Repeat("the ", 3) + "cat Cat cat\n"
+	want := "cat               3\nThe              13\n"
+	for _, args := range [][]string{nil, {"-strategy", "heap"}, {"-strategy", "merge"}, {"-map-workers", "3", "-local-aggregate"}} {
+		stdout, stderr, code := runMain(t, text, append([]string{"-f", "/dev/stdin", "-preserve-case"}, args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", args, code, stderr)
+		}
+		if stdout != want {
+			t.Errorf("%v: output %q, want %q", args, stdout, want)
+		}
+	}
+}
+
+// TestPerLineUnique 检查 -per-line-unique 中一行内重复的 word 只计一次，结果为包含该 word 的行数
+func TestPerLineUnique(t *testing.T) {
+	text := "the the the cat\nThe dog dog\ncat\n"
+	want := map[string]int{"cat": 2, "dog": 1, "the": 2}
+	for _, args := range [][]string{nil, {"-strategy", "heap", "-map-workers", "3"}, {"-local-aggregate", "-map-workers", "3"}} {
+		stdout, stderr, code := runMain(t, text, append([]string{"-f", "/dev/stdin", "-per-line-unique"}, args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", args, code, stderr)
+		}
+		if got := parseCounts(t, stdout); !maps.Equal(got, want) {
+			t.Errorf("%v: counts = %v, want %v", args, got, want)
+		}
+	}
+
+	if _, stderr, code := runMain(t, text, "-f", "/dev/stdin", "-per-line-unique", "-fast-tokenize"); code != 1 || !strings.Contains(stderr, "cannot be used with -per-line-unique") {
+		t.Errorf("-fast-tokenize: exit status %d, stderr %q", code, stderr)
+	}
+}
+
+// TestAcronyms 检查 -acronyms 只统计按原始大小写判断为全大写、至少两个字母的 token，输出时保留大写
+func TestAcronyms(t *testing.T) {
+	text := "NASA and HTTP and nasa\nNASA A I AI Nasa\n"
+	stdout, stderr, code := runMain(t, text, "-f", "/dev/stdin", "-acronyms")
+	if code != 0 {
+		t.Fatalf("exit status %d, stderr %q", code, stderr)
+	}
+	if want := "AI                1\nHTTP              1\nNASA              2\n"; stdout != want {
+		t.Errorf("output %q, want %q", stdout, want)
+	}
+}
+
+// TestTruncateLen 检查 -truncate-len 把超过 N 个字符的 word 截断为前 N 个字符后再计数，前缀相同的长词合并
+func TestTruncateLen(t *testing.T) {
+	tests := []struct {
+		input string
+		args  []string
+		want  string
+	}{
+		{"internationalization internationalism international cat\n", []string{"-truncate-len", "10"}, "cat 1\ninternatio 3\n"},
+		// 按字符而不是字节截断
+		{"ééééab ééééac\n", []string{"-truncate-len", "4", "-raw-words"}, "éééé 2\n"},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, tt.input, append([]string{"-f", "/dev/stdin", "-sep", " ", "-pad-width", "0"}, tt.args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("%v: output %q, want %q", tt.args, stdout, tt.want)
+		}
+	}
+
+	if _, stderr, code := runMain(t, "abc\n", "-f", "/dev/stdin", "-truncate-len", "-1"); code != 1 || !strings.Contains(stderr, "-truncate-len must not be negative") {
+		t.Errorf("-truncate-len -1: exit status %d, stderr %q", code, stderr)
+	}
+}
+
+// TestUserRegexLimits 检查启动时拒绝超过 maxPatternLen 字节的正则表达式，-token-regex 每行最多匹配 maxTokensPerLine 个 token
+func TestUserRegexLimits(t *testing.T) {
+	for _, name := range []string{"token-regex", "include-regex", "exclude-regex"} {
+		long := strings.Repeat("a", maxPatternLen+1)
+		_, stderr, code := runMain(t, "x\n", "-f", "/dev/stdin", "-"+name, long)
+		if want := fmt.Sprintf("invalid options: -%s pattern is too long (%d bytes, at most %d)", name, maxPatternLen+1, maxPatternLen); code != 1 || !strings.Contains(stderr, want) {
+			t.Errorf("-%s with %d bytes: exit status %d, stderr %q, want %q", name, maxPatternLen+1, code, stderr, want)
+		}
+		if _, stderr, code := runMain(t, "x\n", "-f", "/dev/stdin", "-"+name, long[1:]); code != 0 {
+			t.Errorf("-%s with %d bytes: exit status %d, stderr %q", name, maxPatternLen, code, stderr)
+		}
+	}
+
+	// -no-line-boundaries 将所有行合并成一行，匹配数超过上限的部分不计数
+	stdout, stderr, code := runMain(t, strings.Repeat("a\n", maxTokensPerLine+100), "-f", "/dev/stdin", "-token-regex", "[a-z]+", "-no-line-boundaries")
+	if code != 0 {
+		t.Fatalf("exit status %d, stderr %q", code, stderr)
+	}
+	if want := map[string]int{"a": maxTokensPerLine}; !maps.Equal(parseCounts(t, stdout), want) {
+		t.Errorf("counts %v, want %v", parseCounts(t, stdout), want)
+	}
+}
+
+// TestNormalizePunct 检查 -normalize-punct 把弯引号、破折号和省略号换成 ASCII 字符，
+// 弯引号中的 don’t 与 don't 计为同一个 word，用破折号连接的两个词被拆开
+func TestNormalizePunct(t *testing.T) {
+	text := "“Don’t” stop—now… don't\n"
+	tests := []struct {
+		args []string
+		want map[string]int
+	}{
+		{nil, map[string]int{"dont": 2, "stopnow": 1}},
+		{[]string{"-normalize-punct"}, map[string]int{"dont": 2, "now": 1, "stop": 1}},
+		{[]string{"-raw-words"}, map[string]int{"don't": 1, "stop—now…": 1, "“don’t”": 1}},
+		{[]string{"-raw-words", "-normalize-punct"}, map[string]int{`"don't"`: 1, "-": 1, "don't": 1, "now...": 1, "stop": 1}},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, text, append([]string{"-f", "/dev/stdin"}, tt.args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if got := parseCounts(t, stdout); !maps.Equal(got, tt.want) {
+			t.Errorf("%v: counts = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+// TestKeepPunct 检查 -keep-punct 把连续的标点作为单独的 word 计数，标点与字母相连时也被拆开
+func TestKeepPunct(t *testing.T) {
+	tests := []struct {
+		text string
+		want map[string]int
+	}{
+		{"hello, world!\n", map[string]int{"hello": 1, ",": 1, "world": 1, "!": 1}},
+		{"hello,world Hello... ok?!\n", map[string]int{"hello": 2, ",": 1, "world": 1, "...": 1, "ok": 1, "?!": 1}},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, tt.text, "-f", "/dev/stdin", "-keep-punct")
+		if code != 0 {
+			t.Fatalf("%q: exit status %d, stderr %q", tt.text, code, stderr)
+		}
+		if got := parseCounts(t, stdout); !maps.Equal(got, tt.want) {
+			t.Errorf("%q: counts = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+// TestStripPossessive 检查 -strip-possessive 去掉结尾的 's 或 ’s，使 dog's 与 dog 合并，dogs' 与 dogs 合并，it's 等缩写保持不变
+func TestStripPossessive(t *testing.T) {
+	text := "dog's dogs' dog dogs it's Dog’s James's.\n"
+	tests := []struct {
+		args []string
+		want map[string]int
+	}{
+		{nil, map[string]int{"dog": 1, "dogs": 4, "its": 1, "jamess": 1}},
+		{[]string{"-strip-possessive"}, map[string]int{"dog": 3, "dogs": 2, "its": 1, "james": 1}},
+		{[]string{"-strip-possessive", "-token-regex", `[\pL'’]+`}, map[string]int{"dog": 3, "dogs'": 1, "dogs": 1, "it's": 1, "james": 1}},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, text, append([]string{"-f", "/dev/stdin"}, tt.args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if got := parseCounts(t, stdout); !maps.Equal(got, tt.want) {
+			t.Errorf("%v: counts = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+// TestFoldSpace 检查不间断空格总是拆开 word，指定 -fold-space 时零宽空格（U+200B、U+2060、U+FEFF）也拆开 word
+func TestFoldSpace(t *testing.T) {
+	text := "one\u00a0two three\u200bfour\u2060five\ufeffsix\n"
+	tests := []struct {
+		args []string
+		want map[string]int
+	}{
+		{[]string{"-raw-words"}, map[string]int{"one": 1, "two": 1, "three\u200bfour\u2060five\ufeffsix": 1}},
+		{nil, map[string]int{"one": 1, "two": 1, "threefourfivesix": 1}},
+		{[]string{"-fast-tokenize"}, map[string]int{"one": 1, "two": 1, "threefourfivesix": 1}},
+		{[]string{"-fold-space", "-raw-words"}, map[string]int{"one": 1, "two": 1, "three": 1, "four": 1, "five": 1, "six": 1}},
+		{[]string{"-fold-space", "-fast-tokenize"}, map[string]int{"one": 1, "two": 1, "three": 1, "four": 1, "five": 1, "six": 1}},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, text, append([]string{"-f", "/dev/stdin"}, tt.args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if got := parseCounts(t, stdout); !maps.Equal(got, tt.want) {
+			t.Errorf("%v: counts = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+// TestCaseBreakdown 检查 -case-breakdown 显示出现次数最多的写法和每种写法的计数，按计数从大到小排列
+func TestCaseBreakdown(t *testing.T) {
+	text := strings.Repeat("the ", 8) + strings.Repeat("The ", 3) + "THE cat Cat\n"
+	want := "Cat               2 (Cat:1, cat:1)\nthe              12 (the:8, The:3, THE:1)\n"
+	for _, args := range [][]string{nil, {"-strategy", "heap"}, {"-map-workers", "3", "-local-aggregate"}} {
+		stdout, stderr, code := runMain(t, text, append([]string{"-f", "/dev/stdin", "-case-breakdown"}, args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", args, code, stderr)
+		}
+		if stdout != want {
+			t.Errorf("%v: output %q, want %q", args, stdout, want)
+		}
+	}
+}
+
+// TestFoldConfusables 检查 -fold-confusables 把看起来与 ASCII 字母相同的西里尔字母和全角字母换成 ASCII 字母，
+// 使拉丁字母拼写的 paypal 与混入西里尔字母的写法合并
+func TestFoldConfusables(t *testing.T) {
+	// 第二个 word 除了最后的 l 都是西里尔字母，第三个 word 中的 a 是西里尔字母
+	text := "paypal \u0440\u0430\u0443\u0440\u0430l p\u0430ypal \uff48\uff45\uff4c\uff4c\uff4f hello\n"
+	tests := []struct {
+		args []string
+		want map[string]int
+	}{
+		{[]string{"-raw-words"}, map[string]int{"paypal": 1, "\u0440\u0430\u0443\u0440\u0430l": 1, "p\u0430ypal": 1, "\uff48\uff45\uff4c\uff4c\uff4f": 1, "hello": 1}},
+		{[]string{"-raw-words", "-fold-confusables"}, map[string]int{"paypal": 3, "hello": 2}},
+		{[]string{"-fold-confusables"}, map[string]int{"paypal": 3, "hello": 2}},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, text, append([]string{"-f", "/dev/stdin"}, tt.args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if got := parseCounts(t, stdout); !maps.Equal(got, tt.want) {
+			t.Errorf("%v: counts = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+// TestCharDigrams 检查 -char-digrams 统计每个 word 内相邻的字母对，不跨越 word，按计数从大到小输出
+func TestCharDigrams(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"the other there\n", "he 3\nth 3\ner 2\not 1\nre 1\n"},
+		// 单个字母的 a 没有字母对，Ab-ba 去掉连字符后为 abba
+		{"banana a Ab-ba\n", "an 2\nba 2\nna 2\nab 1\nbb 1\n"},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, tt.text, "-f", "/dev/stdin", "-char-digrams", "-sep", " ", "-pad-width", "0")
+		if code != 0 {
+			t.Fatalf("%q: exit status %d, stderr %q", tt.text, code, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("%q: output %q, want %q", tt.text, stdout, tt.want)
+		}
+	}
+}
+
+// TestRawWords 检查 -raw-words 只在空白处拆分并保留标点和数字，默认的分词规则会去掉它们
+func TestRawWords(t *testing.T) {
+	text := "C++ and node.js\nc++ v2.0\n"
+	tests := []struct {
+		args []string
+		want map[string]int
+	}{
+		{nil, map[string]int{"c": 2, "and": 1, "nodejs": 1, "v": 1}},
+		{[]string{"-raw-words"}, map[string]int{"c++": 2, "and": 1, "node.js": 1, "v2.0": 1}},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, text, append([]string{"-f", "/dev/stdin"}, tt.args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if got := parseCounts(t, stdout); !maps.Equal(got, tt.want) {
+			t.Errorf("%v: counts = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestBucketRegex(t *testing.T) {
+	text := "error-123 Error-456 error-7x\nwarn-7 errors ok\n"
+	pattern := []string{"-f", "/dev/stdin", "-bucket-regex", `^(error|warn)-\d+$`}
+	tests := []struct {
+		args []string
+		want map[string]int
+	}{
+		// 默认的拆分方式去掉数字和连字符之前匹配整个字段
+		{nil, map[string]int{"error": 2, "errorx": 1, "warn": 1, "errors": 1, "ok": 1}},
+		{[]string{"-raw-words"}, map[string]int{"error": 2, "error-7x": 1, "warn": 1, "errors": 1, "ok": 1}},
+		{[]string{"-bucket-only"}, map[string]int{"error": 2, "warn": 1}},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, text, append(pattern, tt.args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if got := parseCounts(t, stdout); !maps.Equal(got, tt.want) {
+			t.Errorf("%v: counts = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+
+	stdout, stderr, code := runMain(t, text, append(pattern, "-show-forms")...)
+	if code != 0 {
+		t.Fatalf("-show-forms: exit status %d, stderr %q", code, stderr)
+	}
+	if want := "(error-123:1, error-456:1)"; !strings.Contains(stdout, want) {
+		t.Errorf("-show-forms output %q does not contain %q", stdout, want)
+	}
+
+	if _, stderr, code := runMain(t, text, append(pattern, "-fast-tokenize")...); code == 0 {
+		t.Errorf("-fast-tokenize: exit status 0, want an error, stderr %q", stderr)
+	}
+}
+
+// TestFirstLine 检查 -first-line 输出每个 word 第一次出现的行号（从 1 开始，空行也计入），与聚合方式和 mapper 的数量无关
+func TestFirstLine(t *testing.T) {
+	text := "the cat\n\nand the dog\nThe cat sat\ndog\n"
+	want := map[string][2]int{"and": {1, 3}, "cat": {2, 1}, "dog": {2, 3}, "sat": {1, 4}, "the": {3, 1}}
+	for _, args := range [][]string{{"-strategy", "heap"}, {"-strategy", "map"}, {"-map-workers", "4"}, {"-sort", "count"}} {
+		stdout, stderr, code := runMain(t, text, append([]string{"-f", "/dev/stdin", "-first-line"}, args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", args, code, stderr)
+		}
+		got := make(map[string][2]int)
+		for _, line := range strings.Split(strings.TrimSuffix(stdout, "\n"), "\n") {
+			var word string
+			var count, first int
+			if _, err := fmt.Sscan(line, &word, &count, &first); err != nil {
+				t.Fatalf("%v: cannot parse %q: %s", args, line, err)
+			}
+			got[word] = [2]int{count, first}
+		}
+		if !maps.Equal(got, want) {
+			t.Errorf("%v: counts and first lines %v, want %v", args, got, want)
+		}
+	}
+}
+
+// TestPositions 检查 -positions 输出每个 word 第一次出现的字节偏移量，多个输入文件时 -positions 和 -first-line
+// 都取第一个包含该 word 的文件中的位置，与文件的读取顺序无关
+func TestPositions(t *testing.T) {
+	stdout, stderr, code := runMain(t, "the cat sat on the mat\ncat dog\n", "-f", "/dev/stdin", "-positions", "-sep", " ", "-pad-width", "0")
+	if code != 0 {
+		t.Fatalf("exit status %d, stderr %q", code, stderr)
+	}
+	if want := "cat 2 4\ndog 1 27\nmat 1 19\non 1 12\nsat 1 8\nthe 2 0\n"; stdout != want {
+		t.Errorf("output %q, want %q", stdout, want)
+	}
+
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.txt"), filepath.Join(dir, "second.txt")
+	for path, text := range map[string]string{first: "x\nx\na b\n", second: "b c\n"} {
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := "a 1 3 4\nb 2 3 6\nc 1 1 2\nx 2 1 0\n"
+	for _, extra := range [][]string{nil, {"-map-workers", "4"}, {"-strategy", "heap"}} {
+		args := append([]string{"-f", first, "-f", second, "-first-line", "-positions", "-sep", " ", "-pad-width", "0"}, extra...)
+		stdout, stderr, code := runMain(t, "", args...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", extra, code, stderr)
+		}
+		if stdout != want {
+			t.Errorf("%v: output %q, want %q", extra, stdout, want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// memorySampleInterval 是 -report-memory 采样堆内存的间隔，runtime.ReadMemStats 会短暂暂停所有 goroutine，因此间隔不宜过短
+const memorySampleInterval = 50 * time.Millisecond
+
+// peakHeap 记录 -report-memory 采样到的最大 HeapAlloc
+var peakHeap atomic.Uint64
+
+// sampleMemory 定期采样堆内存占用并更新 peakHeap，直到 done 被关闭
+func sampleMemory(done <-chan struct{}) {
+	ticker := time.NewTicker(memorySampleInterval)
+	defer ticker.Stop()
+	for {
+		recordHeap()
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
+
+// recordHeap 读取当前的内存统计，HeapAlloc 超过 peakHeap 时更新 peakHeap
+func recordHeap() runtime.MemStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	for {
+		peak := peakHeap.Load()
+		if m.HeapAlloc <= peak || peakHeap.CompareAndSwap(peak, m.HeapAlloc) {
+			return m
+		}
+	}
+}
+
+// writeMemory 输出采样到的堆内存峰值、累计分配的内存和从操作系统获得的内存，需要在 pipeline 结束后调用。
+// 峰值是按照 memorySampleInterval 采样得到的，持续时间很短的峰值可能被遗漏。
+func writeMemory(w io.Writer) error {
+	m := recordHeap()
+	_, err := fmt.Fprintf(w, "memory: peak heap %s, total allocated %s, obtained from OS %s\n",
+		formatBytes(peakHeap.Load()), formatBytes(m.TotalAlloc), formatBytes(m.Sys))
+	return err
+}
+
+// formatBytes 以 MiB 为单位格式化字节数
+func formatBytes(n uint64) string {
+	return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+}
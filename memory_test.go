@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestWriteMemory 检查 writeMemory 输出的堆内存峰值、累计分配的内存和从操作系统获得的内存都不为 0
+func TestWriteMemory(t *testing.T) {
+	buf := make([]byte, 4<<20)
+	var out bytes.Buffer
+	if err := writeMemory(&out); err != nil {
+		t.Fatal(err)
+	}
+	runtime.KeepAlive(buf)
+
+	var peak, total, sys float64
+	if _, err := fmt.Sscanf(out.String(), "memory: peak heap %f MiB, total allocated %f MiB, obtained from OS %f MiB\n", &peak, &total, &sys); err != nil {
+		t.Fatalf("cannot parse %q: %v", out.String(), err)
+	}
+	if peak < 4 || total < 4 || sys < 4 {
+		t.Errorf("%q reports less than the 4 MiB allocated by the test", out.String())
+	}
+
+	stdout, stderr, code := runMain(t, "alpha beta\n", "-f", "/dev/stdin", "-report-memory")
+	if code != 0 || stdout != "alpha             1\nbeta              1\n" || !strings.HasPrefix(stderr, "memory: peak heap ") {
+		t.Errorf("-report-memory: exit status %d, output %q, stderr %q", code, stdout, stderr)
+	}
+}
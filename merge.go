@@ -0,0 +1,136 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"math/rand"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// fileAggregates 为 -strategy merge 并发读取 paths 中的文件（同时读取的文件数不超过 limit），
+// 每个文件的行经过单独的 mapper 后在该文件自己的 aggregator 中通过 reduce 聚合，输入结束后按照 word 排序输出该文件的部分结果。
+// 返回的每个 channel 对应一个输入文件，可以交给 mergeSorted 按照 word 归并。
+func fileAggregates(ctx context.Context, eg *errgroup.Group, paths []string, limit int, rng *rand.Rand, reduce func(acc, next wordCount) wordCount) []<-chan wordCount {
+	sem := make(chan struct{}, limit)
+	streams := make([]<-chan wordCount, 0, len(paths))
+
+	for i, path := range paths {
+		i, path := i, path
+		// 每个文件使用独立的随机数生成器，避免并发读取时共享 rand.Rand
+		rng := rand.New(rand.NewSource(rng.Int63()))
+		lines := make(chan inputLine)
+		eg.Go(func() error {
+			defer func() { close(lines); logger.Debug("file has been read", "file", path) }()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			err := readFile(ctx, path, i, lines, rng)
+			if err != nil && ctx.Err() == nil && keepGoing {
+				// 与其他聚合方式一样，读取失败的文件已经读到的部分由 failedDiscarder 减去
+				logger.Error("failed to read file, skipping", "file", path, "err", err)
+				recordFailure(i)
+				return nil
+			}
+			return err
+		})
+
+		var input <-chan inputLine = lines
+		if inQuotes {
+			input = quotedText(ctx, eg, lines, singleQuotes)
+		}
+		mapped := mapper(ctx, eg, input, mapFn)
+		ch := make(chan wordCount)
+		streams = append(streams, ch)
+		eg.Go(func() error {
+			defer func() { close(ch); logger.Debug("file aggregator exits", "file", path) }()
+			agg := newAggregator(reduce)
+			for wc := range mapped {
+				agg.add(wc)
+			}
+			return agg.drainSorted(func(wc wordCount) error {
+				select {
+				case ch <- wc:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+		})
+	}
+
+	return streams
+}
+
+// mergeSorted 将多个按照 word 排序的 wordCount 流归并为一个按照 word 排序的流，不同流中相同的 word 相邻输出但不合并，
+// 需要的内存只与流的数量成正比。所有输入流都有数据或已经结束后才能输出第一个结果。
+func mergeSorted(ctx context.Context, eg *errgroup.Group, streams ...<-chan wordCount) <-chan wordCount {
+	ch := make(chan wordCount)
+
+	eg.Go(func() error {
+		defer func() { close(ch); logger.Debug("merger exits") }()
+		h := &mergeHeap{}
+		for _, s := range streams {
+			if wc, ok := <-s; ok {
+				h.heads = append(h.heads, mergeHead{wc, s})
+			}
+		}
+		heap.Init(h)
+
+		for h.Len() > 0 {
+			head := &h.heads[0]
+			select {
+			case ch <- head.wc:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			// 用同一个流的下一个结果替换堆顶，流结束时将其移出堆
+			if wc, ok := <-head.stream; ok {
+				head.wc = wc
+				heap.Fix(h, 0)
+			} else {
+				heap.Pop(h)
+			}
+		}
+		return nil
+	})
+
+	return ch
+}
+
+// mergeHead 是 mergeSorted 中一个输入流当前的第一个结果
+type mergeHead struct {
+	wc     wordCount
+	stream <-chan wordCount
+}
+
+// mergeHeap 是按照 word 排序的 mergeHead 最小堆
+type mergeHeap struct {
+	heads []mergeHead
+}
+
+func (h *mergeHeap) Len() int {
+	return len(h.heads)
+}
+
+func (h *mergeHeap) Less(i, j int) bool {
+	return h.heads[i].wc.word < h.heads[j].wc.word
+}
+
+func (h *mergeHeap) Swap(i, j int) {
+	h.heads[i], h.heads[j] = h.heads[j], h.heads[i]
+}
+
+func (h *mergeHeap) Push(x any) {
+	h.heads = append(h.heads, x.(mergeHead))
+}
+
+func (h *mergeHeap) Pop() any {
+	v := h.heads[len(h.heads)-1]
+	h.heads = h.heads[:len(h.heads)-1]
+	return v
+}
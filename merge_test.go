@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// writeZipfFiles 在临时目录中写入 n 个文件，每个文件包含 zipfLines 生成的 lines 行文本，不同文件的内容不同
+func writeZipfFiles(tb testing.TB, n, lines int) []string {
+	tb.Helper()
+	dir := tb.TempDir()
+	all := zipfLines(n*lines, 8)
+	paths := make([]string, n)
+	for i := range paths {
+		var text strings.Builder
+		for _, l := range all[i*lines : (i+1)*lines] {
+			text.WriteString(l.text)
+			text.WriteByte('\n')
+		}
+		paths[i] = filepath.Join(dir, fmt.Sprintf("%d.txt", i))
+		if err := os.WriteFile(paths[i], []byte(text.String()), 0o644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return paths
+}
+
+// mergeTopN 使用 -strategy merge 的 fileAggregates、mergeSorted 和 reducer 选出 paths 中计数最高的 n 个 word
+func mergeTopN(tb testing.TB, paths []string, n int) []wordCount {
+	tb.Helper()
+	eg, ctx := errgroup.WithContext(context.Background())
+	merged := mergeSorted(ctx, eg, fileAggregates(ctx, eg, paths, 4, rand.New(rand.NewSource(1)), reduceFn)...)
+	var top []wordCount
+	for wc := range reducer(ctx, eg, merged, reduceFn, newTopSelector(n, byCount)) {
+		top = append(top, wc)
+	}
+	if err := eg.Wait(); err != nil {
+		tb.Fatal(err)
+	}
+	return top
+}
+
+// TestMergeTopN 检查按文件聚合后归并得到的前 N 个结果与全局聚合后排序得到的前 N 个结果完全相同
+func TestMergeTopN(t *testing.T) {
+	paths := writeZipfFiles(t, 5, 200)
+	exact := make(map[string]int)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			for _, wc := range mapFn(line) {
+				exact[wc.word] += wc.count
+			}
+		}
+	}
+	var want []wordCount
+	for w, n := range exact {
+		want = append(want, wordCount{word: w, count: n})
+	}
+	sort.Slice(want, func(i, j int) bool { return byCount(want[i], want[j]) })
+
+	for _, n := range []int{1, 10, 50, len(want) + 5} {
+		got := mergeTopN(t, paths, n)
+		if len(got) != min(n, len(want)) {
+			t.Fatalf("-n %d: got %d words, want %d", n, len(got), min(n, len(want)))
+		}
+		for i, wc := range got {
+			if wc.word != want[i].word || wc.count != want[i].count {
+				t.Errorf("-n %d: result %d is %s %d, want %s %d", n, i, wc.word, wc.count, want[i].word, want[i].count)
+			}
+		}
+	}
+}
+
+func TestMergeSorted(t *testing.T) {
+	streams := []<-chan wordCount{
+		feed(wordCount{word: "a", count: 1}, wordCount{word: "c", count: 1}),
+		feed(),
+		feed(wordCount{word: "a", count: 2}, wordCount{word: "b", count: 1}, wordCount{word: "d", count: 1}),
+	}
+	var got []string
+	for _, wc := range collect(t, func(ctx context.Context, eg *errgroup.Group) <-chan wordCount {
+		return mergeSorted(ctx, eg, streams...)
+	}) {
+		got = append(got, fmt.Sprintf("%s%d", wc.word, wc.count))
+	}
+	// 不同流中相同的 word 相邻输出但不合并
+	if want := "a1 a2 b1 c1 d1"; strings.Join(got, " ") != want && strings.Join(got, " ") != "a2 a1 b1 c1 d1" {
+		t.Errorf("merged %v, want %s", got, want)
+	}
+}
+
+// BenchmarkMergeTopN 比较多个文件上 -n 10 的全局 map 聚合与按文件聚合后归并的耗时和内存分配。
+// 归并时不会建立合并所有文件的 map，选择阶段只保留 10 个结果，但归并开始时所有文件的部分结果都在内存中
+func BenchmarkMergeTopN(b *testing.B) {
+	paths := writeZipfFiles(b, 8, 5000)
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			eg, ctx := errgroup.WithContext(context.Background())
+			input := getInputStream(ctx, eg, paths, 4, rand.New(rand.NewSource(1)))
+			for range aggregate(ctx, eg, mapper(ctx, eg, input, mapFn), reduceFn, false, newTopSelector(10, byCount)) {
+			}
+			if err := eg.Wait(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("merge", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			mergeTopN(b, paths, 10)
+		}
+	})
+}
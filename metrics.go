@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets 是请求耗时直方图的桶上界（秒），与 Prometheus 客户端库的默认值相同
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metrics 记录 -serve 模式下的运行指标
+type metrics struct {
+	requests atomic.Int64
+	failures atomic.Int64
+
+	mu      sync.Mutex
+	buckets []int64 // buckets[i] 为耗时不超过 latencyBuckets[i] 的请求数（非累计）
+	sum     float64
+}
+
+var serverMetrics = &metrics{buckets: make([]int64, len(latencyBuckets))}
+
+// observe 记录一个请求的处理耗时
+func (m *metrics) observe(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests.Add(1)
+	m.sum += d.Seconds()
+	for i, le := range latencyBuckets {
+		if d.Seconds() <= le {
+			m.buckets[i]++
+			break
+		}
+	}
+}
+
+// writeTo 以 Prometheus 文本格式输出所有指标
+func (m *metrics) writeTo(w io.Writer) error {
+	counters := []struct {
+		name, help string
+		value      int64
+	}{
+		{"wc_requests_total", "Number of count requests served.", m.requests.Load()},
+		{"wc_request_failures_total", "Number of count requests that failed.", m.failures.Load()},
+		{"wc_lines_total", "Number of input lines read.", linesRead.Load()},
+		{"wc_bytes_total", "Number of input bytes read.", bytesRead.Load()},
+		{"wc_tokens_total", "Number of tokens processed.", tokensMapped.Load()},
+	}
+	for _, c := range counters {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", c.name, c.help, c.name, c.name, c.value); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	const name = "wc_request_duration_seconds"
+	if _, err := fmt.Fprintf(w, "# HELP %s Latency of count requests.\n# TYPE %s histogram\n", name, name); err != nil {
+		return err
+	}
+	var cumulative int64
+	for i, le := range latencyBuckets {
+		cumulative += m.buckets[i]
+		if _, err := fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, strconv.FormatFloat(le, 'g', -1, 64), cumulative); err != nil {
+			return err
+		}
+	}
+	// 超过最大桶上界的请求只计入 +Inf
+	total := m.requests.Load()
+	_, err := fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %g\n%s_count %d\n", name, total, name, m.sum, name, total)
+	return err
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = serverMetrics.writeTo(w)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrapeMetrics 请求 url 的 /metrics，返回每个样本的取值以及所有 # TYPE 行
+func scrapeMetrics(t *testing.T, url string) (samples map[string]float64, types []string) {
+	t.Helper()
+	resp, err := http.Get(url + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type %q, want the Prometheus text format", ct)
+	}
+
+	samples = make(map[string]float64)
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "# TYPE ") {
+			types = append(types, strings.TrimPrefix(line, "# TYPE "))
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, " ")
+		v, err := strconv.ParseFloat(value, 64)
+		if !ok || err != nil {
+			t.Fatalf("invalid sample line %q", line)
+		}
+		samples[name] = v
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return samples, types
+}
+
+// TestMetrics 检查 /metrics 的输出格式，以及一个 /count 请求之后请求数、token 数和耗时直方图的增加
+func TestMetrics(t *testing.T) {
+	restoreFlags(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/count", handleCount)
+	mux.HandleFunc("/metrics", handleMetrics)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	before, types := scrapeMetrics(t, srv.URL)
+	for _, want := range []string{
+		"wc_requests_total counter", "wc_request_failures_total counter", "wc_lines_total counter",
+		"wc_bytes_total counter", "wc_tokens_total counter", "wc_request_duration_seconds histogram",
+	} {
+		if !strings.Contains(strings.Join(types, "\n"), want) {
+			t.Errorf("# TYPE lines %q do not declare %q", types, want)
+		}
+	}
+
+	resp, err := http.Post(srv.URL+"/count", "text/plain", strings.NewReader("the cat\nthe dog\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/count: status %d: %s", resp.StatusCode, body)
+	}
+
+	after, _ := scrapeMetrics(t, srv.URL)
+	deltas := map[string]float64{
+		"wc_requests_total":                             1,
+		"wc_request_failures_total":                     0,
+		"wc_lines_total":                                2,
+		"wc_bytes_total":                                16,
+		"wc_tokens_total":                               4,
+		"wc_request_duration_seconds_count":             1,
+		`wc_request_duration_seconds_bucket{le="+Inf"}`: 1,
+	}
+	for name, want := range deltas {
+		if got := after[name] - before[name]; got != want {
+			t.Errorf("%s increased by %g, want %g", name, got, want)
+		}
+	}
+	if after["wc_request_duration_seconds_sum"] <= before["wc_request_duration_seconds_sum"] {
+		t.Errorf("wc_request_duration_seconds_sum did not increase: %g -> %g",
+			before["wc_request_duration_seconds_sum"], after["wc_request_duration_seconds_sum"])
+	}
+
+	// 直方图的桶是累计的，上界越大计数越多
+	var prev float64
+	for _, le := range latencyBuckets {
+		name := `wc_request_duration_seconds_bucket{le="` + strconv.FormatFloat(le, 'g', -1, 64) + `"}`
+		v, ok := after[name]
+		if !ok {
+			t.Fatalf("missing %s", name)
+		}
+		if v < prev {
+			t.Errorf("%s = %g is less than the previous bucket %g", name, v, prev)
+		}
+		prev = v
+	}
+	if inf := after[`wc_request_duration_seconds_bucket{le="+Inf"}`]; inf < prev || inf != after["wc_request_duration_seconds_count"] {
+		t.Errorf("+Inf bucket %g, want the count %g", inf, after["wc_request_duration_seconds_count"])
+	}
+}
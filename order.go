@@ -0,0 +1,116 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+)
+
+// sortOrders 是 -sort 支持的排序方式
+var sortOrders = map[string]func(a, b wordCount) bool{
+	"word":   byWord,
+	"count":  byCount,
+	"length": byLength,
+}
+
+// tieBreaks 是 -tiebreak 支持的 count 相同时的排序方式
+var tieBreaks = map[string]func(a, b wordCount) bool{
+	"alpha":      byWord,
+	"length":     byLength,
+	"first-seen": byFirstSeen,
+}
+
+// tieBreaker 是 byCount 在 count 相同时使用的排序方式
+var tieBreaker = byWord
+
+// byWord 按照 word 的字典序排序
+func byWord(a, b wordCount) bool {
+	return a.word < b.word
+}
+
+// byCount 按照 count 从大到小排序，count 相同时按照 tieBreaker 排序
+func byCount(a, b wordCount) bool {
+	if a.count != b.count {
+		return a.count > b.count
+	}
+	return tieBreaker(a, b)
+}
+
+// byLength 按照 word 的字符长度从短到长排序，长度相同时按照 word 的字典序排序
+func byLength(a, b wordCount) bool {
+	if la, lb := wordLen(a.word), wordLen(b.word); la != lb {
+		return la < lb
+	}
+	return a.word < b.word
+}
+
+// reverseOrder 返回与 less 相反的排序方式
+func reverseOrder(less func(a, b wordCount) bool) func(a, b wordCount) bool {
+	return func(a, b wordCount) bool { return less(b, a) }
+}
+
+// byFirstSeen 按照 word 在输入中首次出现的先后顺序排序
+func byFirstSeen(a, b wordCount) bool {
+	if a.seq != b.seq {
+		return a.seq < b.seq
+	}
+	return a.word < b.word
+}
+
+// sortKeyCompares 是 -sort-keys 支持的排序键，按照升序比较两个 wordCount
+var sortKeyCompares = map[string]func(a, b wordCount) int{
+	"word":  func(a, b wordCount) int { return cmp.Compare(a.word, b.word) },
+	"count": func(a, b wordCount) int { return cmp.Compare(a.count, b.count) },
+	"length": func(a, b wordCount) int {
+		return cmp.Compare(wordLen(a.word), wordLen(b.word))
+	},
+	"first-seen": func(a, b wordCount) int { return cmp.Compare(a.seq, b.seq) },
+}
+
+// sortKeyOrder 是 -sort-keys 指定的排序方式，不为 nil 时代替 -sort
+var sortKeyOrder func(a, b wordCount) bool
+
+// parseSortKeys 解析 -sort-keys 的值（如 `count:asc,length:desc,word:asc`），返回依次按照各个键比较的排序方式。
+// 方向默认为 asc，所有键都相同时按照 word 的字典序排序，使结果与排序算法无关。
+func parseSortKeys(spec string) (func(a, b wordCount) bool, error) {
+	type sortKey struct {
+		compare func(a, b wordCount) int
+		desc    bool
+	}
+	var keys []sortKey
+	for _, field := range strings.Split(spec, ",") {
+		name, dir, _ := strings.Cut(strings.TrimSpace(field), ":")
+		compare, ok := sortKeyCompares[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown sort key %q, must be word, count, length or first-seen", name)
+		}
+		if dir != "" && dir != "asc" && dir != "desc" {
+			return nil, fmt.Errorf("unknown direction %q of sort key %q, must be asc or desc", dir, name)
+		}
+		keys = append(keys, sortKey{compare, dir == "desc"})
+	}
+
+	return func(a, b wordCount) bool {
+		for _, key := range keys {
+			c := key.compare(a, b)
+			if key.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return a.word < b.word
+	}, nil
+}
+
+// trackFirstSeen 判断是否需要记录每个 word 首次出现的顺序。
+// -first-line 和 -positions 也需要它，从而在多个输入文件时报告第一个包含该 word 的文件中的位置
+func trackFirstSeen() bool {
+	return tieBreak == "first-seen" || strings.Contains(sortKeys, "first-seen") || firstLine || positions
+}
+
+// needsResort 判断合并后按照 word 排序的结果是否需要重新排序或截取
+func needsResort() bool {
+	return topN > 0 || sortOrder != "word" || reverse || sortKeyOrder != nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestTieBreaks(t *testing.T) {
+	defer func() { tieBreaker = byWord }()
+	results := []wordCount{
+		{word: "pear", count: 2, seq: firstSeenSeq(1, 0)},
+		{word: "fig", count: 2, seq: firstSeenSeq(0, 40)},
+		{word: "banana", count: 2, seq: firstSeenSeq(0, 5)},
+		{word: "kiwi", count: 2, seq: firstSeenSeq(0, 90)},
+		{word: "apple", count: 3, seq: firstSeenSeq(2, 0)},
+	}
+	tests := []struct {
+		tieBreak string
+		want     []string
+	}{
+		{"alpha", []string{"apple", "banana", "fig", "kiwi", "pear"}},
+		{"length", []string{"apple", "fig", "kiwi", "pear", "banana"}},
+		// 先按照文件的顺序，再按照在文件中的位置
+		{"first-seen", []string{"apple", "banana", "fig", "kiwi", "pear"}},
+	}
+	for _, tt := range tests {
+		tieBreaker = tieBreaks[tt.tieBreak]
+		sorted := slices.Clone(results)
+		sort.Slice(sorted, func(i, j int) bool { return byCount(sorted[i], sorted[j]) })
+		var got []string
+		for _, wc := range sorted {
+			got = append(got, wc.word)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("-tiebreak %s: got %v, want %v", tt.tieBreak, got, tt.want)
+		}
+	}
+}
+
+// TestTieBreakFirstSeenDeterministic 检查并发读取多个文件和多个 mapper 时 first-seen 的顺序仍然与输入顺序一致
+func TestTieBreakFirstSeenDeterministic(t *testing.T) {
+	dir := t.TempDir()
+	texts := []string{"zeta beta\nomega\n", "alpha zeta\ngamma\n", "delta\n"}
+	var args []string
+	for i, text := range texts {
+		path := filepath.Join(dir, string(rune('a'+i))+".txt")
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		args = append(args, "-f", path)
+	}
+	args = append(args, "-sort", "count", "-tiebreak", "first-seen", "-sep", " ", "-pad-width", "0")
+
+	want := "zeta 2\nbeta 1\nomega 1\nalpha 1\ngamma 1\ndelta 1\n"
+	for _, extra := range [][]string{{"-strategy", "heap", "-map-workers", "4"}, {"-strategy", "map", "-map-workers", "4"}, {"-fast-tokenize"}} {
+		for i := 0; i < 5; i++ {
+			stdout, stderr, code := runMain(t, "", append(args, extra...)...)
+			if code != 0 {
+				t.Fatalf("exit status %d: %s", code, stderr)
+			}
+			if stdout != want {
+				t.Fatalf("%v run %d: output %q, want %q", extra, i, stdout, want)
+			}
+		}
+	}
+}
+
+// TestSortLength 检查 -sort length 按字符数从短到长排序，长度相同时按字母顺序，-reverse 时从长到短
+func TestSortLength(t *testing.T) {
+	tests := []struct {
+		input string
+		args  []string
+		want  string
+	}{
+		{"bb a ccc dd b aaa ba bb\n", nil, "a 1\nb 1\nba 1\nbb 2\ndd 1\naaa 1\nccc 1\n"},
+		{"bb a ccc dd b aaa ba bb\n", []string{"-reverse"}, "ccc 1\naaa 1\ndd 1\nbb 2\nba 1\nb 1\na 1\n"},
+		// 按字符而不是字节计算长度
+		{"ééé ab c abcd\n", []string{"-raw-words"}, "c 1\nab 1\nééé 1\nabcd 1\n"},
+	}
+	for _, tt := range tests {
+		args := append([]string{"-f", "/dev/stdin", "-sort", "length", "-sep", " ", "-pad-width", "0"}, tt.args...)
+		stdout, stderr, code := runMain(t, tt.input, args...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("%v: output %q, want %q", tt.args, stdout, tt.want)
+		}
+	}
+}
+
+// TestTop1 检查 -top1 只输出计数最大的 word，计数相同时取字母顺序最前的 word
+func TestTop1(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"the cat the dog\ncat the\n", "the               3\n"},
+		{"dog cat cat dog bird\n", "cat               2\n"},
+		{"zebra apple\n", "apple             1\n"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		for _, extra := range [][]string{nil, {"-map-workers", "4"}} {
+			stdout, stderr, code := runMain(t, tt.input, append([]string{"-f", "/dev/stdin", "-top1"}, extra...)...)
+			if code != 0 {
+				t.Fatalf("%q %v: exit status %d, stderr %q", tt.input, extra, code, stderr)
+			}
+			if stdout != tt.want {
+				t.Errorf("%q %v: output %q, want %q", tt.input, extra, stdout, tt.want)
+			}
+		}
+	}
+}
+
+// TestSortKeys 检查 -sort-keys 依次按照每个键和方向排序，前面的键相同时才比较后面的键，无效的键在启动时报错
+func TestSortKeys(t *testing.T) {
+	input := "bb a ccc dd b aaa ba bb aaa\n"
+	tests := []struct {
+		keys string
+		want string
+	}{
+		{"count:asc,length:desc,word:asc", "ccc 1\nba 1\ndd 1\na 1\nb 1\naaa 2\nbb 2\n"},
+		{"count:desc,word:desc", "bb 2\naaa 2\ndd 1\nccc 1\nba 1\nb 1\na 1\n"},
+		{"count:desc,first-seen", "bb 2\naaa 2\na 1\nccc 1\ndd 1\nb 1\nba 1\n"},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, input, "-f", "/dev/stdin", "-sort-keys", tt.keys, "-sep", " ", "-pad-width", "0")
+		if code != 0 {
+			t.Fatalf("%s: exit status %d, stderr %q", tt.keys, code, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("%s: output %q, want %q", tt.keys, stdout, tt.want)
+		}
+	}
+
+	for keys, want := range map[string]string{
+		"size":     `unknown sort key "size"`,
+		"count:up": `unknown direction "up" of sort key "count"`,
+	} {
+		if _, stderr, code := runMain(t, input, "-f", "/dev/stdin", "-sort-keys", keys); code != 1 || !strings.Contains(stderr, "invalid -sort-keys: "+want) {
+			t.Errorf("%s: exit status %d, stderr %q", keys, code, stderr)
+		}
+	}
+}
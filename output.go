@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/protobuf/encoding/protodelim"
+
+	"github.com/TomCN0803/wc-example/wordcount"
+)
+
+// outputFormats 是 -format 支持的输出格式
+var outputFormats = []string{"text", "md", "html", "wordcloud", "protobuf", "msgpack", "ndjson", "json", "json-summary", "nul", "data"}
+
+// streamingFormats 是逐条输出记录的格式，每条记录输出后（或按 -flush-interval 定期）刷新缓冲区，
+// 其他格式只在输出结束时刷新一次
+var streamingFormats = map[string]bool{"ndjson": true}
+
+var (
+	// dict 是 -dict 指定的词典，不为 nil 时不在词典中的 word 会被标记出来
+	dict map[string]bool
+	// redactSet 是 -redact 指定的词表，其中的 word 在输出时会被替换成星号
+	redactSet map[string]bool
+)
+
+// displayWord 返回 wc 在输出中显示的形式，需要屏蔽的 word 的每个字符都会替换成 `*`，计数不受影响
+func displayWord(wc wordCount) string {
+	w := wc.display()
+	if redactSet[wc.word] {
+		return strings.Repeat("*", wordLen(w))
+	}
+	return w
+}
+
+// outputWriter 是可以被多个 goroutine 并发写入和刷新的带缓冲输出
+type outputWriter struct {
+	mu     sync.Mutex
+	bw     *bufio.Writer
+	gz     *gzip.Writer
+	closer io.Closer
+}
+
+func newOutputWriter(w io.Writer) *outputWriter {
+	return &outputWriter{bw: bufio.NewWriter(w)}
+}
+
+// newGzipOutputWriter 创建经过 gzip 压缩后写入 w 的输出
+func newGzipOutputWriter(w io.Writer) *outputWriter {
+	gz := gzip.NewWriter(w)
+	return &outputWriter{bw: bufio.NewWriter(gz), gz: gz}
+}
+
+// createOutput 创建写入文件 path 的输出，path 为空或为 "-" 时写入标准输出。
+// compress 为 true 或 path 以 .gz 结尾时输出经过 gzip 压缩。
+func createOutput(path string, compress bool) (*outputWriter, error) {
+	compress = compress || strings.HasSuffix(path, ".gz")
+	if path == "" || path == "-" {
+		if compress {
+			return newGzipOutputWriter(os.Stdout), nil
+		}
+		return newOutputWriter(os.Stdout), nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	o := newOutputWriter(f)
+	if compress {
+		o = newGzipOutputWriter(f)
+	}
+	o.closer = f
+	return o, nil
+}
+
+func (o *outputWriter) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.bw.Write(p)
+}
+
+// Flush 刷新缓冲区，压缩输出时同时刷新 gzip 中已经压缩的数据
+func (o *outputWriter) Flush() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.bw.Flush(); err != nil {
+		return err
+	}
+	if o.gz != nil {
+		return o.gz.Flush()
+	}
+	return nil
+}
+
+// Close 刷新缓冲区，压缩输出时写入 gzip 的结尾，输出为文件时关闭文件
+func (o *outputWriter) Close() error {
+	o.mu.Lock()
+	err := o.bw.Flush()
+	if o.gz != nil {
+		err = errors.Join(err, o.gz.Close())
+	}
+	o.mu.Unlock()
+	if o.closer != nil {
+		err = errors.Join(err, o.closer.Close())
+	}
+	return err
+}
+
+// flushEvery 每隔 interval 刷新一次 o，直到 done 被关闭
+func (o *outputWriter) flushEvery(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := o.Flush(); err != nil {
+				logger.Warn("failed to flush output", "err", err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// flushRecord 在流式输出格式下、没有设置 -flush-interval 时，每输出一条记录就刷新 w
+func flushRecord(w io.Writer) error {
+	if f, ok := w.(interface{ Flush() error }); ok && flushInterval == 0 {
+		return f.Flush()
+	}
+	return nil
+}
+
+// writeResults 按照 -format 指定的格式将 wordCount 流写入 w，run 为 -format json-summary 输出的运行统计。
+// 需要在 eg 的 goroutine 中调用。
+func writeResults(ctx context.Context, eg *errgroup.Group, w io.Writer, input <-chan wordCount, run *runStats) error {
+	sink := newOutputSink(ctx, eg, w, run)
+	for wc := range input {
+		if err := sink.Write(wc); err != nil {
+			_ = sink.Close()
+			return err
+		}
+	}
+	return sink.Close()
+}
+
+// writeUniqueCount 只输出不同 word 的数量
+func writeUniqueCount(w io.Writer, input <-chan wordCount) error {
+	var n int
+	for range input {
+		n++
+	}
+	_, err := fmt.Fprintln(w, n)
+	return err
+}
+
+// writeVocab 每行输出一个不同的 word，不输出计数；-format nul 时每个 word 以 NUL 字节结尾
+func writeVocab(w io.Writer, input <-chan wordCount) error {
+	end := "\n"
+	if format == "nul" {
+		end = "\x00"
+	}
+	for wc := range input {
+		if _, err := io.WriteString(w, wc.word+end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFreqTable 输出对齐的频率表：排名、word、计数以及占所有 word 总计数的百分比。
+// 总计数在过滤和截取前 N 个之前统计，因此 -n 不影响百分比。
+func writeFreqTable(w io.Writer, input <-chan wordCount) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "rank\tword\tcount\tfrequency"); err != nil {
+		return err
+	}
+
+	var rank int
+	for wc := range input {
+		rank++
+		var freq float64
+		if total := totalCount.Load(); total > 0 {
+			freq = float64(wc.count) / float64(total) * 100
+		}
+		if _, err := fmt.Fprintf(tw, "%d\t%s\t%d\t%.2f%%\n", rank, displayWord(wc), wc.count, freq); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+// column 是表格类输出中 count 之后的附加列
+type column struct {
+	name  string
+	width int // 文本输出中右对齐的宽度
+	value func(wc wordCount) string
+}
+
+// extraColumns 返回通过 flag 启用的附加列
+func extraColumns() []column {
+	var cols []column
+	if firstLine {
+		cols = append(cols, column{"line", 6, func(wc wordCount) string { return strconv.Itoa(wc.line) }})
+	}
+	if positions {
+		cols = append(cols, column{"offset", 8, func(wc wordCount) string { return strconv.FormatInt(wc.offset, 10) }})
+	}
+	if bytesPerWord {
+		// 多字节字符的 word 的字节数大于其字符数
+		cols = append(cols, column{"bytes", 6, func(wc wordCount) string { return strconv.Itoa(len(wc.display())) }})
+	}
+	if caseBreakdown {
+		cols = append(cols, column{"forms", 0, func(wc wordCount) string { return countBreakdown(wc.forms) }})
+	}
+	if showForms {
+		cols = append(cols, column{"members", 0, func(wc wordCount) string { return countBreakdown(wc.members) }})
+	}
+	if sourceBreakdown {
+		cols = append(cols, column{"sources", 0, sourceBreakdownOf})
+	}
+	return cols
+}
+
+// sourceNames 是由 main 设置的输入文件列表，用于 -source-breakdown 显示文件名
+var sourceNames []string
+
+// sourceBreakdownOf 返回 wc 在每个输入文件中的计数，按照计数从多到少排列，如 `(a.txt:40, b.txt:10)`
+func sourceBreakdownOf(wc wordCount) string {
+	counts := make(map[string]int, len(wc.sources))
+	for file, n := range wc.sources {
+		counts[sourceNames[file]] += n
+	}
+	return countBreakdown(counts)
+}
+
+// countBreakdown 返回 counts 中的各种写法及其出现次数，按照次数从多到少排列，如 `(the:80, The:18, THE:2)`
+func countBreakdown(counts map[string]int) string {
+	forms := make([]string, 0, len(counts))
+	for form := range counts {
+		forms = append(forms, form)
+	}
+	sort.Slice(forms, func(i, j int) bool {
+		if ni, nj := counts[forms[i]], counts[forms[j]]; ni != nj {
+			return ni > nj
+		}
+		return forms[i] < forms[j]
+	})
+	for i, form := range forms {
+		forms[i] = form + ":" + strconv.Itoa(counts[form])
+	}
+	return "(" + strings.Join(forms, ", ") + ")"
+}
+
+// initialGroup 返回 word 首字母的大写形式，首字符不是字母时返回 "#"
+func initialGroup(word string) string {
+	r, _ := utf8.DecodeRuneInString(word)
+	if !unicode.IsLetter(r) {
+		return "#"
+	}
+	return string(unicode.ToUpper(r))
+}
+
+// textColumns 拼接文本输出的两列：word 列按 -pad-width 左对齐，两列之间插入 -sep，
+// 有对齐时 value 列按 width 右对齐。word 超出 -pad-width 且没有分隔符时至少保留一个空格。
+func textColumns(word, value string, width int) string {
+	if padWidth <= 0 {
+		return word + separator + value
+	}
+
+	s := fmt.Sprintf("%-*s%s%*s", padWidth, word, separator, width, value)
+	if separator == "" && utf8.RuneCountInString(word) >= padWidth && len(value) >= width {
+		s = word + " " + value
+	}
+	return s
+}
+
+// writeMarkdown 输出 GitHub 风格的 Markdown 表格
+func writeMarkdown(w io.Writer, input <-chan wordCount) error {
+	cols := extraColumns()
+	header, sep := "| word | count |", "| --- | ---: |"
+	for _, col := range cols {
+		header, sep = header+" "+col.name+" |", sep+" ---: |"
+	}
+	if _, err := fmt.Fprintf(w, "%s\n%s\n", header, sep); err != nil {
+		return err
+	}
+
+	for wc := range input {
+		row := "| " + escapeMarkdown(displayWord(wc)) + " | " + strconv.Itoa(wc.count) + " |"
+		for _, col := range cols {
+			row += " " + col.value(wc) + " |"
+		}
+		if _, err := fmt.Fprintln(w, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escapeMarkdown 转义 Markdown 表格单元格中的 `|` 和 `\`
+func escapeMarkdown(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "|", `\|`).Replace(s)
+}
+
+// writeHTML 输出一个 HTML 表格片段，指定 -html-standalone 时输出完整的 HTML 文档
+func writeHTML(w io.Writer, input <-chan wordCount) error {
+	var b strings.Builder
+	if htmlStandalone {
+		b.WriteString("<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>word count</title></head>\n<body>\n")
+	}
+	cols := extraColumns()
+	b.WriteString("<table>\n<tr><th>word</th><th>count</th>")
+	for _, col := range cols {
+		b.WriteString("<th>" + col.name + "</th>")
+	}
+	b.WriteString("</tr>\n")
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+
+	for wc := range input {
+		row := "<tr><td>" + html.EscapeString(displayWord(wc)) + "</td><td>" + strconv.Itoa(wc.count) + "</td>"
+		for _, col := range cols {
+			row += "<td>" + col.value(wc) + "</td>"
+		}
+		if _, err := io.WriteString(w, row+"</tr>\n"); err != nil {
+			return err
+		}
+	}
+
+	footer := "</table>\n"
+	if htmlStandalone {
+		footer += "</body>\n</html>\n"
+	}
+	_, err := io.WriteString(w, footer)
+	return err
+}
+
+// cloudWord 是词云前端库常用的输入格式
+type cloudWord struct {
+	Text   string  `json:"text"`
+	Weight float64 `json:"weight"`
+}
+
+// writeWordCloud 输出词云所需的 JSON 数组，-wordcloud-scale log 时权重为 ln(1+count)
+func writeWordCloud(w io.Writer, input <-chan wordCount) error {
+	words := make([]cloudWord, 0)
+	for wc := range input {
+		weight := float64(wc.count)
+		if wordCloudScale == "log" {
+			weight = math.Log1p(weight)
+		}
+		words = append(words, cloudWord{Text: displayWord(wc), Weight: weight})
+	}
+
+	return json.NewEncoder(w).Encode(words)
+}
+
+// writeProtobuf 将每个结果编码成 wordcount/wordcount.proto 中定义的 WordCount 消息，
+// 每条消息前带有 varint 编码的消息长度（protodelim 的格式）
+func writeProtobuf(w io.Writer, input <-chan wordCount) error {
+	var msg wordcount.WordCount
+	for wc := range input {
+		msg.Word, msg.Count = displayWord(wc), int64(wc.count)
+		if _, err := protodelim.MarshalTo(w, &msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMsgpack 将每个结果编码成一个 MessagePack map：{"word": <str>, "count": <int>}
+func writeMsgpack(w io.Writer, input <-chan wordCount) error {
+	enc := msgpack.NewEncoder(w)
+	enc.UseCompactInts(true)
+	for wc := range input {
+		if err := enc.Encode(jsonWordCount{displayWord(wc), wc.count}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeState 以 `word<TAB>count` 的格式输出计数结果，与 -format 无关，可以通过 -merge-in 无损地重新加载
+func writeState(w io.Writer, input <-chan wordCount) error {
+	for wc := range input {
+		if _, err := fmt.Fprintf(w, "%s\t%d\n", wc.word, wc.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonWordCount 是 JSON 类输出格式和 MessagePack 输出中的一条结果
+type jsonWordCount struct {
+	Word  string `json:"word" msgpack:"word"`
+	Count int    `json:"count" msgpack:"count"`
+}
+
+// writeJSON 输出一个 JSON 数组：[{"word": ..., "count": ...}, ...]
+func writeJSON(w io.Writer, input <-chan wordCount) error {
+	results := make([]jsonWordCount, 0)
+	for wc := range input {
+		results = append(results, jsonWordCount{displayWord(wc), wc.count})
+	}
+	return json.NewEncoder(w).Encode(results)
+}
+
+// summaryMeta 是 -format json-summary 输出中的元数据
+type summaryMeta struct {
+	Files           []string          `json:"files"`
+	Lines           int64             `json:"lines"`
+	Bytes           int64             `json:"bytes"`
+	Tokens          int64             `json:"tokens"`
+	Distinct        int64             `json:"distinct"`
+	DurationSeconds float64           `json:"duration_seconds"`
+	Options         map[string]string `json:"options"`
+}
+
+// writeJSONSummary 输出一个包含元数据和计数结果的 JSON 对象：{"meta": {...}, "counts": [...]}，元数据取自 run。
+// 输入结束时所有 mapper 都已经退出，此时读取的计数器是完整的。
+func writeJSONSummary(w io.Writer, input <-chan wordCount, run *runStats) error {
+	counts := make([]jsonWordCount, 0)
+	for wc := range input {
+		counts = append(counts, jsonWordCount{displayWord(wc), wc.count})
+	}
+
+	// 只记录显式设置（命令行、环境变量或配置文件）的选项
+	options := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) { options[f.Name] = f.Value.String() })
+	meta := summaryMeta{
+		Files:           run.files,
+		Lines:           run.lines.Load(),
+		Bytes:           run.bytes.Load(),
+		Tokens:          run.tokens.Load(),
+		Distinct:        run.distinct.Load(),
+		DurationSeconds: time.Since(run.start).Seconds(),
+		Options:         options,
+	}
+	return json.NewEncoder(w).Encode(struct {
+		Meta   summaryMeta     `json:"meta"`
+		Counts []jsonWordCount `json:"counts"`
+	}{meta, counts})
+}
@@ -0,0 +1,575 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protodelim"
+
+	"github.com/TomCN0803/wc-example/wordcount"
+)
+
+// feed 返回依次输出 results 的 channel
+func feed(results ...wordCount) <-chan wordCount {
+	ch := make(chan wordCount, len(results))
+	for _, wc := range results {
+		ch <- wc
+	}
+	close(ch)
+	return ch
+}
+
+// sampleCounts 是测试输出格式使用的计数，包含需要多字节长度前缀的长 word 和较大的计数
+var sampleCounts = map[string]int{
+	"the":                                  300,
+	"fox":                                  1,
+	"naïve":                                2,
+	string(bytes.Repeat([]byte("x"), 300)): 70000,
+}
+
+func sampleResults() []wordCount {
+	var results []wordCount
+	for w, n := range sampleCounts {
+		results = append(results, wordCount{word: w, count: n})
+	}
+	return results
+}
+
+func TestWriteProtobufRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeProtobuf(&buf, feed(sampleResults()...)); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]int)
+	r := bufio.NewReader(&buf)
+	for {
+		var msg wordcount.WordCount
+		err := protodelim.UnmarshalFrom(r, &msg)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[msg.GetWord()] += int(msg.GetCount())
+	}
+	if !maps.Equal(got, sampleCounts) {
+		t.Errorf("decoded %v, want %v", got, sampleCounts)
+	}
+}
+
+func TestWriteMsgpackRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeMsgpack(&buf, feed(sampleResults()...)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 每条结果都是一个独立的 map，按照 schema-less 的方式解码
+	got := make(map[string]int)
+	dec := msgpack.NewDecoder(&buf)
+	dec.UseLooseInterfaceDecoding(true)
+	for {
+		var m map[string]any
+		err := dec.Decode(&m)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		word, ok := m["word"].(string)
+		if !ok || len(m) != 2 {
+			t.Fatalf("decoded %v, want a map with word and count", m)
+		}
+		// 宽松解码时整数总是解码为 int64 或 uint64
+		switch count := m["count"].(type) {
+		case int64:
+			got[word] += int(count)
+		case uint64:
+			got[word] += int(count)
+		default:
+			t.Fatalf("decoded count %v (%T), want an integer", count, count)
+		}
+	}
+	if !maps.Equal(got, sampleCounts) {
+		t.Errorf("decoded %v, want %v", got, sampleCounts)
+	}
+}
+
+func TestWriteJSONSummary(t *testing.T) {
+	run := requestRunStats()
+	run.files = []string{"a.txt"}
+	run.lines.Store(2)
+	run.bytes.Store(30)
+	run.tokens.Store(6)
+	run.distinct.Store(3)
+
+	// sampleResults 的顺序不固定，输出的 counts 要与输入的顺序一致
+	want := sampleResults()
+	var buf bytes.Buffer
+	if err := writeJSONSummary(&buf, feed(want...), run); err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Meta   map[string]json.RawMessage `json:"meta"`
+		Counts []jsonWordCount            `json:"counts"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %s", buf.String(), err)
+	}
+	for _, key := range []string{"files", "lines", "bytes", "tokens", "distinct", "duration_seconds", "options"} {
+		if _, ok := got.Meta[key]; !ok {
+			t.Errorf("meta has no %q key: %s", key, buf.String())
+		}
+	}
+	if string(got.Meta["tokens"]) != "6" || string(got.Meta["distinct"]) != "3" || string(got.Meta["files"]) != `["a.txt"]` {
+		t.Errorf("meta = %s, want the values of run", buf.String())
+	}
+
+	if len(got.Counts) != len(want) {
+		t.Fatalf("got %d counts, want %d", len(got.Counts), len(want))
+	}
+	for i, wc := range want {
+		if got.Counts[i].Word != wc.word || got.Counts[i].Count != wc.count {
+			t.Errorf("counts[%d] = %+v, want %s %d", i, got.Counts[i], wc.word, wc.count)
+		}
+	}
+}
+
+// gunzip 解压 data，gzip 的结尾缺失或损坏时测试失败
+func gunzip(t *testing.T, data []byte) string {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("invalid gzip header: %s", err)
+	}
+	text, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("invalid gzip stream: %s", err)
+	}
+	return string(text)
+}
+
+// TestGzipOutput 检查 -z-out 和以 .gz 结尾的 -o 输出压缩后的结果，解压后与不压缩时的计数相同
+func TestGzipOutput(t *testing.T) {
+	input := "the cat and the dog\nthe end\n"
+	want := map[string]int{"the": 3, "cat": 1, "and": 1, "dog": 1, "end": 1}
+
+	path := filepath.Join(t.TempDir(), "counts.txt.gz")
+	if _, stderr, code := runMain(t, input, "-f", "/dev/stdin", "-o", path); code != 0 {
+		t.Fatalf("-o %s: exit status %d, stderr %q", path, code, stderr)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parseCounts(t, gunzip(t, data)); !maps.Equal(got, want) {
+		t.Errorf("-o %s: counts %v, want %v", path, got, want)
+	}
+
+	stdout, stderr, code := runMain(t, input, "-f", "/dev/stdin", "-z-out")
+	if code != 0 {
+		t.Fatalf("-z-out: exit status %d, stderr %q", code, stderr)
+	}
+	if got := parseCounts(t, gunzip(t, []byte(stdout))); !maps.Equal(got, want) {
+		t.Errorf("-z-out: counts %v, want %v", got, want)
+	}
+}
+
+// TestGzipOutputOnError 检查处理出错或被取消时压缩输出仍然写入 gzip 的结尾，已经输出的结果可以完整解压
+func TestGzipOutputOnError(t *testing.T) {
+	dir := t.TempDir()
+
+	// 超过 -max-distinct 时输出了第一个结果之后失败
+	path := filepath.Join(dir, "failed.gz")
+	_, stderr, code := runMain(t, "alpha beta gamma\n", "-f", "/dev/stdin", "-max-distinct", "1", "-o", path)
+	if code != 1 {
+		t.Fatalf("-max-distinct 1: exit status %d, want 1 (stderr %q)", code, stderr)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := gunzip(t, data); text != "alpha             1\n" {
+		t.Errorf("-max-distinct 1: output %q, want only the first result", text)
+	}
+
+	// 输入一直没有结束时被 -timeout 取消，ndjson 输出在取消前已经写入的行保留下来
+	path = filepath.Join(dir, "cancelled.gz")
+	cmd := mainCommand("-f", "/dev/stdin", "-timeout", "200ms", "-format", "ndjson", "-o", path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(stdin, "alpha beta\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Wait(); cmd.ProcessState.ExitCode() != 1 {
+		t.Fatalf("-timeout: exit status %d (%v), want 1", cmd.ProcessState.ExitCode(), err)
+	}
+	if data, err = os.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	gunzip(t, data)
+}
+
+// TestJSONOut 检查同时指定 -o 和 -json-out 时一次运行写入两个文件，两者包含相同顺序的相同计数
+func TestJSONOut(t *testing.T) {
+	dir := t.TempDir()
+	textPath, jsonPath := filepath.Join(dir, "counts.txt"), filepath.Join(dir, "counts.json")
+	input := "the cat and the dog\nthe end of the dog\n"
+	stdout, stderr, code := runMain(t, input, "-f", "/dev/stdin", "-o", textPath, "-json-out", jsonPath, "-sort", "count", "-n", "3")
+	if code != 0 {
+		t.Fatalf("exit status %d, stderr %q", code, stderr)
+	}
+	if stdout != "" {
+		t.Errorf("stdout %q, want the results only in the files", stdout)
+	}
+
+	text, err := os.ReadFile(textPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []jsonWordCount
+	if err := json.Unmarshal(data, &results); err != nil {
+		t.Fatalf("invalid JSON %q: %s", data, err)
+	}
+
+	want := []jsonWordCount{{Word: "the", Count: 4}, {Word: "dog", Count: 2}, {Word: "and", Count: 1}}
+	if !slices.Equal(results, want) {
+		t.Errorf("-json-out results %+v, want %+v", results, want)
+	}
+	var rows []jsonWordCount
+	for _, line := range strings.Split(strings.TrimSuffix(string(text), "\n"), "\n") {
+		var row jsonWordCount
+		if _, err := fmt.Sscan(line, &row.Word, &row.Count); err != nil {
+			t.Fatalf("cannot parse %q: %s", line, err)
+		}
+		rows = append(rows, row)
+	}
+	if !slices.Equal(rows, want) {
+		t.Errorf("-o rows %+v, want %+v", rows, want)
+	}
+}
+
+// TestMarkdownOutput 检查 -format md 输出表头、分隔行和每个结果一行的 GitHub Markdown 表格，word 中的 | 被转义
+func TestMarkdownOutput(t *testing.T) {
+	stdout, stderr, code := runMain(t, "a|b the\nthe cat\n", "-f", "/dev/stdin", "-raw-words", "-format", "md")
+	if code != 0 {
+		t.Fatalf("exit status %d, stderr %q", code, stderr)
+	}
+	want := "| word | count |\n| --- | ---: |\n| a\\|b | 1 |\n| cat | 1 |\n| the | 2 |\n"
+	if stdout != want {
+		t.Errorf("output %q, want %q", stdout, want)
+	}
+	// 每一行都恰好有两个单元格：去掉转义的 \| 之后每行有三个 |
+	for _, line := range strings.Split(strings.TrimSuffix(stdout, "\n"), "\n") {
+		if n := strings.Count(strings.ReplaceAll(line, `\|`, ""), "|"); n != 3 || !strings.HasPrefix(line, "| ") || !strings.HasSuffix(line, " |") {
+			t.Errorf("row %q is not a two-column table row", line)
+		}
+	}
+}
+
+// TestHTMLOutput 检查 -format html 输出转义后的表格片段，-html-standalone 时输出完整的文档
+func TestHTMLOutput(t *testing.T) {
+	input := "<b> & AT&T the\n"
+	stdout, stderr, code := runMain(t, input, "-f", "/dev/stdin", "-raw-words", "-format", "html")
+	if code != 0 {
+		t.Fatalf("exit status %d, stderr %q", code, stderr)
+	}
+	want := "<table>\n<tr><th>word</th><th>count</th></tr>\n" +
+		"<tr><td>&amp;</td><td>1</td></tr>\n<tr><td>&lt;b&gt;</td><td>1</td></tr>\n" +
+		"<tr><td>at&amp;t</td><td>1</td></tr>\n<tr><td>the</td><td>1</td></tr>\n</table>\n"
+	if stdout != want {
+		t.Errorf("output %q, want %q", stdout, want)
+	}
+
+	standalone, _, _ := runMain(t, input, "-f", "/dev/stdin", "-raw-words", "-format", "html", "-html-standalone")
+	if !strings.HasPrefix(standalone, "<!DOCTYPE html>\n") || !strings.Contains(standalone, want) || !strings.HasSuffix(standalone, "</html>\n") {
+		t.Errorf("-html-standalone output %q is not a document containing the table", standalone)
+	}
+}
+
+// TestWordCloudOutput 检查 -format wordcloud 输出 {"text", "weight"} 数组，-wordcloud-scale log 时权重为 ln(1 + count)
+func TestWordCloudOutput(t *testing.T) {
+	input := "the the the the cat cat dog\n"
+	tests := []struct {
+		args []string
+		want map[string]float64
+	}{
+		{nil, map[string]float64{"the": 4, "cat": 2, "dog": 1}},
+		{[]string{"-wordcloud-scale", "log"}, map[string]float64{"the": math.Log(5), "cat": math.Log(3), "dog": math.Log(2)}},
+		{[]string{"-wordcloud-scale", "log", "-sort", "count", "-n", "2"}, map[string]float64{"the": math.Log(5), "cat": math.Log(3)}},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, input, append([]string{"-f", "/dev/stdin", "-format", "wordcloud"}, tt.args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		// 每个元素只有 text 和 weight 两个字段
+		var items []map[string]any
+		if err := json.Unmarshal([]byte(stdout), &items); err != nil {
+			t.Fatalf("%v: invalid JSON %q: %s", tt.args, stdout, err)
+		}
+		got := make(map[string]float64)
+		for _, item := range items {
+			text, ok1 := item["text"].(string)
+			weight, ok2 := item["weight"].(float64)
+			if !ok1 || !ok2 || len(item) != 2 {
+				t.Fatalf("%v: item %v does not have exactly a string text and a numeric weight", tt.args, item)
+			}
+			got[text] = weight
+		}
+		if !maps.EqualFunc(got, tt.want, func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }) {
+			t.Errorf("%v: weights %v, want %v", tt.args, got, tt.want)
+		}
+	}
+
+	if _, stderr, code := runMain(t, input, "-f", "/dev/stdin", "-format", "wordcloud", "-wordcloud-scale", "sqrt"); code != 1 || !strings.Contains(stderr, "unknown -wordcloud-scale") {
+		t.Errorf("-wordcloud-scale sqrt: exit status %d, stderr %q", code, stderr)
+	}
+}
+
+// TestPadWidthSep 检查 -pad-width 与 -sep 的组合，超出对齐宽度的词仍与计数分开
+func TestPadWidthSep(t *testing.T) {
+	long := strings.Repeat("longerthanpadding ", 1234)
+	tests := []struct {
+		input string
+		args  []string
+		want  string
+	}{
+		{"a a supercalifragilistic\n", nil, "a                 2\nsupercalifragilistic   1\n"},
+		{"a a supercalifragilistic\n", []string{"-pad-width", "5"}, "a       2\nsupercalifragilistic   1\n"},
+		{"a a b\n", []string{"-sep", " | ", "-pad-width", "3"}, "a   |    2\nb   |    1\n"},
+		{"a a b\n", []string{"-pad-width", "0", "-sep", "\t"}, "a\t2\nb\t1\n"},
+		{long, nil, "longerthanpadding 1234\n"},
+		{long, []string{"-pad-width", "3"}, "longerthanpadding 1234\n"},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, tt.input, append([]string{"-f", "/dev/stdin"}, tt.args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("%v: output %q, want %q", tt.args, stdout, tt.want)
+		}
+	}
+}
+
+// TestUniqueCount 检查 -unique-count 只输出去重后的词数，且计入分词和过滤选项的效果
+func TestUniqueCount(t *testing.T) {
+	input := "The the cat THE cat dog a\n"
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "4\n"},
+		{[]string{"-min-len", "3"}, "3\n"},
+		{[]string{"-exclude-word", "cat"}, "3\n"},
+		{[]string{"-preserve-case"}, "4\n"},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, input, append([]string{"-f", "/dev/stdin", "-unique-count"}, tt.args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("%v: output %q, want %q", tt.args, stdout, tt.want)
+		}
+	}
+
+	if stdout, _, code := runMain(t, "", "-f", "/dev/stdin", "-unique-count"); code != 0 || stdout != "0\n" {
+		t.Errorf("empty input: exit status %d, output %q, want \"0\\n\"", code, stdout)
+	}
+}
+
+// TestGroupByInitial 检查 -group-by-initial 只在首字母变化时插入标题行，首字符不是字母的 word 归入 "#"
+func TestGroupByInitial(t *testing.T) {
+	tests := []struct {
+		input string
+		args  []string
+		want  string
+	}{
+		{"apple Avocado banana 3d 9lives cherry cat\n", []string{"-raw-words"},
+			"== # ==\n3d 1\n9lives 1\n== A ==\napple 1\navocado 1\n== B ==\nbanana 1\n== C ==\ncat 1\ncherry 1\n"},
+		{"apple banana cherry\n", []string{"-reverse"}, "== C ==\ncherry 1\n== B ==\nbanana 1\n== A ==\napple 1\n"},
+	}
+	for _, tt := range tests {
+		args := append([]string{"-f", "/dev/stdin", "-group-by-initial", "-sep", " ", "-pad-width", "0"}, tt.args...)
+		stdout, stderr, code := runMain(t, tt.input, args...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("%v: output %q, want %q", tt.args, stdout, tt.want)
+		}
+	}
+}
+
+// TestBytesPerWord 检查 -bytes-per-word 在文本和 Markdown 输出中增加一列 UTF-8 字节数，多字节 word 的字节数大于字符数
+func TestBytesPerWord(t *testing.T) {
+	input := "cat café 日本 cat\n"
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "café              1     5\ncat               2     3\n日本                1     6\n"},
+		{[]string{"-format", "md"}, "| word | count | bytes |\n| --- | ---: | ---: |\n| café | 1 | 5 |\n| cat | 2 | 3 |\n| 日本 | 1 | 6 |\n"},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, input, append([]string{"-f", "/dev/stdin", "-raw-words", "-bytes-per-word"}, tt.args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("%v: output %q, want %q", tt.args, stdout, tt.want)
+		}
+	}
+}
+
+// TestVocab 检查 -vocab 按字母顺序每行输出一个不同的 word，不受 -sort 影响，并计入过滤选项的效果
+func TestVocab(t *testing.T) {
+	input := "zeta Alpha beta alpha zeta gamma Beta\n"
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "alpha\nbeta\ngamma\nzeta\n"},
+		{[]string{"-sort", "count", "-min-len", "5"}, "alpha\ngamma\n"},
+		{[]string{"-format", "nul"}, "alpha\x00beta\x00gamma\x00zeta\x00"},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, input, append([]string{"-f", "/dev/stdin", "-vocab"}, tt.args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("%v: output %q, want %q", tt.args, stdout, tt.want)
+		}
+	}
+}
+
+// TestMaxDistinct 检查超过 -max-distinct 时以状态 1 退出并提示使用 -n，不超过或指定 -n 时正常输出
+func TestMaxDistinct(t *testing.T) {
+	input := "a b c d a\n"
+	tests := []struct {
+		args []string
+		code int
+		want map[string]int
+	}{
+		{[]string{"-max-distinct", "4"}, 0, map[string]int{"a": 2, "b": 1, "c": 1, "d": 1}},
+		{[]string{"-max-distinct", "3", "-n", "2"}, 0, map[string]int{"a": 2, "b": 1}},
+		{[]string{"-max-distinct", "3"}, 1, nil},
+		{[]string{"-max-distinct", "3", "-strategy", "heap"}, 1, nil},
+		{[]string{"-max-distinct", "3", "-sort", "count"}, 1, nil},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, input, append([]string{"-f", "/dev/stdin"}, tt.args...)...)
+		if code != tt.code {
+			t.Fatalf("%v: exit status %d, want %d (stderr %q)", tt.args, code, tt.code, stderr)
+		}
+		if tt.code != 0 {
+			if want := "too many distinct words (more than 3), use -n to only output the first N words or raise -max-distinct"; !strings.Contains(stderr, want) {
+				t.Errorf("%v: stderr %q does not contain %q", tt.args, stderr, want)
+			}
+			continue
+		}
+		if got := parseCounts(t, stdout); !maps.Equal(got, tt.want) {
+			t.Errorf("%v: counts %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+// TestFreqTable 检查 -freq-table 按计数输出对齐的排名、word、计数和相对频率四列，-n 截取之后频率仍然相对于全部 token
+func TestFreqTable(t *testing.T) {
+	input := "the cat the dog the cat bird\n"
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "rank  word  count  frequency\n1     the   3      42.86%\n2     cat   2      28.57%\n3     bird  1      14.29%\n4     dog   1      14.29%\n"},
+		{[]string{"-n", "2"}, "rank  word  count  frequency\n1     the   3      42.86%\n2     cat   2      28.57%\n"},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, input, append([]string{"-f", "/dev/stdin", "-freq-table"}, tt.args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("%v: output %q, want %q", tt.args, stdout, tt.want)
+		}
+	}
+}
+
+// TestMaxRows 检查 -max-rows 输出前 N 行之后用一行报告省略的 word 数量，与 -n 一起使用时只计入 -n 截取之后的 word
+func TestMaxRows(t *testing.T) {
+	input := "a b c d e f a\n"
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-max-rows", "2"}, "a 2\nb 1\n...and 4 more words\n"},
+		{[]string{"-max-rows", "5"}, "a 2\nb 1\nc 1\nd 1\ne 1\n...and 1 more words\n"},
+		{[]string{"-max-rows", "6"}, "a 2\nb 1\nc 1\nd 1\ne 1\nf 1\n"},
+		{[]string{"-max-rows", "2", "-n", "4"}, "a 2\nb 1\n...and 2 more words\n"},
+		{[]string{"-max-rows", "1", "-sort", "count", "-reverse"}, "f 1\n...and 5 more words\n"},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, input, append([]string{"-f", "/dev/stdin", "-sep", " ", "-pad-width", "0"}, tt.args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("%v: output %q, want %q", tt.args, stdout, tt.want)
+		}
+	}
+
+	if _, stderr, code := runMain(t, input, "-f", "/dev/stdin", "-max-rows", "2", "-format", "json"); code != 1 || !strings.Contains(stderr, "-max-rows only applies to -format text") {
+		t.Errorf("-format json: exit status %d, stderr %q", code, stderr)
+	}
+}
+
+// TestNulOutput 检查 -format nul 中每个 word 和计数都以 NUL 字节结尾，输出中没有换行，-vocab 时只输出 word
+func TestNulOutput(t *testing.T) {
+	input := "hello, world! hello\n"
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "hello\x002\x00world\x001\x00"},
+		{[]string{"-keep-punct"}, "!\x001\x00,\x001\x00hello\x002\x00world\x001\x00"},
+		{[]string{"-sort", "count", "-n", "1"}, "hello\x002\x00"},
+		{[]string{"-vocab"}, "hello\x00world\x00"},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, input, append([]string{"-f", "/dev/stdin", "-format", "nul"}, tt.args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if stdout != tt.want || strings.Contains(stdout, "\n") {
+			t.Errorf("%v: output %q, want %q", tt.args, stdout, tt.want)
+		}
+	}
+}
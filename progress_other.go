@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// notifyProgress 在不支持 SIGUSR1 的平台上不做任何事
+func notifyProgress(ctx context.Context, start time.Time) {}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// notifyProgress 在收到 SIGUSR1 信号时向 stderr 输出当前的处理进度，不会中断处理，ctx 结束后停止监听
+func notifyProgress(ctx context.Context, start time.Time) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR1)
+	go func() {
+		defer signal.Stop(sig)
+		for {
+			select {
+			case <-sig:
+				_ = writeProgress(os.Stderr, time.Since(start))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
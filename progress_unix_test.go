@@ -0,0 +1,174 @@
+//go:build unix
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestProgressSignal 检查处理过程中收到 SIGUSR1 时向 stderr 输出一行进度，之后继续处理剩余的输入
+func TestProgressSignal(t *testing.T) {
+	cmd := mainCommand("-f", "/dev/stdin", "-debug")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout strings.Builder
+	cmd.Stdout = &stdout
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		sc := bufio.NewScanner(stderr)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+	}()
+	// waitFor 等待 stderr 中出现包含 s 的一行
+	waitFor := func(s string) string {
+		t.Helper()
+		timeout := time.After(10 * time.Second)
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					t.Fatalf("stderr closed before a line containing %q", s)
+				}
+				if strings.Contains(line, s) {
+					return line
+				}
+			case <-timeout:
+				_ = cmd.Process.Kill()
+				t.Fatalf("timed out waiting for a line containing %q", s)
+			}
+		}
+	}
+
+	// 检测二进制输入需要先读到 sniffLen 字节，读到第一行时信号处理已经注册，而输入还没有结束
+	if _, err := io.WriteString(stdin, strings.Repeat("alpha beta\n", 500)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("read line")
+	if err := cmd.Process.Signal(syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	var n, bytes int
+	line := waitFor("progress:")
+	if _, err := fmt.Sscanf(line, "progress: %d lines, %d bytes, ", &n, &bytes); err != nil || n == 0 || bytes < sniffLen {
+		t.Errorf("progress line %q, want the lines and bytes read so far", line)
+	}
+
+	if _, err := io.WriteString(stdin, "gamma alpha\n"); err != nil {
+		t.Fatal(err)
+	}
+	_ = stdin.Close()
+	go func() {
+		for range lines {
+		}
+	}()
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("process did not continue after SIGUSR1: %s", err)
+	}
+	if want := map[string]int{"alpha": 501, "beta": 500, "gamma": 1}; !maps.Equal(parseCounts(t, stdout.String()), want) {
+		t.Errorf("counts %v, want %v", parseCounts(t, stdout.String()), want)
+	}
+}
+
+// TestCancelReport 检查处理过程中被 SIGINT 取消时以状态 1 退出，并在 stderr 中输出取消前已经处理的行数、字节数和 token 数
+func TestCancelReport(t *testing.T) {
+	cmd := mainCommand("-f", "/dev/stdin", "-debug")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+
+	// 读到第一行之后再发送信号，此时输入还没有结束，pipeline 正在运行
+	if _, err := io.WriteString(stdin, strings.Repeat("alpha beta\n", 500)); err != nil {
+		t.Fatal(err)
+	}
+	sc := bufio.NewScanner(stderr)
+	for sc.Scan() && !strings.Contains(sc.Text(), "read line") {
+	}
+	if err := cmd.Process.Signal(syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+	var failed bool
+	var lines, bytes, tokens int
+	for sc.Scan() {
+		line := sc.Text()
+		failed = failed || strings.HasPrefix(line, "failed to process file: ")
+		if strings.HasPrefix(line, "processed ") {
+			if _, err := fmt.Sscanf(line, "processed %d lines, %d bytes, %d tokens in ", &lines, &bytes, &tokens); err != nil {
+				t.Errorf("cannot parse %q: %v", line, err)
+			}
+		}
+	}
+	if err := cmd.Wait(); cmd.ProcessState.ExitCode() != 1 {
+		t.Errorf("exit status %d (%v), want 1", cmd.ProcessState.ExitCode(), err)
+	}
+	if !failed {
+		t.Error("stderr does not report the failure")
+	}
+	if lines == 0 || bytes < sniffLen || tokens == 0 {
+		t.Errorf("stderr reports %d lines, %d bytes and %d tokens, want the nonzero counts processed before the cancellation", lines, bytes, tokens)
+	}
+}
+
+// TestTimeout 检查输入一直没有结束时 -timeout 到期后立即以状态 1 退出，而不是等待阻塞的读取
+func TestTimeout(t *testing.T) {
+	cmd := mainCommand("-f", "/dev/stdin", "-timeout", "100ms")
+	// 测试结束之前一直不关闭 stdin 的写入端，读取输入的 goroutine 阻塞在 Read 中
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(stdin, "alpha beta\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		_ = cmd.Process.Kill()
+		t.Fatal("process did not exit after -timeout 100ms")
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("process exited after %s, before the timeout", elapsed)
+	}
+	if code := cmd.ProcessState.ExitCode(); code != 1 {
+		t.Errorf("exit status %d, want 1", code)
+	}
+	if !strings.Contains(stderr.String(), "failed to process file: context deadline exceeded") {
+		t.Errorf("stderr %q does not report the timeout", stderr.String())
+	}
+}
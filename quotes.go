@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// quoteScanner 跟踪跨行的引号状态，只保留引号内的文本。closers 是当前已打开的引号对应的右引号，
+// 从外到内排列，因此嵌套的引号（例如 “He said ‘hi’”）也能正确匹配。
+type quoteScanner struct {
+	single  bool
+	closers []rune
+}
+
+// quotePairs 是左引号及其对应的右引号，单引号只在指定 -single-quotes 时生效
+var quotePairs = map[rune]rune{
+	'"':  '"',
+	'“':  '”',
+	'\'': '\'',
+	'‘':  '’',
+}
+
+func isSingleQuote(r rune) bool {
+	return r == '\'' || r == '‘' || r == '’'
+}
+
+// scan 将 line 中引号外的文本（包括引号本身）替换为等长的空格，保持字节偏移量不变。
+// 空行会重置引号状态，避免一个未闭合的引号吞掉后续所有段落。
+func (q *quoteScanner) scan(line string) string {
+	if strings.TrimSpace(line) == "" {
+		q.closers = q.closers[:0]
+		return line
+	}
+
+	var b strings.Builder
+	b.Grow(len(line))
+	var prev rune
+	for i, r := range line {
+		size := utf8.RuneLen(r)
+		next, _ := utf8.DecodeRuneInString(line[i+size:])
+		keep := len(q.closers) > 0
+		switch {
+		case isSingleQuote(r) && !q.single:
+		case len(q.closers) > 0 && r == q.closers[len(q.closers)-1] &&
+			// 单引号后面紧跟字母时是缩写中的撇号（如 don't），不是右引号
+			(!isSingleQuote(r) || !unicode.IsLetter(next)):
+			q.closers = q.closers[:len(q.closers)-1]
+			keep = false
+		case quotePairs[r] != 0 && (!isSingleQuote(r) || !unicode.IsLetter(prev)):
+			q.closers = append(q.closers, quotePairs[r])
+			keep = false
+		}
+
+		if keep {
+			b.WriteString(line[i : i+size])
+		} else {
+			b.WriteString(strings.Repeat(" ", size))
+		}
+		prev = r
+	}
+	return b.String()
+}
+
+// quotedText 只保留每一行中引号内的文本，引号可以跨行。input 需为同一个文件中按顺序读到的行。
+func quotedText(ctx context.Context, eg *errgroup.Group, input <-chan inputLine, single bool) <-chan inputLine {
+	ch := make(chan inputLine)
+
+	eg.Go(func() error {
+		defer func() { close(ch); logger.Debug("quote scanner exits") }()
+		q := &quoteScanner{single: single}
+		for l := range input {
+			l.text = q.scan(l.text)
+			select {
+			case ch <- l:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	return ch
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// quotedWords 使用 quoteScanner 依次处理 lines，返回引号内的 word
+func quotedWords(t *testing.T, lines []string, single bool) []string {
+	t.Helper()
+	q := &quoteScanner{single: single}
+	var words []string
+	for _, line := range lines {
+		scanned := q.scan(line)
+		if len(scanned) != len(line) {
+			// 引号外的文本替换为等长的空格，字节偏移量保持不变
+			t.Errorf("scan(%q) = %q, want the same length", line, scanned)
+		}
+		words = append(words, strings.Fields(scanned)...)
+	}
+	return words
+}
+
+func TestQuoteScanner(t *testing.T) {
+	passage := []string{
+		`The door opened. "Who is there?" she asked.`,
+		`He waited. “It's me,`,
+		`your brother,” he said, “the one who said ‘never again’.”`,
+		`Narration after the dialogue. "An unclosed quote`,
+		``,
+		`resets at the empty line.`,
+	}
+
+	tests := []struct {
+		single bool
+		want   []string
+	}{
+		{false, []string{"Who", "is", "there?", "It's", "me,", "your", "brother,", "the", "one", "who", "said", "‘never", "again’.", "An", "unclosed", "quote"}},
+		// 嵌套的单引号也被去掉，缩写中的撇号保留
+		{true, []string{"Who", "is", "there?", "It's", "me,", "your", "brother,", "the", "one", "who", "said", "never", "again", ".", "An", "unclosed", "quote"}},
+	}
+	for _, tt := range tests {
+		if got := quotedWords(t, passage, tt.single); !slices.Equal(got, tt.want) {
+			t.Errorf("single %v: got %q, want %q", tt.single, got, tt.want)
+		}
+	}
+}
+
+func TestInQuotes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "novel.txt")
+	text := "\"Come here,\" said the fox.\nThe dog said \"here I\ncome.\"\n"
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, code := runMain(t, "", "-f", path, "-in-quotes")
+	if code != 0 {
+		t.Fatalf("exit status %d: %s", code, stderr)
+	}
+	want := map[string]int{"come": 2, "here": 2, "i": 1}
+	if got := parseCounts(t, stdout); !maps.Equal(got, want) {
+		t.Errorf("counts %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// runReduceCmd 启动 -reduce-cmd 指定的外部程序作为 reducer：按照 word 排序的 token 流以 `word\tcount\n`
+// 的格式逐行写入它的标准输入，它的标准输出原样写入 w。命令行按照空白拆分成程序和参数，不经过 shell。
+// ctx 被取消时外部程序会被杀死。外部程序没有读完输入就成功退出（如 head）时剩余的输入被丢弃，不算作错误；
+// 写入 w 失败时返回该错误，之后外部程序的输出被丢弃。
+func runReduceCmd(ctx context.Context, command string, input <-chan wordCount, w io.Writer) error {
+	args := strings.Fields(command)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		// 外部程序没有启动时也需要读完输入，避免上游阻塞
+		for range input {
+		}
+		return fmt.Errorf("failed to start -reduce-cmd: %w", err)
+	}
+
+	// 写入 w 失败后继续读完外部程序的输出，避免它阻塞在写入中或因为 SIGPIPE 退出而掩盖真正的错误
+	copied := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(w, stdout)
+		if err != nil {
+			_, _ = io.Copy(io.Discard, stdout)
+		}
+		copied <- err
+	}()
+
+	bw := bufio.NewWriter(stdin)
+	var writeErr error
+	for wc := range input {
+		if writeErr != nil {
+			continue
+		}
+		_, writeErr = bw.WriteString(wc.word + "\t" + strconv.Itoa(wc.count) + "\n")
+	}
+	if writeErr == nil {
+		writeErr = bw.Flush()
+	}
+	writeErr = errors.Join(writeErr, stdin.Close())
+
+	// StdoutPipe 要求读完输出之后才能调用 Wait
+	copyErr := <-copied
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if copyErr == nil {
+			return fmt.Errorf("-reduce-cmd failed: %w", err)
+		}
+	}
+	if copyErr != nil {
+		return copyErr
+	}
+	if writeErr != nil {
+		logger.Debug("-reduce-cmd exited before reading all input", "err", writeErr)
+	}
+	return nil
+}
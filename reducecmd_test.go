@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestRunReduceCmd 检查 runReduceCmd 将 token 流以 word<TAB>count 的格式交给外部程序并原样输出它的标准输出，
+// 以及外部程序提前退出、失败和无法启动时的处理
+func TestRunReduceCmd(t *testing.T) {
+	tokens := []wordCount{{word: "alpha", count: 1}, {word: "alpha", count: 1}, {word: "beta", count: 2}}
+	tests := []struct {
+		command string
+		want    string
+		wantErr string
+	}{
+		{command: "cat", want: "alpha\t1\nalpha\t1\nbeta\t2\n"},
+		{command: "head -n 1", want: "alpha\t1\n"},
+		{command: "false", wantErr: "-reduce-cmd failed"},
+		{command: "wc-example-no-such-command", wantErr: "failed to start -reduce-cmd"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		err := runReduceCmd(context.Background(), tt.command, feed(tokens...), &out)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error %v, want %q", tt.command, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || out.String() != tt.want {
+			t.Errorf("%s: output %q, error %v, want %q", tt.command, out.String(), err, tt.want)
+		}
+	}
+
+	// 写入输出失败时返回该错误
+	errFull := errors.New("no space left on device")
+	err := runReduceCmd(context.Background(), "cat", feed(tokens...), failingWriter{errFull})
+	if !errors.Is(err, errFull) {
+		t.Errorf("cat into a failing writer: error %v, want %v", err, errFull)
+	}
+
+	// 输出超过管道的缓冲区时在外部程序运行期间写入失败，以状态 1 退出并报告写入的错误
+	if _, err := os.Stat("/dev/full"); err == nil {
+		var text strings.Builder
+		for i := 0; i < 50000; i++ {
+			text.WriteString(letterWord(i) + "\n")
+		}
+		_, stderr, code := runMain(t, text.String(), "-f", "/dev/stdin", "-reduce-cmd", "cat", "-o", "/dev/full")
+		if code != 1 || !strings.Contains(stderr, "no space left on device") {
+			t.Errorf("-reduce-cmd cat -o /dev/full: exit status %d, stderr %q, want 1 and the write error", code, stderr)
+		}
+	}
+
+	stdout, stderr, code := runMain(t, "beta alpha\nalpha\n", "-f", "/dev/stdin", "-reduce-cmd", "cat")
+	if want := "alpha\t1\nalpha\t1\nbeta\t1\n"; code != 0 || stdout != want {
+		t.Errorf("-reduce-cmd cat: exit status %d, output %q, want %q (stderr %q)", code, stdout, want, stderr)
+	}
+}
+
+// failingWriter 的每次 Write 都返回 err
+type failingWriter struct {
+	err error
+}
+
+func (w failingWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const replHelp = `commands:
+  top [N]        show the N most frequent words (default 10)
+  count WORD     show the count of WORD
+  reset          clear all counts
+  save FILE      save all counts to FILE as word<TAB>count lines
+  help           show this help
+  quit           exit`
+
+// runREPL 从 r 中逐行读取命令并对 agg 中的聚合结果进行查询，结果写入 w，读到 EOF 或 quit 时退出。
+// run 为得到 agg 的那次运行的统计。
+func runREPL(r io.Reader, w io.Writer, agg *Aggregator, run *runStats) error {
+	sc := bufio.NewScanner(r)
+	for {
+		if _, err := fmt.Fprint(w, "> "); err != nil {
+			return err
+		}
+		if !sc.Scan() {
+			_, _ = fmt.Fprintln(w)
+			return sc.Err()
+		}
+
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(sc.Text()), " ")
+		if cmd == "quit" || cmd == "exit" {
+			return nil
+		}
+		if err := execREPLCommand(w, agg, run, cmd, strings.TrimSpace(arg)); err != nil {
+			if _, err := fmt.Fprintf(w, "error: %s\n", err); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// execREPLCommand 执行一条 REPL 命令
+func execREPLCommand(w io.Writer, agg *Aggregator, run *runStats, cmd, arg string) error {
+	switch cmd {
+	case "":
+		return nil
+	case "top":
+		n := 10
+		if arg != "" {
+			var err error
+			if n, err = strconv.Atoi(arg); err != nil || n < 0 {
+				return fmt.Errorf("invalid number %q", arg)
+			}
+		}
+		results := agg.sorted()
+		sort.SliceStable(results, func(i, j int) bool { return byCount(results[i], results[j]) })
+		return writeREPLResults(w, run, results[:min(n, len(results))]...)
+	case "count":
+		// 与输入使用相同的分词规则，保证查询的 word 与计数结果一致
+		tokens := mapFn(arg)
+		if len(tokens) != 1 {
+			return fmt.Errorf("count expects exactly one word, got %q", arg)
+		}
+		wc, ok := agg.counts[tokens[0].word]
+		if !ok {
+			wc = wordCount{word: tokens[0].word}
+		}
+		return writeREPLResults(w, run, wc)
+	case "reset":
+		agg.Reset()
+		_, err := fmt.Fprintln(w, "counts cleared")
+		return err
+	case "save":
+		if arg == "" {
+			return fmt.Errorf("save expects a file name")
+		}
+		if err := saveCounts(arg, agg.sorted()); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(w, "saved %d words to %s\n", agg.Len(), arg)
+		return err
+	case "help":
+		_, err := fmt.Fprintln(w, replHelp)
+		return err
+	default:
+		return fmt.Errorf("unknown command %q, type help for a list of commands", cmd)
+	}
+}
+
+// writeREPLResults 与非交互模式一样通过 writeResults 输出查询结果，输出格式由 -format 等选项决定
+func writeREPLResults(w io.Writer, run *runStats, results ...wordCount) error {
+	ch := make(chan wordCount, len(results))
+	for _, wc := range results {
+		ch <- wc
+	}
+	close(ch)
+	eg, ctx := errgroup.WithContext(context.Background())
+	eg.Go(func() error { return writeResults(ctx, eg, w, ch, run) })
+	return eg.Wait()
+}
+
+// saveCounts 将 results 以 word<TAB>count 的格式写入文件 path
+func saveCounts(path string, results []wordCount) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(f)
+	for _, wc := range results {
+		if _, err := fmt.Fprintf(bw, "%s\t%d\n", wc.word, wc.count); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
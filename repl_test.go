@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunREPL(t *testing.T) {
+	agg := newAggregator(reduceFn)
+	for _, w := range strings.Fields("the fox the dog the fox") {
+		agg.Add(w)
+	}
+	path := filepath.Join(t.TempDir(), "counts.txt")
+	script := strings.Join([]string{
+		"top 2",
+		"count The",
+		"count cat",
+		"count two words",
+		"top x",
+		"bogus",
+		"save " + path,
+		"reset",
+		"top",
+		"quit",
+		"count the",
+	}, "\n")
+
+	var out strings.Builder
+	if err := runREPL(strings.NewReader(script), &out, agg, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := "> " + "the               3\nfox               2\n" +
+		"> " + "the               3\n" +
+		"> " + "cat               0\n" +
+		"> " + "error: count expects exactly one word, got \"two words\"\n" +
+		"> " + "error: invalid number \"x\"\n" +
+		"> " + "error: unknown command \"bogus\", type help for a list of commands\n" +
+		"> " + "saved 3 words to " + path + "\n" +
+		"> " + "counts cleared\n" +
+		"> " + "> "
+	if got := out.String(); got != want {
+		t.Errorf("output:\n%s\nwant:\n%s", got, want)
+	}
+
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "dog\t1\nfox\t2\nthe\t3\n"; string(saved) != want {
+		t.Errorf("saved %q, want %q", saved, want)
+	}
+}
+
+// TestRunREPLFormat 检查 REPL 的查询结果与非交互模式一样按照 -format 输出
+func TestRunREPLFormat(t *testing.T) {
+	restoreFlags(t)
+	format = "ndjson"
+	agg := newAggregator(reduceFn)
+	agg.Add("fox")
+
+	var out strings.Builder
+	if err := runREPL(strings.NewReader("count fox\n"), &out, agg, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "> {\"word\":\"fox\",\"count\":1}\n> \n"; out.String() != want {
+		t.Errorf("output %q, want %q", out.String(), want)
+	}
+}
+
+// TestREPLExitStatus 检查部分输入文件读取失败时 REPL 结束后仍以状态 2 退出
+func TestREPLExitStatus(t *testing.T) {
+	dir := t.TempDir()
+	good, bad := filepath.Join(dir, "good.txt"), filepath.Join(dir, "bad.dat")
+	if err := os.WriteFile(good, []byte("fox fox dog\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bad, []byte("\x00\x01"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, code := runMain(t, "top 1\n", "-repl", "-keep-going", "-f", good, "-f", bad)
+	if code != 2 {
+		t.Errorf("exit status %d, want 2 (stderr %q)", code, stderr)
+	}
+	if want := "> fox               2\n> \n"; stdout != want {
+		t.Errorf("output %q, want %q", stdout, want)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// contentTypes 是各输出格式对应的 HTTP Content-Type，未列出的格式为纯文本
+var contentTypes = map[string]string{
+	"md":           "text/markdown; charset=utf-8",
+	"html":         "text/html; charset=utf-8",
+	"wordcloud":    "application/json",
+	"protobuf":     "application/octet-stream",
+	"msgpack":      "application/msgpack",
+	"ndjson":       "application/x-ndjson",
+	"json":         "application/json",
+	"json-summary": "application/json",
+	"nul":          "application/octet-stream",
+}
+
+// serve 启动 HTTP 服务，直到 ctx 被取消：
+// POST /count 统计请求体中的文本，按照命令行指定的选项返回结果；GET /metrics 以 Prometheus 文本格式输出运行指标。
+func serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/count", handleCount)
+	mux.HandleFunc("/metrics", handleMetrics)
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+	// 收到信号时停止接收新的请求，并等待正在处理的请求结束
+	stop := context.AfterFunc(ctx, func() { _ = srv.Shutdown(context.Background()) })
+	defer stop()
+
+	logger.Info("serving", "addr", addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// handleCount 对请求体运行与命令行相同的 pipeline，结果先写入缓冲区，出错时返回错误状态码
+func handleCount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	start := time.Now()
+	defer func() { serverMetrics.observe(time.Since(start)) }()
+
+	eg, ctx := errgroup.WithContext(r.Context())
+	// 每个请求使用独立的随机数生成器，指定 -seed 时相同的请求得到相同的结果
+	rng := rand.New(rand.NewSource(seed))
+	run := requestRunStats()
+	lines := make(chan inputLine)
+	eg.Go(func() error {
+		defer close(lines)
+		return readLines(ctx, countingReader{r.Body, run.bytes}, 0, lines, rand.New(rand.NewSource(rng.Int63())))
+	})
+
+	agg := requestAggregators.Get().(*Aggregator)
+	defer releaseAggregator(agg)
+	reduced := countLines(ctx, eg, countStage(ctx, eg, lines, run.lines), agg, rng, run)
+
+	var buf bytes.Buffer
+	eg.Go(func() error {
+		return writeResults(ctx, eg, &buf, reduced, run)
+	})
+	if err := eg.Wait(); err != nil {
+		serverMetrics.failures.Add(1)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	contentType, ok := contentTypes[format]
+	if !ok {
+		contentType = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// requestAggregators 保存 -serve 和 -grpc 的请求使用过的 Aggregator，后续的请求清空后重复使用，避免每个请求重新分配 map
+var requestAggregators = sync.Pool{New: func() any { return newCappedAggregator(reduceFn, lruCap) }}
+
+// releaseAggregator 清空 agg 并放回 requestAggregators，需要在使用 agg 的 pipeline 结束后调用
+func releaseAggregator(agg *Aggregator) {
+	agg.Reset()
+	requestAggregators.Put(agg)
+}
+
+// countLines 对一个请求的输入行运行 mapper、在空的 agg 中聚合以及 finishResults 中的过滤和排序，token 数和不同 word 的数量计入 run
+func countLines(ctx context.Context, eg *errgroup.Group, lines <-chan inputLine, agg *Aggregator, rng *rand.Rand, run *runStats) <-chan wordCount {
+	resort := needsResort()
+	mapped := countStage(ctx, eg, mapper(ctx, eg, lines, mapFn), run.tokens)
+	top := reductionTop()
+	// 与命令行一样统计过滤和截取前 N 个之前的不同 word 数量
+	reduced := countStage(ctx, eg, aggregateInto(ctx, eg, mapped, agg, !resort, top), run.distinct)
+	if stopwordRatio {
+		reduced = countStopwords(ctx, eg, reduced, run)
+	}
+	return finishResults(ctx, eg, reduced, resort, top != nil, rng)
+}
+
+// countStage 原样转发 input 中的数据，并将转发的数量累加到 n 中
+func countStage[T any](ctx context.Context, eg *errgroup.Group, input <-chan T, n *atomic.Int64) <-chan T {
+	ch := make(chan T)
+
+	eg.Go(func() error {
+		defer close(ch)
+		for v := range input {
+			n.Add(1)
+			select {
+			case ch <- v:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	return ch
+}
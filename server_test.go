@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestHandleCountJSONSummary 检查 -serve 时 json-summary 的元数据只统计当前请求：
+// 计数器不会在请求之间累加，不同 word 的数量和耗时都来自这个请求
+func TestHandleCountJSONSummary(t *testing.T) {
+	restoreFlags(t)
+	format = "json-summary"
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handleCount(rec, httptest.NewRequest(http.MethodPost, "/count", strings.NewReader("the cat\nthe dog\n")))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d: %s", i, rec.Code, rec.Body.String())
+		}
+
+		var got struct {
+			Meta summaryMeta `json:"meta"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("request %d: invalid JSON %q: %s", i, rec.Body.String(), err)
+		}
+		meta := got.Meta
+		if meta.Lines != 2 || meta.Bytes != 16 || meta.Tokens != 4 || meta.Distinct != 3 {
+			t.Errorf("request %d: meta %+v, want 2 lines, 16 bytes, 4 tokens and 3 distinct words", i, meta)
+		}
+		if meta.DurationSeconds < 0 || meta.DurationSeconds > 60 {
+			t.Errorf("request %d: duration %gs is not the duration of the request", i, meta.DurationSeconds)
+		}
+	}
+}
+
+// TestHandleCountReusesAggregator 检查请求重复使用 requestAggregators 中的 Aggregator 时不会带上之前请求的计数
+func TestHandleCountReusesAggregator(t *testing.T) {
+	restoreFlags(t)
+	bodies := []struct {
+		text string
+		want map[string]int
+	}{
+		{"the cat\nthe dog\n", map[string]int{"the": 2, "cat": 1, "dog": 1}},
+		{"a bird\n", map[string]int{"a": 1, "bird": 1}},
+		{"the cat\nthe dog\n", map[string]int{"the": 2, "cat": 1, "dog": 1}},
+	}
+	for i, b := range bodies {
+		rec := httptest.NewRecorder()
+		handleCount(rec, httptest.NewRequest(http.MethodPost, "/count", strings.NewReader(b.text)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d: %s", i, rec.Code, rec.Body.String())
+		}
+		if got := parseCounts(t, rec.Body.String()); !maps.Equal(got, b.want) {
+			t.Errorf("request %d: counts = %v, want %v", i, got, b.want)
+		}
+	}
+}
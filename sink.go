@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// outputSink 逐条接收输出结果并序列化，不需要通过 channel 传递结果。
+// Close 结束输出（如写入 JSON 数组的结尾），但不会关闭底层的 io.Writer。
+type outputSink interface {
+	Write(wc wordCount) error
+	Close() error
+}
+
+// newOutputSink 按照输出模式和 -format 创建将结果写入 w 的 outputSink，需要读取整个 wordCount 流的输出函数在 eg 中运行
+func newOutputSink(ctx context.Context, eg *errgroup.Group, w io.Writer, run *runStats) outputSink {
+	switch {
+	case uniqueCount:
+		return newStreamSink(ctx, eg, w, writeUniqueCount)
+	case freqSpectrum:
+		return newStreamSink(ctx, eg, w, writeFreqSpectrum)
+	case logBins:
+		return newStreamSink(ctx, eg, w, writeLogBins)
+	case rankCorr:
+		return newStreamSink(ctx, eg, w, func(w io.Writer, input <-chan wordCount) error { return writeRankCorr(w, input, run) })
+	case entropy:
+		return newStreamSink(ctx, eg, w, writeEntropy)
+	case vocab:
+		return newStreamSink(ctx, eg, w, writeVocab)
+	case freqTable:
+		return newStreamSink(ctx, eg, w, writeFreqTable)
+	case stopwordRatio:
+		return newStreamSink(ctx, eg, w, func(w io.Writer, input <-chan wordCount) error { return writeStopwordRatio(w, input, run) })
+	}
+
+	switch format {
+	case "md":
+		return newStreamSink(ctx, eg, w, writeMarkdown)
+	case "html":
+		return newStreamSink(ctx, eg, w, writeHTML)
+	case "wordcloud":
+		return newStreamSink(ctx, eg, w, writeWordCloud)
+	case "protobuf":
+		return newStreamSink(ctx, eg, w, writeProtobuf)
+	case "msgpack":
+		return newStreamSink(ctx, eg, w, writeMsgpack)
+	case "ndjson":
+		return &ndjsonSink{w: w, enc: json.NewEncoder(w)}
+	case "json":
+		return newStreamSink(ctx, eg, w, writeJSON)
+	case "json-summary":
+		return newStreamSink(ctx, eg, w, func(w io.Writer, input <-chan wordCount) error { return writeJSONSummary(w, input, run) })
+	case "nul":
+		return &nulSink{w: w}
+	case "data":
+		return &dataSink{w: w, header: dataHeader}
+	default:
+		var sink outputSink = &textSink{w: w, cols: extraColumns()}
+		if maxRows > 0 {
+			sink = &rowLimitSink{sink: sink, w: w, max: maxRows}
+		}
+		return sink
+	}
+}
+
+// rowLimitSink 只将前 max 条结果写入 sink，其余的结果只计数，结束时输出一行被省略的 word 数量
+type rowLimitSink struct {
+	sink    outputSink
+	w       io.Writer
+	max     int
+	rows    int
+	omitted int
+}
+
+func (s *rowLimitSink) Write(wc wordCount) error {
+	if s.rows >= s.max {
+		s.omitted++
+		return nil
+	}
+	s.rows++
+	return s.sink.Write(wc)
+}
+
+func (s *rowLimitSink) Close() error {
+	if err := s.sink.Close(); err != nil {
+		return err
+	}
+	if s.omitted == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(s.w, "...and %d more words\n", s.omitted)
+	return err
+}
+
+// textSink 以对齐的文本列输出结果，指定 -group-by-initial 时在首字母变化时输出分组标题
+type textSink struct {
+	w     io.Writer
+	cols  []column
+	group string
+}
+
+func (s *textSink) Write(wc wordCount) error {
+	if groupByInitial {
+		// 首字母变化时输出新的分组标题
+		if g := initialGroup(wc.word); g != s.group {
+			s.group = g
+			if _, err := fmt.Fprintf(s.w, "== %s ==\n", s.group); err != nil {
+				return err
+			}
+		}
+	}
+
+	line := textColumns(displayWord(wc), strconv.Itoa(wc.count), 4)
+	for _, col := range s.cols {
+		line = textColumns(line, col.value(wc), col.width)
+	}
+	if dict != nil && !onlyUnknown && !dict[wc.word] {
+		line += "  (unknown)"
+	}
+	_, err := fmt.Fprintln(s.w, line)
+	return err
+}
+
+func (s *textSink) Close() error {
+	return nil
+}
+
+// ndjsonSink 每行输出一个 JSON 对象 {"word": ..., "count": ...}，每条记录输出后按照 flushRecord 刷新缓冲区
+type ndjsonSink struct {
+	w   io.Writer
+	enc *json.Encoder
+}
+
+func (s *ndjsonSink) Write(wc wordCount) error {
+	if err := s.enc.Encode(jsonWordCount{displayWord(wc), wc.count}); err != nil {
+		return err
+	}
+	return flushRecord(s.w)
+}
+
+func (s *ndjsonSink) Close() error {
+	return nil
+}
+
+// nulSink 将每个 word 和计数都以 NUL 字节结尾输出（`word\0count\0`），可以无歧义地分隔包含任意字符的 word，
+// 适合 `xargs -0` 等工具
+type nulSink struct {
+	w io.Writer
+}
+
+func (s *nulSink) Write(wc wordCount) error {
+	_, err := io.WriteString(s.w, displayWord(wc)+"\x00"+strconv.Itoa(wc.count)+"\x00")
+	return err
+}
+
+func (s *nulSink) Close() error {
+	return nil
+}
+
+// dataSink 以 gnuplot、matplotlib 等可以直接读取的数据文件输出结果：每行为以空格分隔的排名和计数，
+// 没有 word 列和对齐用的空白；header 为 true 时先输出一行 `#` 开头的注释作为表头
+type dataSink struct {
+	w      io.Writer
+	header bool
+	rank   int
+}
+
+func (s *dataSink) Write(wc wordCount) error {
+	if s.rank == 0 && s.header {
+		if _, err := io.WriteString(s.w, "# rank count\n"); err != nil {
+			return err
+		}
+	}
+	s.rank++
+	_, err := io.WriteString(s.w, strconv.Itoa(s.rank)+" "+strconv.Itoa(wc.count)+"\n")
+	return err
+}
+
+func (s *dataSink) Close() error {
+	if s.rank == 0 && s.header {
+		_, err := io.WriteString(s.w, "# rank count\n")
+		return err
+	}
+	return nil
+}
+
+// streamSink 将读取 wordCount 流的输出函数（如需要在结尾汇总或排版的格式）适配为 outputSink，
+// 输出函数在 errgroup 的 goroutine 中运行，Close 等待它写完并返回它的错误
+type streamSink struct {
+	ctx  context.Context
+	ch   chan wordCount
+	done chan struct{}
+	err  error
+}
+
+func newStreamSink(ctx context.Context, eg *errgroup.Group, w io.Writer, write func(io.Writer, <-chan wordCount) error) *streamSink {
+	s := &streamSink{ctx: ctx, ch: make(chan wordCount), done: make(chan struct{})}
+	eg.Go(func() error {
+		defer close(s.done)
+		s.err = write(w, s.ch)
+		return s.err
+	})
+	return s
+}
+
+func (s *streamSink) Write(wc wordCount) error {
+	select {
+	case s.ch <- wc:
+		return nil
+	case <-s.done:
+		// 输出函数已经提前返回
+		return s.err
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+func (s *streamSink) Close() error {
+	close(s.ch)
+	<-s.done
+	return s.err
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+var sinkResults = []wordCount{{word: "the", count: 3}, {word: "fox", count: 1}, {word: "dog", count: 1}}
+
+// writeSink 将 results 写入 sink 并关闭它
+func writeSink(t *testing.T, sink outputSink, results ...wordCount) {
+	t.Helper()
+	for _, wc := range results {
+		if err := sink.Write(wc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSinks(t *testing.T) {
+	tests := []struct {
+		name string
+		sink func(w io.Writer) outputSink
+		want string
+	}{
+		{"text", func(w io.Writer) outputSink { return &textSink{w: w} }, "the               3\nfox               1\ndog               1\n"},
+		{"rows", func(w io.Writer) outputSink { return &rowLimitSink{sink: &textSink{w: w}, w: w, max: 1} }, "the               3\n...and 2 more words\n"},
+		{"ndjson", func(w io.Writer) outputSink { return &ndjsonSink{w: w, enc: json.NewEncoder(w)} }, "{\"word\":\"the\",\"count\":3}\n{\"word\":\"fox\",\"count\":1}\n{\"word\":\"dog\",\"count\":1}\n"},
+		{"nul", func(w io.Writer) outputSink { return &nulSink{w: w} }, "the\x003\x00fox\x001\x00dog\x001\x00"},
+		{"data", func(w io.Writer) outputSink { return &dataSink{w: w, header: true} }, "# rank count\n1 3\n2 1\n3 1\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		writeSink(t, tt.sink(&buf), sinkResults...)
+		if buf.String() != tt.want {
+			t.Errorf("%s sink wrote %q, want %q", tt.name, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestStreamSink(t *testing.T) {
+	eg, ctx := errgroup.WithContext(context.Background())
+	var buf bytes.Buffer
+	eg.Go(func() error {
+		writeSink(t, newStreamSink(ctx, eg, &buf, writeJSON), sinkResults...)
+		return nil
+	})
+	if err := eg.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if want := `[{"word":"the","count":3},{"word":"fox","count":1},{"word":"dog","count":1}]` + "\n"; buf.String() != want {
+		t.Errorf("stream sink wrote %q, want %q", buf.String(), want)
+	}
+}
+
+// TestStreamSinkError 检查输出函数提前返回的错误由 Write 或 Close 返回，并通过 errgroup 取消 pipeline
+func TestStreamSinkError(t *testing.T) {
+	errWrite := errors.New("disk full")
+	eg, ctx := errgroup.WithContext(context.Background())
+	var sinkErr error
+	eg.Go(func() error {
+		sink := newStreamSink(ctx, eg, io.Discard, func(io.Writer, <-chan wordCount) error { return errWrite })
+		for _, wc := range sinkResults {
+			if sinkErr = sink.Write(wc); sinkErr != nil {
+				break
+			}
+		}
+		if err := sink.Close(); sinkErr == nil {
+			sinkErr = err
+		}
+		return nil
+	})
+	if err := eg.Wait(); !errors.Is(err, errWrite) {
+		t.Errorf("errgroup returned %v, want %v", err, errWrite)
+	}
+	if !errors.Is(sinkErr, errWrite) && !errors.Is(sinkErr, context.Canceled) {
+		t.Errorf("sink returned %v, want %v", sinkErr, errWrite)
+	}
+	if ctx.Err() == nil {
+		t.Error("the writer error did not cancel the context")
+	}
+}
+
+// TestStreamingFlush 检查 ndjson 每输出一条记录就写到底层的 writer，不必等到输入结束，
+// 设置 -flush-interval 时记录在下一次定时刷新时写出，批量输出格式在关闭时才写出
+func TestStreamingFlush(t *testing.T) {
+	restoreFlags(t)
+	var buf bytes.Buffer
+	out := newOutputWriter(&buf)
+	// written 在 out 的锁内读取 buf，避免与 flushEvery 中的刷新同时访问
+	written := func() string {
+		out.mu.Lock()
+		defer out.mu.Unlock()
+		return buf.String()
+	}
+	first := "{\"word\":\"the\",\"count\":3}\n"
+
+	sink := &ndjsonSink{w: out, enc: json.NewEncoder(out)}
+	if err := sink.Write(sinkResults[0]); err != nil {
+		t.Fatal(err)
+	}
+	if got := written(); got != first {
+		t.Errorf("ndjson wrote %q after the first record, want %q", got, first)
+	}
+
+	buf.Reset()
+	flushInterval = 20 * time.Millisecond
+	sink = &ndjsonSink{w: out, enc: json.NewEncoder(out)}
+	if err := sink.Write(sinkResults[0]); err != nil {
+		t.Fatal(err)
+	}
+	if got := written(); got != "" {
+		t.Errorf("ndjson with -flush-interval wrote %q before the interval elapsed", got)
+	}
+	done := make(chan struct{})
+	go out.flushEvery(flushInterval, done)
+	deadline := time.Now().Add(5 * time.Second)
+	for written() != first && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(done)
+	if got := written(); got != first {
+		t.Errorf("ndjson with -flush-interval wrote %q after the interval, want %q", got, first)
+	}
+
+	buf.Reset()
+	text := &textSink{w: out}
+	if err := text.Write(sinkResults[0]); err != nil {
+		t.Fatal(err)
+	}
+	if got := written(); got != "" {
+		t.Errorf("text output wrote %q before closing", got)
+	}
+	if err := errors.Join(text.Close(), out.Close()); err != nil {
+		t.Fatal(err)
+	}
+	if want := "the               3\n"; buf.String() != want {
+		t.Errorf("text output wrote %q after closing, want %q", buf.String(), want)
+	}
+}
+
+// TestFormatData 检查 -format data 每行只有排名和计数两个数字列，排名从 1 开始连续递增，计数按照从大到小的顺序排列
+func TestFormatData(t *testing.T) {
+	text := "the fox and the dog\nthe dog sat and the fox ran\n"
+	stdout, stderr, code := runMain(t, text, "-f", "/dev/stdin", "-format", "data")
+	if code != 0 {
+		t.Fatalf("exit status %d, stderr %q", code, stderr)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("output has %d lines, want one per distinct word:\n%s", len(lines), stdout)
+	}
+	prev := -1
+	for i, line := range lines {
+		fields := strings.Split(line, " ")
+		if len(fields) != 2 {
+			t.Fatalf("line %q does not have two space-separated columns", line)
+		}
+		rank, err1 := strconv.Atoi(fields[0])
+		count, err2 := strconv.Atoi(fields[1])
+		if err1 != nil || err2 != nil {
+			t.Fatalf("line %q has a column that is not an integer", line)
+		}
+		if rank != i+1 {
+			t.Errorf("line %q has rank %d, want %d", line, rank, i+1)
+		}
+		if prev >= 0 && count > prev {
+			t.Errorf("count %d on line %q is greater than the count %d before it", count, line, prev)
+		}
+		prev = count
+	}
+	if lines[0] != "1 4" {
+		t.Errorf("first line %q, want the count of \"the\" (1 4)", lines[0])
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// spillEntryBytes 是 map 聚合中每个不同 word 大约占用的内存（map 的槽位、wordCount 和 word 本身），
+// 用于将 -max-memory 换算成 spillAggregate 最多保留的 word 数量
+const spillEntryBytes = 256
+
+// chooseStrategy 为 -strategy auto 选择聚合方式，只检查输入文件的大小而不读取它们。
+// 没有指定 -max-memory，或者输入都是普通文件且即使每两个字节就是一个不同的 word 时 map 聚合也不会超过 -max-memory 时选择 map；
+// 否则（包括无法得知大小的 FIFO 等输入）选择 spill，不同 word 的数量超过 -max-memory 时将部分结果溢写到临时文件中。
+// -lru-cap 和 -stream-sorted 是 map 聚合的选项，指定时总是选择 map。
+func chooseStrategy(files []string) string {
+	if maxMemory == 0 || lruCap > 0 || streamSorted {
+		return "map"
+	}
+	var size int64
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			return "spill"
+		}
+		size += info.Size()
+	}
+	if (size+1)/2*spillEntryBytes > int64(maxMemory)<<20 {
+		return "spill"
+	}
+	return "map"
+}
+
+// spillLimit 返回 -max-memory 对应的 spillAggregate 最多保留的不同 word 数量
+func spillLimit() int {
+	return max(int(int64(maxMemory)<<20/spillEntryBytes), 1)
+}
+
+// spillAggregate 与 aggregate 一样使用 map 聚合 wordCount 流，但最多保留 limit 个不同的 word：
+// 达到 limit 时将已聚合的部分结果按照 word 排序写入临时文件并清空 map，输入结束后将所有临时文件与剩下的结果按照 word 归并输出。
+// 不同文件中相同的 word 相邻输出但不合并，需要再经过 reducer；没有溢写时输出的就是最终结果。
+func spillAggregate(ctx context.Context, eg *errgroup.Group, input <-chan wordCount, fn func(acc, next wordCount) wordCount, limit int) <-chan wordCount {
+	ch := make(chan wordCount)
+
+	eg.Go(func() error {
+		defer func() { close(ch); logger.Debug("spilling aggregator exits") }()
+		agg := newAggregator(fn)
+		var dir string
+		var runs []string
+		defer func() {
+			if dir != "" {
+				_ = os.RemoveAll(dir)
+			}
+		}()
+		for wc := range input {
+			agg.add(wc)
+			wordsAggregated.Store(int64(agg.Len()))
+			if agg.Len() < limit {
+				continue
+			}
+			if dir == "" {
+				var err error
+				if dir, err = os.MkdirTemp("", "wc-spill-"); err != nil {
+					return err
+				}
+			}
+			path := filepath.Join(dir, strconv.Itoa(len(runs)))
+			if err := spillRun(path, agg); err != nil {
+				return err
+			}
+			logger.Debug("spilled partial counts", "file", path, "words", limit)
+			runs = append(runs, path)
+		}
+
+		emit := func(wc wordCount) error {
+			select {
+			case ch <- wc:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if len(runs) == 0 {
+			return agg.drainSorted(emit)
+		}
+
+		streams := make([]<-chan wordCount, 0, len(runs)+1)
+		for _, path := range runs {
+			streams = append(streams, readRun(ctx, eg, path))
+		}
+		rest := make(chan wordCount)
+		streams = append(streams, rest)
+		eg.Go(func() error {
+			defer close(rest)
+			return agg.drainSorted(func(wc wordCount) error {
+				select {
+				case rest <- wc:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+		})
+		for wc := range mergeSorted(ctx, eg, streams...) {
+			if err := emit(wc); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return ch
+}
+
+// spillRecord 是写入临时文件的 wordCount，gob 只能编码导出的字段
+type spillRecord struct {
+	Word    string
+	Count   int
+	Line    int
+	Offset  int64
+	Seq     int64
+	Forms   map[string]int
+	Files   []uint64
+	Members map[string]int
+	Sources map[int]int
+}
+
+// spillRun 将 agg 中的结果按照 word 排序写入 path 并清空 agg
+func spillRun(path string, agg *Aggregator) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := gob.NewEncoder(w)
+	err = agg.drainSorted(func(wc wordCount) error {
+		return enc.Encode(spillRecord{wc.word, wc.count, wc.line, wc.offset, wc.seq, wc.forms, wc.files, wc.members, wc.sources})
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// readRun 按照写入的顺序输出 spillRun 写入 path 的结果
+func readRun(ctx context.Context, eg *errgroup.Group, path string) <-chan wordCount {
+	ch := make(chan wordCount)
+
+	eg.Go(func() error {
+		defer func() { close(ch); logger.Debug("spilled run has been read", "file", path) }()
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		dec := gob.NewDecoder(bufio.NewReader(f))
+		for {
+			var r spillRecord
+			if err := dec.Decode(&r); errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			wc := wordCount{word: r.Word, count: r.Count, line: r.Line, offset: r.Offset, seq: r.Seq,
+				forms: r.Forms, files: r.Files, members: r.Members, sources: r.Sources}
+			select {
+			case ch <- wc:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+
+	return ch
+}
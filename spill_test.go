@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// letterWord 将 i 转换成只包含字母的 word，不同的 i 得到不同的 word
+func letterWord(i int) string {
+	var b strings.Builder
+	for {
+		b.WriteByte(byte('a' + i%26))
+		if i /= 26; i == 0 {
+			return b.String()
+		}
+	}
+}
+
+// TestChooseStrategy 检查 -strategy auto 在没有 -max-memory 或小输入时选择 map，在内存上限不足以容纳输入或无法得知输入大小时选择 spill
+func TestChooseStrategy(t *testing.T) {
+	restoreFlags(t)
+	dir := t.TempDir()
+	small, large := filepath.Join(dir, "small.txt"), filepath.Join(dir, "large.txt")
+	if err := os.WriteFile(small, []byte("alpha beta\nbeta gamma\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// 每两个字节一个不同的 word 时需要 (16 KiB / 2) * spillEntryBytes = 2 MiB
+	if err := os.WriteFile(large, []byte(strings.Repeat("a\n", 8<<10)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		files     []string
+		maxMemory int
+		want      string
+	}{
+		{[]string{large}, 0, "map"},
+		{[]string{small}, 1, "map"},
+		{[]string{small, large}, 1, "spill"},
+		{[]string{large}, 2, "map"},
+		{[]string{"/dev/stdin"}, 1, "spill"},
+	}
+	for _, tt := range tests {
+		maxMemory = tt.maxMemory
+		if got := chooseStrategy(tt.files); got != tt.want {
+			t.Errorf("chooseStrategy(%v) with -max-memory %d = %s, want %s", tt.files, tt.maxMemory, got, tt.want)
+		}
+	}
+}
+
+// TestSpillAggregate 检查 spillAggregate 在达到上限时溢写部分结果，经过 reducer 合并后与不限制内存的 map 聚合结果相同
+func TestSpillAggregate(t *testing.T) {
+	tokens := zipfTokens(50000, 5000)
+	want := make(map[string]int)
+	for _, wc := range tokens {
+		want[wc.word] += wc.count
+	}
+
+	var merged int
+	got := make(map[string]int)
+	for _, wc := range collect(t, func(ctx context.Context, eg *errgroup.Group) <-chan wordCount {
+		spilled := spillAggregate(ctx, eg, feed(tokens...), reduceFn, 100)
+		return reducer(ctx, eg, wordFilter(ctx, eg, spilled, func(wordCount) bool { merged++; return true }), reduceFn, nil)
+	}) {
+		got[wc.word] = wc.count
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("spillAggregate counted %d distinct words, want the %d of the unbounded counts", len(got), len(want))
+	}
+	// 同一个 word 出现在多个临时文件中时，reducer 之前的结果比不同 word 的数量多
+	if merged <= len(want) {
+		t.Errorf("spillAggregate passed %d partial counts for %d distinct words, want it to have spilled", merged, len(want))
+	}
+
+	// 6000 个不同的 word 超过了 1 MiB 对应的 4096 个
+	var text strings.Builder
+	for i := 0; i < 6000; i++ {
+		text.WriteString(letterWord(i) + " " + letterWord(i%100) + "\n")
+	}
+	path := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(path, []byte(text.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if stdout, _, _ := runMain(t, "", "-f", path, "-strategy", "auto", "-max-memory", "1", "-dry-run"); !strings.Contains(stdout, `strategy = "spill"`) {
+		t.Errorf("-max-memory 1 -dry-run output does not choose spill:\n%s", stdout)
+	}
+	wantOut, _, _ := runMain(t, "", "-f", path, "-strategy", "map", "-sort", "count", "-n", "20")
+	if stdout, stderr, code := runMain(t, "", "-f", path, "-strategy", "auto", "-max-memory", "1", "-sort", "count", "-n", "20"); code != 0 || stdout != wantOut {
+		t.Errorf("-max-memory 1: exit status %d, output %q, want %q (stderr %q)", code, stdout, wantOut, stderr)
+	}
+}
+
+// TestDefaultStrategy 检查不指定 -strategy 时使用 auto，小输入选择 map，结果与 -strategy heap 相同
+func TestDefaultStrategy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(path, []byte("the cat and the dog\nthe end\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if stdout, _, _ := runMain(t, "", "-f", path, "-dry-run"); !strings.Contains(stdout, `strategy = "map"`) {
+		t.Errorf("-dry-run output does not choose map:\n%s", stdout)
+	}
+	// -metrics-json 报告实际使用的聚合方式
+	stdout, stderr, code := runMain(t, "", "-f", path, "-metrics-json")
+	if code != 0 || !strings.Contains(stderr, `"strategy":"map"`) {
+		t.Errorf("-metrics-json: exit status %d, stderr %q, want strategy map", code, stderr)
+	}
+	want := map[string]int{"the": 3, "cat": 1, "and": 1, "dog": 1, "end": 1}
+	if got := parseCounts(t, stdout); !maps.Equal(got, want) {
+		t.Errorf("counts = %v, want %v", got, want)
+	}
+	if heapOut, _, _ := runMain(t, "", "-f", path, "-strategy", "heap"); heapOut != stdout {
+		t.Errorf("default output %q differs from -strategy heap output %q", stdout, heapOut)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// stageMetric 记录一个阶段输出到下一个阶段的数据量和等待时间：idle 为下游等待该阶段输出的时间，
+// 较大时该阶段是瓶颈；blocked 为该阶段的输出等待下游接收的时间，较大时下游是瓶颈
+type stageMetric struct {
+	name    string
+	items   atomic.Int64
+	idle    atomic.Int64
+	blocked atomic.Int64
+}
+
+// stageMetrics 是 -stage-metrics 时按照 pipeline 顺序记录的各阶段的统计
+var stageMetrics []*stageMetric
+
+// measureStage 在指定 -stage-metrics 时在阶段 name 的输出 input 与下游之间插入一个转发阶段，统计转发的数据量和等待时间，
+// 否则原样返回 input。只能在启动 pipeline 的 goroutine 中调用。
+func measureStage[T any](ctx context.Context, eg *errgroup.Group, name string, input <-chan T) <-chan T {
+	if !stageStats {
+		return input
+	}
+
+	m := &stageMetric{name: name}
+	stageMetrics = append(stageMetrics, m)
+	ch := make(chan T)
+
+	eg.Go(func() error {
+		defer close(ch)
+		for {
+			start := time.Now()
+			v, ok := <-input
+			m.idle.Add(int64(time.Since(start)))
+			if !ok {
+				return nil
+			}
+			m.items.Add(1)
+
+			start = time.Now()
+			select {
+			case ch <- v:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			m.blocked.Add(int64(time.Since(start)))
+		}
+	})
+
+	return ch
+}
+
+// writeStageMetrics 以表格的形式输出各阶段的统计，需要在 pipeline 结束后调用
+func writeStageMetrics(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "stage\titems\tidle\tblocked"); err != nil {
+		return err
+	}
+	for _, m := range stageMetrics {
+		idle := time.Duration(m.idle.Load()).Round(time.Microsecond)
+		blocked := time.Duration(m.blocked.Load()).Round(time.Microsecond)
+		if _, err := fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", m.name, m.items.Load(), idle, blocked); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
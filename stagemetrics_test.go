@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStageMetrics 检查 -stage-metrics 按照 pipeline 顺序列出每个阶段，以及各阶段输出的数据量
+func TestStageMetrics(t *testing.T) {
+	type row struct {
+		stage string
+		items int
+	}
+	// 输入有 2 行、7 个 token、5 个不同的 word
+	input := "the cat and the dog\nthe end\n"
+	tests := []struct {
+		args []string
+		want []row
+	}{
+		{[]string{"-strategy", "heap"}, []row{{"input", 2}, {"mapper", 7}, {"sorter", 7}, {"reducer", 5}, {"writer", 5}}},
+		{[]string{"-strategy", "map"}, []row{{"input", 2}, {"mapper", 7}, {"aggregate", 5}, {"writer", 5}}},
+		// reducer 合并的同时选出前 N 个
+		{[]string{"-strategy", "heap", "-sort", "count", "-n", "2"}, []row{{"input", 2}, {"mapper", 7}, {"sorter", 7}, {"reducer", 2}, {"writer", 2}}},
+		{[]string{"-strategy", "heap", "-include-regex", "^t"}, []row{{"input", 2}, {"mapper", 3}, {"sorter", 3}, {"reducer", 1}, {"writer", 1}}},
+		// 每个文件单独聚合，mapper 阶段输出的是各文件的部分结果
+		{[]string{"-strategy", "merge"}, []row{{"mapper", 5}, {"reducer", 5}, {"writer", 5}}},
+	}
+	for _, tt := range tests {
+		_, stderr, code := runMain(t, input, append([]string{"-f", "/dev/stdin", "-stage-metrics"}, tt.args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		lines := strings.Split(strings.TrimSuffix(stderr, "\n"), "\n")
+		if len(lines) == 0 || strings.Join(strings.Fields(lines[0]), " ") != "stage items idle blocked" {
+			t.Fatalf("%v: stderr %q does not start with the table header", tt.args, stderr)
+		}
+		var got []row
+		for _, line := range lines[1:] {
+			var r row
+			var idle, blocked string
+			if _, err := fmt.Sscan(line, &r.stage, &r.items, &idle, &blocked); err != nil {
+				t.Fatalf("%v: cannot parse %q: %s", tt.args, line, err)
+			}
+			for _, d := range []string{idle, blocked} {
+				if _, err := time.ParseDuration(d); err != nil {
+					t.Errorf("%v: %s: invalid duration %q", tt.args, r.stage, d)
+				}
+			}
+			got = append(got, r)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%v: stages %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
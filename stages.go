@@ -0,0 +1,396 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/rand"
+	"sort"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// countSource 将预先加载的 wordCount 作为一个流输出，用于与新输入的计数合并
+func countSource(ctx context.Context, eg *errgroup.Group, counts []wordCount) <-chan wordCount {
+	ch := make(chan wordCount)
+
+	eg.Go(func() error {
+		defer func() { close(ch); logger.Debug("count source exits") }()
+		for _, wc := range counts {
+			select {
+			case ch <- wc:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	return ch
+}
+
+// wordSampler 使用蓄水池抽样从 wordCount 流中等概率地抽取 k 个不同的 word，
+// 输入结束后按 word 排序输出抽样结果。
+func wordSampler(ctx context.Context, eg *errgroup.Group, input <-chan wordCount, k int, rng *rand.Rand) <-chan wordCount {
+	ch := make(chan wordCount)
+
+	eg.Go(func() error {
+		defer func() { close(ch); logger.Debug("word sampler exits") }()
+		reservoir := make([]wordCount, 0, k)
+		var seen int
+		for wc := range input {
+			seen++
+			if len(reservoir) < k {
+				reservoir = append(reservoir, wc)
+			} else if i := rng.Intn(seen); i < k {
+				reservoir[i] = wc
+			}
+		}
+
+		sort.Slice(reservoir, func(i, j int) bool { return reservoir[i].word < reservoir[j].word })
+		for _, wc := range reservoir {
+			select {
+			case ch <- wc:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	return ch
+}
+
+// wordFilter 只保留 wordCount 流中 keep 返回 true 的结果
+func wordFilter(ctx context.Context, eg *errgroup.Group, input <-chan wordCount, keep func(wordCount) bool) <-chan wordCount {
+	ch := make(chan wordCount)
+
+	eg.Go(func() error {
+		defer func() { close(ch); logger.Debug("word filter exits") }()
+		for wc := range input {
+			if !keep(wc) {
+				continue
+			}
+			select {
+			case ch <- wc:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	return ch
+}
+
+// countStopwords 原样转发合并后的 wordCount 流，同时将停用词和实词的计数累加到 run 中。
+// 需要放在过滤、抽样和截取前 N 个之前，使 -stopword-ratio 统计的是所有 token。
+func countStopwords(ctx context.Context, eg *errgroup.Group, input <-chan wordCount, run *runStats) <-chan wordCount {
+	return wordFilter(ctx, eg, input, func(wc wordCount) bool {
+		if stopwords[wc.word] {
+			run.stopwords.Add(int64(wc.count))
+		} else {
+			run.contentWords.Add(int64(wc.count))
+		}
+		return true
+	})
+}
+
+// collectShared 原样转发合并后的 wordCount 流，同时将两个输入文件共有的 word 在两个文件中的计数收集到 run 中。
+// 与 countStopwords 一样需要放在过滤、抽样和截取前 N 个之前，使 -rank-corr 比较的是所有共有的 word。
+func collectShared(ctx context.Context, eg *errgroup.Group, input <-chan wordCount, run *runStats) <-chan wordCount {
+	return wordFilter(ctx, eg, input, func(wc wordCount) bool {
+		if a, b := wc.sources[0], wc.sources[1]; a > 0 && b > 0 {
+			run.sharedA, run.sharedB = append(run.sharedA, a), append(run.sharedB, b)
+		}
+		return true
+	})
+}
+
+// resultSorter 在 wordCount 流结束后将所有结果按照 less 排序输出
+func resultSorter(ctx context.Context, eg *errgroup.Group, input <-chan wordCount, less func(a, b wordCount) bool) <-chan wordCount {
+	ch := make(chan wordCount)
+
+	eg.Go(func() error {
+		defer func() { close(ch); logger.Debug("result sorter exits") }()
+		var results []wordCount
+		for wc := range input {
+			results = append(results, wc)
+		}
+
+		sort.SliceStable(results, func(i, j int) bool { return less(results[i], results[j]) })
+		for _, wc := range results {
+			select {
+			case ch <- wc:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	return ch
+}
+
+// topNSelector 使用 topSelector 在 wordCount 流中选出按照 less 排序的前 n 个结果
+func topNSelector(ctx context.Context, eg *errgroup.Group, input <-chan wordCount, n int, less func(a, b wordCount) bool) <-chan wordCount {
+	ch := make(chan wordCount)
+
+	eg.Go(func() error {
+		defer func() { close(ch); logger.Debug("top-n selector exits") }()
+		top := newTopSelector(n, less)
+		for wc := range input {
+			top.add(wc)
+		}
+		return sendAll(ctx, ch, top.result())
+	})
+
+	return ch
+}
+
+// topSelector 使用容量为 n 的最小堆（堆顶为当前最靠后的结果）选出按照 less 排序的前 n 个结果，
+// 内存占用与 n 而不是不同 word 的数量成正比。
+type topSelector struct {
+	heap wordCountHeap
+	n    int
+}
+
+func newTopSelector(n int, less func(a, b wordCount) bool) *topSelector {
+	return &topSelector{heap: wordCountHeap{items: make([]wordCount, 0, n+1), less: reverseOrder(less)}, n: n}
+}
+
+// add 加入一个结果，堆已满且 wc 排在堆顶之后时直接丢弃
+func (s *topSelector) add(wc wordCount) {
+	if s.heap.Len() == s.n && !s.heap.less(s.heap.items[0], wc) {
+		return
+	}
+	heap.Push(&s.heap, wc)
+	if s.heap.Len() > s.n {
+		heap.Pop(&s.heap)
+	}
+}
+
+// result 按照 less 的顺序返回选出的结果并清空堆
+func (s *topSelector) result() []wordCount {
+	top := make([]wordCount, s.heap.Len())
+	for i := len(top) - 1; i >= 0; i-- {
+		top[i] = heap.Pop(&s.heap).(wordCount)
+	}
+	return top
+}
+
+// reductionTop 在合并与截取前 N 个结果之间没有需要看到每个 word 的阶段（过滤、抽样、统计和保存状态）时，
+// 返回在合并的同时选出前 N 个结果的 topSelector，这样合并的结果不需要再经过一个 channel 和单独的选择阶段；否则返回 nil。
+func reductionTop() *topSelector {
+	if topN == 0 || keepGoing || saveStateFile != "" || explainWord != "" || format == "json-summary" || freqTable || metricsJSON || stopwordRatio || rankCorr ||
+		commonWords || uniqueTo != "" || targets != nil || excludedWords != nil || onlyUnknown || palindromes || sampleSize > 0 {
+		return nil
+	}
+	return newTopSelector(topN, resultOrder())
+}
+
+// sendAll 依次将 results 发送到 ch 中
+func sendAll(ctx context.Context, ch chan<- wordCount, results []wordCount) error {
+	for _, wc := range results {
+		select {
+		case ch <- wc:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// failedDiscarder 从合并后的结果中减去指定 -keep-going 时读取失败的文件已经贡献的计数，只出现在这些文件中的 word 不再输出。
+// 必须用在等待所有输入读完后才输出结果的阶段之后，此时读取失败的文件已经确定。
+func failedDiscarder(ctx context.Context, eg *errgroup.Group, input <-chan wordCount) <-chan wordCount {
+	ch := make(chan wordCount)
+
+	eg.Go(func() error {
+		defer func() { close(ch); logger.Debug("failed input discarder exits") }()
+		var failed fileSet
+		var loaded bool
+		for wc := range input {
+			if !loaded {
+				failed, loaded = failedSet(), true
+			}
+			var removed bool
+			for file, n := range wc.sources {
+				if failed.has(file) {
+					wc.count -= n
+					delete(wc.sources, file)
+					wc.files.remove(file)
+					removed = true
+				}
+			}
+			if removed && wc.count == 0 {
+				continue
+			}
+			select {
+			case ch <- wc:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	return ch
+}
+
+// targets 是 -only 指定的词表，不为 nil 时只输出其中的 word
+var targets map[string]bool
+
+// targetFilter 只保留 targets 中的 word，并为没有出现过的 word 补充计数为 0 的结果，
+// 按照 word 排序输出
+func targetFilter(ctx context.Context, eg *errgroup.Group, input <-chan wordCount, targets map[string]bool) <-chan wordCount {
+	ch := make(chan wordCount)
+
+	eg.Go(func() error {
+		defer func() { close(ch); logger.Debug("target filter exits") }()
+		results := make([]wordCount, 0, len(targets))
+		seen := make(map[string]bool, len(targets))
+		for wc := range input {
+			if targets[wc.word] {
+				results = append(results, wc)
+				seen[wc.word] = true
+			}
+		}
+		for word := range targets {
+			if !seen[word] {
+				results = append(results, wordCount{word: word})
+			}
+		}
+
+		sort.Slice(results, func(i, j int) bool { return results[i].word < results[j].word })
+		for _, wc := range results {
+			select {
+			case ch <- wc:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	return ch
+}
+
+// distinctLimiter 原样转发 wordCount 流，word 的数量超过 limit 时返回错误，
+// 避免之后需要缓存所有结果的排序和输出阶段耗尽内存
+func distinctLimiter(ctx context.Context, eg *errgroup.Group, input <-chan wordCount, limit int) <-chan wordCount {
+	ch := make(chan wordCount)
+
+	eg.Go(func() error {
+		defer func() { close(ch); logger.Debug("distinct limiter exits") }()
+		var n int
+		for wc := range input {
+			if n++; n > limit {
+				return fmt.Errorf("%w (more than %d), use -n to only output the first N words or raise -max-distinct", errTooManyWords, limit)
+			}
+			select {
+			case ch <- wc:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	return ch
+}
+
+var errTooManyWords = errors.New("too many distinct words")
+
+// tokenDumper 原样转发 mapper 输出的 wordCount 流，同时将每个 token 按照到达的顺序逐行写入 w。
+// w 带有缓冲区，写入不会因为等待磁盘而阻塞 pipeline。
+func tokenDumper(ctx context.Context, eg *errgroup.Group, input <-chan wordCount, w io.Writer) <-chan wordCount {
+	ch := make(chan wordCount)
+
+	eg.Go(func() error {
+		defer func() { close(ch); logger.Debug("token dumper exits") }()
+		for wc := range input {
+			if _, err := fmt.Fprintln(w, wc.word); err != nil {
+				return err
+			}
+			select {
+			case ch <- wc:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	return ch
+}
+
+// checksummer 原样转发 wordCount 流，同时将每个结果按照 `word\tcount\n` 的格式写入 h，
+// 用于计算结果集的校验和
+func checksummer(ctx context.Context, eg *errgroup.Group, input <-chan wordCount, h hash.Hash) <-chan wordCount {
+	ch := make(chan wordCount)
+
+	eg.Go(func() error {
+		defer func() { close(ch); logger.Debug("checksummer exits") }()
+		for wc := range input {
+			_, _ = fmt.Fprintf(h, "%s\t%d\n", wc.word, wc.count)
+			select {
+			case ch <- wc:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	return ch
+}
+
+// isPalindrome 判断 word 是否为长度至少为 2 的回文
+func isPalindrome(word string) bool {
+	runes := []rune(word)
+	if len(runes) < 2 {
+		return false
+	}
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		if runes[i] != runes[j] {
+			return false
+		}
+	}
+	return true
+}
+
+// teeStream 将 wordCount 流复制成 n 份，每个结果都会依次发送给所有下游，
+// 所有下游需要并发消费各自的 channel
+func teeStream(ctx context.Context, eg *errgroup.Group, input <-chan wordCount, n int) []<-chan wordCount {
+	chs := make([]chan wordCount, n)
+	outs := make([]<-chan wordCount, n)
+	for i := range chs {
+		chs[i] = make(chan wordCount)
+		outs[i] = chs[i]
+	}
+
+	eg.Go(func() error {
+		defer func() {
+			for _, ch := range chs {
+				close(ch)
+			}
+			logger.Debug("tee exits")
+		}()
+		for wc := range input {
+			for _, ch := range chs {
+				select {
+				case ch <- wc:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+		return nil
+	})
+
+	return outs
+}
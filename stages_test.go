@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// zipfTokens 返回 n 个服从 Zipf 分布的 token，不同 word 的数量最多为 vocab
+func zipfTokens(n int, vocab uint64) []wordCount {
+	z := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 2, vocab-1)
+	tokens := make([]wordCount, n)
+	for i := range tokens {
+		tokens[i] = wordCount{word: fmt.Sprintf("w%d", z.Uint64()), count: 1}
+	}
+	return tokens
+}
+
+// collect 运行 stage 并返回其输出的所有结果
+func collect(tb testing.TB, stage func(ctx context.Context, eg *errgroup.Group) <-chan wordCount) []wordCount {
+	tb.Helper()
+	eg, ctx := errgroup.WithContext(context.Background())
+	var results []wordCount
+	for wc := range stage(ctx, eg) {
+		results = append(results, wc)
+	}
+	if err := eg.Wait(); err != nil {
+		tb.Fatal(err)
+	}
+	return results
+}
+
+func TestTopNWhileReducing(t *testing.T) {
+	tokens := zipfTokens(50000, 5000)
+	counts := make(map[string]int)
+	for _, wc := range tokens {
+		counts[wc.word]++
+	}
+	var exact []wordCount
+	for w, n := range counts {
+		exact = append(exact, wordCount{word: w, count: n})
+	}
+	sort.Slice(exact, func(i, j int) bool { return byCount(exact[i], exact[j]) })
+	exact = exact[:20]
+
+	stages := map[string]func(ctx context.Context, eg *errgroup.Group) <-chan wordCount{
+		"aggregate": func(ctx context.Context, eg *errgroup.Group) <-chan wordCount {
+			return aggregate(ctx, eg, countSource(ctx, eg, tokens), reduceFn, false, newTopSelector(20, byCount))
+		},
+		"reducer": func(ctx context.Context, eg *errgroup.Group) <-chan wordCount {
+			sorted := sorter(ctx, eg, countSource(ctx, eg, tokens))
+			return reducer(ctx, eg, sorted, reduceFn, newTopSelector(20, byCount))
+		},
+		"selector": func(ctx context.Context, eg *errgroup.Group) <-chan wordCount {
+			reduced := aggregate(ctx, eg, countSource(ctx, eg, tokens), reduceFn, false, nil)
+			return topNSelector(ctx, eg, reduced, 20, byCount)
+		},
+	}
+	for name, stage := range stages {
+		if got := collect(t, stage); !slices.EqualFunc(got, exact, func(a, b wordCount) bool { return a.word == b.word && a.count == b.count }) {
+			t.Errorf("%s: top 20 = %v, want %v", name, got, exact)
+		}
+	}
+}
+
+func BenchmarkTopN(b *testing.B) {
+	tokens := zipfTokens(200000, 100000)
+	b.Run("heap", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			collect(b, func(ctx context.Context, eg *errgroup.Group) <-chan wordCount {
+				return aggregate(ctx, eg, countSource(ctx, eg, tokens), reduceFn, false, newTopSelector(20, byCount))
+			})
+		}
+	})
+	b.Run("full-sort", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			results := collect(b, func(ctx context.Context, eg *errgroup.Group) <-chan wordCount {
+				reduced := aggregate(ctx, eg, countSource(ctx, eg, tokens), reduceFn, false, nil)
+				return resultSorter(ctx, eg, reduced, byCount)
+			})
+			_ = results[:20]
+		}
+	})
+}
+
+// TestDumpTokens 检查 -dump-tokens 按照顺序写入 mapper 输出的每个 token，且不影响计数结果
+func TestDumpTokens(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.txt")
+	text := "The quick brown fox,\njumps over the lazy dog's 42 bones.\n\n-- the end"
+	if err := os.WriteFile(input, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, line := range strings.Split(text, "\n") {
+		for _, wc := range mapFn(line) {
+			want = append(want, wc.word)
+		}
+	}
+
+	dump := filepath.Join(dir, "tokens.txt")
+	stdout, stderr, code := runMain(t, "", "-f", input, "-dump-tokens", dump)
+	if code != 0 {
+		t.Fatalf("exit status %d: %s", code, stderr)
+	}
+	data, err := os.ReadFile(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Fields(string(data)); !slices.Equal(got, want) {
+		t.Errorf("dumped tokens %q, want %q", got, want)
+	}
+	if counts := parseCounts(t, stdout); counts["the"] != 3 || len(counts) != 10 {
+		t.Errorf("counts with -dump-tokens = %v", counts)
+	}
+
+	if _, stderr, code := runMain(t, "", "-f", input, "-dump-tokens", dump, "-local-aggregate"); code != 1 || !strings.Contains(stderr, "-local-aggregate") {
+		t.Errorf("-dump-tokens with -local-aggregate: exit status %d, stderr %q, want it to be rejected", code, stderr)
+	}
+}
+
+// TestChecksum 检查 -checksum 是按照输出顺序的 `word\tcount\n` 计算的 SHA-256：相同的计数得到相同的校验和，
+// 与聚合方式、mapper 的数量、输入行的顺序和 -format 无关，改变一个 word 时校验和也改变
+func TestChecksum(t *testing.T) {
+	checksumOf := func(input string, args ...string) string {
+		t.Helper()
+		_, stderr, code := runMain(t, input, append([]string{"-f", "/dev/stdin", "-checksum"}, args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", args, code, stderr)
+		}
+		for _, line := range strings.Split(stderr, "\n") {
+			if sum, ok := strings.CutPrefix(line, "sha256:"); ok {
+				return sum
+			}
+		}
+		t.Fatalf("%v: stderr %q does not contain a checksum", args, stderr)
+		return ""
+	}
+
+	input := "the cat and the dog\nthe end\n"
+	want := fmt.Sprintf("%x", sha256.Sum256([]byte("and\t1\ncat\t1\ndog\t1\nend\t1\nthe\t3\n")))
+	for _, args := range [][]string{nil, {"-strategy", "heap"}, {"-map-workers", "4"}, {"-format", "json"}} {
+		if got := checksumOf(input, args...); got != want {
+			t.Errorf("%v: checksum %s, want %s", args, got, want)
+		}
+	}
+	if got := checksumOf("the end\nthe cat and the dog\n"); got != want {
+		t.Errorf("reordered lines: checksum %s, want %s", got, want)
+	}
+	if got := checksumOf("the cat and the dog\nthe fin\n"); got == want {
+		t.Errorf("changing end to fin did not change the checksum %s", got)
+	}
+}
+
+// TestWordSampler 检查 wordSampler 抽取 k 个不同的 word 并保留其计数，相同的种子得到相同的样本，
+// 每个 word 被抽中的概率都接近 k/n，而不受计数大小的影响
+func TestWordSampler(t *testing.T) {
+	var words []wordCount
+	for i := 0; i < 20; i++ {
+		// 计数差别很大，抽样仍然只与不同 word 的数量有关
+		words = append(words, wordCount{word: letterWord(i), count: 1 + i*i*100})
+	}
+	sample := func(k int, seed int64) []wordCount {
+		return collect(t, func(ctx context.Context, eg *errgroup.Group) <-chan wordCount {
+			return wordSampler(ctx, eg, feed(words...), k, rand.New(rand.NewSource(seed)))
+		})
+	}
+
+	first := sample(5, 1)
+	if len(first) != 5 {
+		t.Fatalf("sampled %d words, want 5", len(first))
+	}
+	if !sort.SliceIsSorted(first, func(i, j int) bool { return first[i].word < first[j].word }) {
+		t.Errorf("sample %v is not sorted by word", first)
+	}
+	for _, wc := range first {
+		i := slices.IndexFunc(words, func(w wordCount) bool { return w.word == wc.word })
+		if i < 0 || words[i].count != wc.count {
+			t.Errorf("sampled %+v is not one of the input words", wc)
+		}
+	}
+	if again := sample(5, 1); !slices.EqualFunc(first, again, func(a, b wordCount) bool { return a.word == b.word }) {
+		t.Errorf("seed 1 gave %v and then %v", first, again)
+	}
+	if all := sample(50, 1); len(all) != len(words) {
+		t.Errorf("k larger than the vocabulary sampled %d words, want all %d", len(all), len(words))
+	}
+
+	chosen := make(map[string]int)
+	const runs = 2000
+	for seed := int64(1); seed <= runs; seed++ {
+		for _, wc := range sample(5, seed) {
+			chosen[wc.word]++
+		}
+	}
+	// 每个 word 期望被抽中 runs * 5 / 20 = 500 次
+	for _, wc := range words {
+		if n := chosen[wc.word]; n < 400 || n > 600 {
+			t.Errorf("%s was sampled %d times in %d runs, want about 500", wc.word, n, runs)
+		}
+	}
+
+	stdout, stderr, code := runMain(t, "the cat and the dog\nthe end of it\n", "-f", "/dev/stdin", "-sample-words", "3", "-seed", "1")
+	again, _, _ := runMain(t, "the cat and the dog\nthe end of it\n", "-f", "/dev/stdin", "-sample-words", "3", "-seed", "1")
+	if code != 0 || len(parseCounts(t, stdout)) != 3 || stdout != again {
+		t.Errorf("-sample-words 3 -seed 1: exit status %d, outputs %q and %q, want the same 3 words (stderr %q)", code, stdout, again, stderr)
+	}
+}
+
+// TestPalindromes 检查 -palindromes 只输出至少两个字符、正反读相同的 word，按字符而不是字节比较，并且不区分大小写
+func TestPalindromes(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "anna 2\nbb 1\nlevel 1\nnoon 1\n"},
+		{[]string{"-raw-words", "-preserve-case"}, "Anna 2\nbb 1\nLevel 1\nnoon 1\nésé 1\n"},
+	}
+	for _, tt := range tests {
+		args := append([]string{"-f", "/dev/stdin", "-palindromes", "-sep", " ", "-pad-width", "0"}, tt.args...)
+		stdout, stderr, code := runMain(t, "Level anna Anna noon a bb cat ésé\n", args...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("%v: output %q, want %q", tt.args, stdout, tt.want)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// 处理过程中的全局计数器，会被读取输入和 mapper 的多个 goroutine 并发更新
+var (
+	linesRead    atomic.Int64
+	bytesRead    atomic.Int64
+	tokensMapped atomic.Int64
+	// wordsAggregated 为目前已经合并的不同 word 数量，使用 -strategy heap 时排序结束后才开始增长
+	wordsAggregated atomic.Int64
+	// distinctWords 和 totalCount 为合并后、过滤和截取前 N 个之前的不同 word 数量和所有 word 的总计数，
+	// 只在 -format json-summary、-freq-table 和 -metrics-json 时统计
+	distinctWords atomic.Int64
+	totalCount    atomic.Int64
+	// stopwordTokens 和 contentTokens 为合并后、过滤和截取前 N 个之前停用词和实词的计数，只在 -stopword-ratio 时统计
+	stopwordTokens atomic.Int64
+	contentTokens  atomic.Int64
+)
+
+// runStats 是一次运行的统计，作为 -format json-summary 的元数据输出。命令行的一次运行使用全局计数器，
+// -serve 和 -grpc 的每个请求使用独立的计数器，不受同时处理的其他请求影响。
+type runStats struct {
+	files                          []string
+	start                          time.Time
+	lines, bytes, tokens, distinct *atomic.Int64
+	stopwords, contentWords        *atomic.Int64
+	// sharedA 和 sharedB 为 -rank-corr 时两个输入文件共有的 word 在两个文件中的计数，由 collectShared 在过滤和截取前 N 个之前收集
+	sharedA, sharedB []int
+}
+
+// globalRunStats 返回使用全局计数器的 runStats
+func globalRunStats(files []string, start time.Time) *runStats {
+	return &runStats{files: files, start: start, lines: &linesRead, bytes: &bytesRead, tokens: &tokensMapped, distinct: &distinctWords,
+		stopwords: &stopwordTokens, contentWords: &contentTokens}
+}
+
+// requestRunStats 返回使用独立计数器的 runStats，用于 -serve 和 -grpc 的一个请求
+func requestRunStats() *runStats {
+	return &runStats{files: []string{}, start: time.Now(), lines: new(atomic.Int64), bytes: new(atomic.Int64), tokens: new(atomic.Int64), distinct: new(atomic.Int64),
+		stopwords: new(atomic.Int64), contentWords: new(atomic.Int64)}
+}
+
+// countingReader 将从 r 中读到的字节数累加到 n 中，用于统计实际读取的输入大小（包括换行符）
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// writeTiming 输出处理的行数、字节数、token 数和耗时，需要在 pipeline 结束后调用以保证计数准确
+func writeTiming(w io.Writer, elapsed time.Duration) error {
+	_, err := fmt.Fprintf(w, "processed %d lines, %d bytes, %d tokens in %s\n",
+		linesRead.Load(), bytesRead.Load(), tokensMapped.Load(), elapsed.Round(time.Microsecond))
+	return err
+}
+
+// writeMetricsJSON 输出一行包含 token 数、不同 word 数、耗时、字节数和聚合方式的 JSON 对象，
+// 需要在 pipeline 结束后调用以保证计数准确
+func writeMetricsJSON(w io.Writer, elapsed time.Duration) error {
+	return json.NewEncoder(w).Encode(struct {
+		Tokens          int64   `json:"tokens"`
+		Distinct        int64   `json:"distinct"`
+		Lines           int64   `json:"lines"`
+		Bytes           int64   `json:"bytes"`
+		DurationSeconds float64 `json:"duration_seconds"`
+		Strategy        string  `json:"strategy"`
+	}{tokensMapped.Load(), distinctWords.Load(), linesRead.Load(), bytesRead.Load(), elapsed.Seconds(), strategy})
+}
+
+// writeLogBins 按照计数的数量级将 word 分组（1、2–9、10–99、100–999……），按照从小到大的顺序输出每组的范围和不同 word 的数量。
+// 计数为 0 的 word（如 -only 补充的 word）单独作为一组。
+func writeLogBins(w io.Writer, input <-chan wordCount) error {
+	// bins[0] 为计数为 0 的 word，bins[1] 为计数为 1 的 word，bins[k+1]（k >= 1）为计数在 [10^(k-1), 10^k) 中且不为 1 的 word
+	var bins []int
+	for wc := range input {
+		bin := 0
+		if wc.count > 0 {
+			bin = len(strconv.Itoa(wc.count)) + 1
+			if wc.count == 1 {
+				bin = 1
+			}
+		}
+		for len(bins) <= bin {
+			bins = append(bins, 0)
+		}
+		bins[bin]++
+	}
+
+	for bin, n := range bins {
+		var label string
+		switch bin {
+		case 0:
+			if n == 0 {
+				continue
+			}
+			label = "0"
+		case 1:
+			label = "1"
+		case 2:
+			label = "2-9"
+		default:
+			low := int(math.Pow10(bin - 2))
+			label = fmt.Sprintf("%d-%d", low, low*10-1)
+		}
+		if _, err := fmt.Fprintf(w, "%s: %d words\n", label, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeProgress 输出目前已经处理的行数、字节数、token 数、不同 word 数量和耗时，可以在 pipeline 运行时调用
+func writeProgress(w io.Writer, elapsed time.Duration) error {
+	_, err := fmt.Fprintf(w, "progress: %d lines, %d bytes, %d tokens, %d distinct words in %s\n",
+		linesRead.Load(), bytesRead.Load(), tokensMapped.Load(), wordsAggregated.Load(), elapsed.Round(time.Millisecond))
+	return err
+}
+
+// writeFreqSpectrum 输出频率谱：恰好出现 1 次、2 次……的不同 word 各有多少个，按出现次数从小到大排序
+func writeFreqSpectrum(w io.Writer, input <-chan wordCount) error {
+	spectrum := make(map[int]int)
+	for wc := range input {
+		spectrum[wc.count]++
+	}
+
+	counts := make([]int, 0, len(spectrum))
+	for c := range spectrum {
+		counts = append(counts, c)
+	}
+	sort.Ints(counts)
+
+	for _, c := range counts {
+		if _, err := fmt.Fprintf(w, "%d: %d words\n", c, spectrum[c]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeGrowthCurve 按照 token 到达的顺序统计词汇增长曲线：每处理 every 个 token 输出一行
+// `tokens<TAB>distinct`，即已处理的 token 数和其中不同 word 的数量，最后一个点总是对应全部输入
+func writeGrowthCurve(w io.Writer, input <-chan wordCount, every int) error {
+	seen := make(map[string]bool)
+	var tokens int
+	for wc := range input {
+		tokens++
+		seen[wc.word] = true
+		if tokens%every == 0 {
+			if _, err := fmt.Fprintf(w, "%d\t%d\n", tokens, len(seen)); err != nil {
+				return err
+			}
+		}
+	}
+	if tokens%every != 0 {
+		_, err := fmt.Fprintf(w, "%d\t%d\n", tokens, len(seen))
+		return err
+	}
+	return nil
+}
+
+// shannonEntropy 计算计数分布的香农熵（单位为比特），以及除以 log2(不同 word 数量) 得到的归一化熵。
+// 只有一个 word 或没有 word 时两者都为 0。
+func shannonEntropy(counts []int) (float64, float64) {
+	var total float64
+	for _, c := range counts {
+		total += float64(c)
+	}
+	if total == 0 || len(counts) < 2 {
+		return 0, 0
+	}
+
+	var h float64
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / total
+			h -= p * math.Log2(p)
+		}
+	}
+	return h, h / math.Log2(float64(len(counts)))
+}
+
+// writeEntropy 输出所有 word 计数分布的香农熵和归一化熵
+func writeEntropy(w io.Writer, input <-chan wordCount) error {
+	var counts []int
+	for wc := range input {
+		counts = append(counts, wc.count)
+	}
+
+	h, normalized := shannonEntropy(counts)
+	_, err := fmt.Fprintf(w, "entropy: %.6f bits\nnormalized entropy: %.6f\n", h, normalized)
+	return err
+}
+
+// spearman 计算两组成对数据 x 和 y 的 Spearman 等级相关系数，即两者的等级（相同的值取平均等级）的 Pearson 相关系数。
+// 少于两对数据或其中一组的值全部相同时相关系数没有定义，返回 NaN。
+func spearman(x, y []int) float64 {
+	rx, ry := ranks(x), ranks(y)
+	n := float64(len(x))
+	if len(x) < 2 {
+		return math.NaN()
+	}
+
+	// 两组等级的平均值都是 (n+1)/2
+	mean := (n + 1) / 2
+	var cov, vx, vy float64
+	for i := range rx {
+		dx, dy := rx[i]-mean, ry[i]-mean
+		cov += dx * dy
+		vx += dx * dx
+		vy += dy * dy
+	}
+	if vx == 0 || vy == 0 {
+		return math.NaN()
+	}
+	return cov / math.Sqrt(vx*vy)
+}
+
+// ranks 返回 values 中每个值从 1 开始的等级，相同的值取它们所占等级的平均值
+func ranks(values []int) []float64 {
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return values[order[i]] < values[order[j]] })
+
+	r := make([]float64, len(values))
+	for i := 0; i < len(order); {
+		j := i
+		for j < len(order) && values[order[j]] == values[order[i]] {
+			j++
+		}
+		// 第 i+1 到第 j 个等级的平均值
+		avg := float64(i+1+j) / 2
+		for k := i; k < j; k++ {
+			r[order[k]] = avg
+		}
+		i = j
+	}
+	return r
+}
+
+// writeRankCorr 输出 collectShared 收集到 run 中的两个输入文件共有的 word 在两个文件中的计数的 Spearman 等级相关系数，
+// 以及共有的 word 数量。input 中的结果只用于等待 pipeline 结束。
+func writeRankCorr(w io.Writer, input <-chan wordCount, run *runStats) error {
+	for range input {
+	}
+	_, err := fmt.Fprintf(w, "spearman: %.6f\nshared words: %d\n", spearman(run.sharedA, run.sharedB), len(run.sharedA))
+	return err
+}
+
+// writeStopwordRatio 输出 countStopwords 统计到 run 中的停用词和实词的 token 数量以及停用词占所有 token 的比例。
+// input 中的结果只用于等待 pipeline 结束。
+func writeStopwordRatio(w io.Writer, input <-chan wordCount, run *runStats) error {
+	for range input {
+	}
+
+	stop, content := run.stopwords.Load(), run.contentWords.Load()
+	var ratio float64
+	if total := stop + content; total > 0 {
+		ratio = float64(stop) / float64(total)
+	}
+	_, err := fmt.Fprintf(w, "stopwords: %d\ncontent words: %d\nstopword ratio: %.4f\n", stop, content, ratio)
+	return err
+}
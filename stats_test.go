@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// resetCounters 将全局计数器清零
+func resetCounters() {
+	for _, c := range []interface{ Store(int64) }{&linesRead, &bytesRead, &tokensMapped, &wordsAggregated, &distinctWords, &totalCount} {
+		c.Store(0)
+	}
+}
+
+// TestCountersParallel 在多个文件和多个 mapper 并发更新计数器时检查总数，需要使用 go test -race 运行才能发现数据竞争
+func TestCountersParallel(t *testing.T) {
+	defer resetCounters()
+	resetCounters()
+	// CRLF 换行且最后一行没有换行符，字节数必须是实际读到的字节数
+	text := strings.Repeat("one two\r\nthree\r\n", 500) + "four five six"
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < 4; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("%d.txt", i))
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	eg, ctx := errgroup.WithContext(context.Background())
+	input := getInputStream(ctx, eg, paths, len(paths), rand.New(rand.NewSource(1)))
+	mappers := make([]<-chan wordCount, 4)
+	for i := range mappers {
+		mappers[i] = mapper(ctx, eg, input, mapFn)
+	}
+	var tokens int64
+	for range mergeStreams(ctx, eg, mappers...) {
+		tokens++
+	}
+	if err := eg.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := linesRead.Load(), int64(4*1001); got != want {
+		t.Errorf("lines read = %d, want %d", got, want)
+	}
+	if got, want := bytesRead.Load(), int64(4*len(text)); got != want {
+		t.Errorf("bytes read = %d, want %d", got, want)
+	}
+	if got, want := tokensMapped.Load(), int64(4*1503); got != want || tokens != want {
+		t.Errorf("tokens mapped = %d (%d received), want %d", got, tokens, want)
+	}
+}
+
+// TestGrowthCurve 检查增长曲线单调不减，最后一个点对应全部 token 和最终的不同 word 数量
+func TestGrowthCurve(t *testing.T) {
+	tokens := zipfTokens(1000, 300)
+	distinct := make(map[string]bool)
+	for _, wc := range tokens {
+		distinct[wc.word] = true
+	}
+
+	var buf strings.Builder
+	if err := writeGrowthCurve(&buf, feed(tokens...), 64); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	// 1000 不是 64 的整数倍，最后一个不完整的区间也要输出一行
+	if len(lines) != 1000/64+1 {
+		t.Fatalf("got %d curve points, want %d:\n%s", len(lines), 1000/64+1, buf.String())
+	}
+	var prevTokens, prevDistinct int
+	for _, line := range lines {
+		var n, d int
+		if _, err := fmt.Sscanf(line, "%d\t%d", &n, &d); err != nil {
+			t.Fatalf("malformed curve point %q: %s", line, err)
+		}
+		if n <= prevTokens || d < prevDistinct || d > n {
+			t.Errorf("curve point %q after %d\t%d is not monotonic", line, prevTokens, prevDistinct)
+		}
+		prevTokens, prevDistinct = n, d
+	}
+	if prevTokens != len(tokens) || prevDistinct != len(distinct) {
+		t.Errorf("last curve point %d\t%d, want %d\t%d", prevTokens, prevDistinct, len(tokens), len(distinct))
+	}
+}
+
+// TestFreqSpectrum 检查 -freq-spectrum 按计数从小到大输出恰好出现该次数的不同 word 的数量，不输出没有 word 的计数
+func TestFreqSpectrum(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"a a a b b c d e\nf f\n", "1: 3 words\n2: 2 words\n3: 1 words\n"},
+		{"a a a a a b\n", "1: 1 words\n5: 1 words\n"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, tt.input, "-f", "/dev/stdin", "-freq-spectrum")
+		if code != 0 {
+			t.Fatalf("%q: exit status %d, stderr %q", tt.input, code, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("%q: output %q, want %q", tt.input, stdout, tt.want)
+		}
+	}
+}
+
+// TestLogBins 检查 -log-bins 按计数的数量级从小到大输出每个区间中不同 word 的数量，中间没有 word 的区间输出 0
+func TestLogBins(t *testing.T) {
+	repeat := func(word string, n int) string { return strings.Repeat(word+" ", n) }
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{repeat("a", 1) + repeat("b", 5) + repeat("c", 10) + repeat("d", 99) + repeat("e", 100) + repeat("f", 1000) + "g h\n",
+			"1: 3 words\n2-9: 1 words\n10-99: 2 words\n100-999: 1 words\n1000-9999: 1 words\n"},
+		{repeat("x", 100) + "y\n", "1: 1 words\n2-9: 0 words\n10-99: 0 words\n100-999: 1 words\n"},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, tt.input, "-f", "/dev/stdin", "-log-bins")
+		if code != 0 {
+			t.Fatalf("exit status %d, stderr %q", code, stderr)
+		}
+		if stdout != tt.want {
+			t.Errorf("output %q, want %q", stdout, tt.want)
+		}
+	}
+}
+
+func TestShannonEntropy(t *testing.T) {
+	for _, n := range []int{2, 4, 10, 1000} {
+		counts := make([]int, n)
+		for i := range counts {
+			counts[i] = 7
+		}
+		// 均匀分布的熵为 log2(N)，归一化熵为 1
+		h, normalized := shannonEntropy(counts)
+		if math.Abs(h-math.Log2(float64(n))) > 1e-9 || math.Abs(normalized-1) > 1e-9 {
+			t.Errorf("uniform distribution of %d words: entropy %v, normalized %v, want %v and 1", n, h, normalized, math.Log2(float64(n)))
+		}
+	}
+
+	if h, normalized := shannonEntropy([]int{42}); h != 0 || normalized != 0 {
+		t.Errorf("single word: entropy %v, normalized %v, want 0 and 0", h, normalized)
+	}
+	if h, _ := shannonEntropy([]int{97, 1, 1, 1}); h <= 0 || h >= 2 {
+		t.Errorf("skewed distribution of 4 words: entropy %v, want in (0, 2)", h)
+	}
+}
+
+// TestStopwordRatio 检查 -stopword-ratio 统计所有 token，不受 -n、-sample-words 和 -exclude-word 影响
+func TestStopwordRatio(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(path, []byte("the cat and the dog\nsaw a bird in the tree\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// the、and、a 和 in 是停用词
+	want := "stopwords: 6\ncontent words: 5\nstopword ratio: 0.5455\n"
+	for _, extra := range [][]string{nil, {"-n", "1"}, {"-sample-words", "2"}, {"-exclude-word", "the"}, {"-strategy", "map", "-n", "2"}} {
+		stdout, stderr, code := runMain(t, "", append([]string{"-f", path, "-stopword-ratio"}, extra...)...)
+		if code != 0 || stdout != want {
+			t.Errorf("%q: exit status %d, output %q, want %q (stderr %q)", extra, code, stdout, want, stderr)
+		}
+	}
+}
+
+// TestTimingBytes 检查 -timing 报告的字节数与输入文件的大小之和相同，与读取方式和行的处理方式无关
+func TestTimingBytes(t *testing.T) {
+	text := strings.Repeat("one two\r\nthree\r\n", 500) + "four five six"
+	path := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, extra := range [][]string{nil, {"-fast-tokenize"}, {"-chunk-bytes", "100"}, {"-no-line-boundaries"}, {"-tail", "3"}, {"-map-workers", "4"}} {
+		args := append([]string{"-f", path, "-f", path, "-timing"}, extra...)
+		_, stderr, code := runMain(t, "", args...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", extra, code, stderr)
+		}
+		var lines, bytes, tokens int
+		if _, err := fmt.Sscanf(stderr, "processed %d lines, %d bytes, %d tokens in ", &lines, &bytes, &tokens); err != nil {
+			t.Fatalf("%v: cannot parse %q: %s", extra, stderr, err)
+		}
+		if bytes != 2*len(text) {
+			t.Errorf("%v: %d bytes, want %d", extra, bytes, 2*len(text))
+		}
+	}
+}
+
+// TestMetricsJSON 检查 -metrics-json 在标准错误中输出一行可以解析的 JSON，包含预期的字段和计数
+func TestMetricsJSON(t *testing.T) {
+	text := "alpha beta\nbeta gamma\n"
+	stdout, stderr, code := runMain(t, text, "-f", "/dev/stdin", "-metrics-json", "-strategy", "map", "-n", "1")
+	if code != 0 || stdout != "alpha             1\n" {
+		t.Fatalf("exit status %d, output %q (stderr %q)", code, stdout, stderr)
+	}
+	if strings.Count(stderr, "\n") != 1 {
+		t.Fatalf("stderr %q is not a single line", stderr)
+	}
+
+	var metrics map[string]any
+	if err := json.Unmarshal([]byte(stderr), &metrics); err != nil {
+		t.Fatalf("stderr %q is not JSON: %v", stderr, err)
+	}
+	// distinct 是 -n 截取之前的不同 word 数量
+	want := map[string]any{"tokens": 4.0, "distinct": 3.0, "lines": 2.0, "bytes": float64(len(text)), "strategy": "map"}
+	for key, value := range want {
+		if metrics[key] != value {
+			t.Errorf("%s = %v, want %v", key, metrics[key], value)
+		}
+	}
+	if d, ok := metrics["duration_seconds"].(float64); !ok || d <= 0 {
+		t.Errorf("duration_seconds = %v, want a positive number", metrics["duration_seconds"])
+	}
+	if len(metrics) != len(want)+1 {
+		t.Errorf("metrics %v have unexpected keys", metrics)
+	}
+}
+
+// TestRankCorr 检查相同等级的 Spearman 相关系数为 1、相反等级为 -1，以及 -rank-corr 比较的是 -n 截取之前所有共有的 word
+func TestRankCorr(t *testing.T) {
+	tests := []struct {
+		x, y []int
+		want float64
+	}{
+		{[]int{1, 2, 3, 4}, []int{1, 2, 3, 4}, 1},
+		{[]int{5, 9, 2, 7}, []int{50, 90, 20, 70}, 1},
+		{[]int{1, 2, 3, 4}, []int{4, 3, 2, 1}, -1},
+	}
+	for _, tt := range tests {
+		if got := spearman(tt.x, tt.y); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("spearman(%v, %v) = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+	if got := spearman([]int{1}, []int{1}); !math.IsNaN(got) {
+		t.Errorf("spearman of a single pair = %v, want NaN", got)
+	}
+
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	text := "alpha alpha alpha alpha beta beta beta gamma gamma delta\n"
+	if err := os.WriteFile(a, []byte(text+"only\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte(text+text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, code := runMain(t, "", "-f", a, "-f", b, "-rank-corr", "-n", "2")
+	if want := "spearman: 1.000000\nshared words: 4\n"; code != 0 || stdout != want {
+		t.Errorf("-rank-corr -n 2: exit status %d, output %q, want %q (stderr %q)", code, stdout, want, stderr)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import "strings"
+
+// stem 使用 Porter2（Snowball English）算法提取英文单词的词干，输入需为小写单词。
+// 词干提取是有损的，且只适用于英文；包含非 ASCII 字母的单词原样返回。
+// 算法描述见 https://snowballstem.org/algorithms/english/stemmer.html
+func stem(word string) string {
+	if len(word) <= 2 || strings.IndexFunc(word, func(r rune) bool { return (r < 'a' || r > 'z') && r != '\'' }) >= 0 {
+		return word
+	}
+	if s, ok := stemExceptions[word]; ok {
+		return s
+	}
+
+	w := []byte(strings.TrimPrefix(word, "'"))
+	// 词首的 y 以及元音之后的 y 视为辅音，标记为 Y
+	for i := range w {
+		if w[i] == 'y' && (i == 0 || isVowel(w[i-1])) {
+			w[i] = 'Y'
+		}
+	}
+
+	r1, r2 := stemRegions(w)
+
+	w = stemStep0(w)
+	w = stemStep1a(w)
+	if stemInvariants[string(w)] {
+		return string(w)
+	}
+	w = stemStep1b(w, r1)
+	w = stemStep1c(w)
+	w = stemStep2(w, r1)
+	w = stemStep3(w, r1, r2)
+	w = stemStep4(w, r2)
+	w = stemStep5(w, r1, r2)
+
+	return strings.ReplaceAll(string(w), "Y", "y")
+}
+
+var stemExceptions = map[string]string{
+	"skis": "ski", "skies": "sky", "dying": "die", "lying": "lie", "tying": "tie",
+	"idly": "idl", "gently": "gentl", "ugly": "ugli", "early": "earli", "only": "onli", "singly": "singl",
+	"sky": "sky", "news": "news", "howe": "howe", "atlas": "atlas", "cosmos": "cosmos", "bias": "bias", "andes": "andes",
+}
+
+// stemInvariants 中的单词在 step 1a 之后不再做任何处理
+var stemInvariants = map[string]bool{
+	"inning": true, "outing": true, "canning": true, "herring": true,
+	"earring": true, "proceed": true, "exceed": true, "succeed": true,
+}
+
+func isVowel(b byte) bool {
+	switch b {
+	case 'a', 'e', 'i', 'o', 'u', 'y':
+		return true
+	}
+	return false
+}
+
+// stemRegions 计算 R1 和 R2 的起始位置
+func stemRegions(w []byte) (int, int) {
+	r1 := -1
+	for _, prefix := range []string{"gener", "commun", "arsen"} {
+		if strings.HasPrefix(string(w), prefix) {
+			r1 = len(prefix)
+			break
+		}
+	}
+	if r1 < 0 {
+		r1 = regionAfter(w, 0)
+	}
+	return r1, regionAfter(w, r1)
+}
+
+// regionAfter 返回 w[start:] 中第一个"元音后紧跟非元音"之后的位置
+func regionAfter(w []byte, start int) int {
+	for i := start + 1; i < len(w); i++ {
+		if !isVowel(w[i]) && isVowel(w[i-1]) {
+			return i + 1
+		}
+	}
+	return len(w)
+}
+
+// endsWithShortSyllable 判断 w 是否以短音节结尾
+func endsWithShortSyllable(w []byte) bool {
+	n := len(w)
+	switch {
+	case n == 2:
+		return isVowel(w[0]) && !isVowel(w[1])
+	case n > 2:
+		last := w[n-1]
+		return !isVowel(w[n-3]) && isVowel(w[n-2]) && !isVowel(last) && last != 'w' && last != 'x' && last != 'Y'
+	}
+	return false
+}
+
+func containsVowel(w []byte) bool {
+	for _, b := range w {
+		if isVowel(b) {
+			return true
+		}
+	}
+	return false
+}
+
+// longestSuffix 返回 w 以 suffixes 中哪个后缀结尾，suffixes 需按长度从长到短排列
+func longestSuffix(w []byte, suffixes ...string) string {
+	for _, s := range suffixes {
+		if strings.HasSuffix(string(w), s) {
+			return s
+		}
+	}
+	return ""
+}
+
+func replaceSuffix(w []byte, suffix, repl string) []byte {
+	return append(w[:len(w)-len(suffix)], repl...)
+}
+
+func stemStep0(w []byte) []byte {
+	if s := longestSuffix(w, "'s'", "'s", "'"); s != "" {
+		return w[:len(w)-len(s)]
+	}
+	return w
+}
+
+func stemStep1a(w []byte) []byte {
+	switch s := longestSuffix(w, "sses", "ied", "ies", "us", "ss", "s"); s {
+	case "sses":
+		return replaceSuffix(w, s, "ss")
+	case "ied", "ies":
+		if len(w) > 4 {
+			return replaceSuffix(w, s, "i")
+		}
+		return replaceSuffix(w, s, "ie")
+	case "s":
+		if len(w) > 2 && containsVowel(w[:len(w)-2]) {
+			return w[:len(w)-1]
+		}
+	}
+	return w
+}
+
+func stemStep1b(w []byte, r1 int) []byte {
+	switch s := longestSuffix(w, "eedly", "ingly", "edly", "eed", "ing", "ed"); s {
+	case "eedly", "eed":
+		if len(w)-len(s) >= r1 {
+			return replaceSuffix(w, s, "ee")
+		}
+	case "ingly", "edly", "ing", "ed":
+		if !containsVowel(w[:len(w)-len(s)]) {
+			return w
+		}
+		w = w[:len(w)-len(s)]
+		switch {
+		case longestSuffix(w, "at", "bl", "iz") != "":
+			return append(w, 'e')
+		case longestSuffix(w, "bb", "dd", "ff", "gg", "mm", "nn", "pp", "rr", "tt") != "":
+			return w[:len(w)-1]
+		case endsWithShortSyllable(w) && r1 >= len(w):
+			return append(w, 'e')
+		}
+	}
+	return w
+}
+
+func stemStep1c(w []byte) []byte {
+	if n := len(w); n > 2 && (w[n-1] == 'y' || w[n-1] == 'Y') && !isVowel(w[n-2]) {
+		w[n-1] = 'i'
+	}
+	return w
+}
+
+var step2Rules = [][2]string{
+	{"ational", "ate"}, {"fulness", "ful"}, {"iveness", "ive"}, {"ization", "ize"}, {"ousness", "ous"},
+	{"biliti", "ble"}, {"lessli", "less"}, {"tional", "tion"},
+	{"alism", "al"}, {"aliti", "al"}, {"ation", "ate"}, {"entli", "ent"}, {"fulli", "ful"}, {"iviti", "ive"}, {"ousli", "ous"},
+	{"abli", "able"}, {"alli", "al"}, {"anci", "ance"}, {"ator", "ate"}, {"enci", "ence"}, {"izer", "ize"},
+	{"bli", "ble"}, {"ogi", "og"}, {"li", ""},
+}
+
+func stemStep2(w []byte, r1 int) []byte {
+	for _, rule := range step2Rules {
+		suffix, repl := rule[0], rule[1]
+		if !strings.HasSuffix(string(w), suffix) {
+			continue
+		}
+		start := len(w) - len(suffix)
+		if start < r1 {
+			return w
+		}
+		switch suffix {
+		case "ogi":
+			if start == 0 || w[start-1] != 'l' {
+				return w
+			}
+		case "li":
+			if start == 0 || !strings.ContainsRune("cdeghkmnrt", rune(w[start-1])) {
+				return w
+			}
+		}
+		return replaceSuffix(w, suffix, repl)
+	}
+	return w
+}
+
+var step3Rules = [][2]string{
+	{"ational", "ate"}, {"tional", "tion"}, {"alize", "al"}, {"icate", "ic"}, {"iciti", "ic"}, {"ative", ""},
+	{"ical", "ic"}, {"ness", ""}, {"ful", ""},
+}
+
+func stemStep3(w []byte, r1, r2 int) []byte {
+	for _, rule := range step3Rules {
+		suffix, repl := rule[0], rule[1]
+		if !strings.HasSuffix(string(w), suffix) {
+			continue
+		}
+		start := len(w) - len(suffix)
+		if start < r1 || (suffix == "ative" && start < r2) {
+			return w
+		}
+		return replaceSuffix(w, suffix, repl)
+	}
+	return w
+}
+
+var step4Suffixes = []string{
+	"ement", "able", "ance", "ence", "ible", "ment",
+	"ant", "ate", "ent", "ion", "ism", "iti", "ous", "ive", "ize",
+	"al", "er", "ic",
+}
+
+func stemStep4(w []byte, r2 int) []byte {
+	s := longestSuffix(w, step4Suffixes...)
+	if s == "" {
+		return w
+	}
+	start := len(w) - len(s)
+	if start < r2 {
+		return w
+	}
+	if s == "ion" && (start == 0 || (w[start-1] != 's' && w[start-1] != 't')) {
+		return w
+	}
+	return w[:start]
+}
+
+func stemStep5(w []byte, r1, r2 int) []byte {
+	n := len(w)
+	switch {
+	case n > 0 && w[n-1] == 'e':
+		if n-1 >= r2 || (n-1 >= r1 && !endsWithShortSyllable(w[:n-1])) {
+			return w[:n-1]
+		}
+	case n > 1 && w[n-1] == 'l' && w[n-2] == 'l':
+		if n-1 >= r2 {
+			return w[:n-1]
+		}
+	}
+	return w
+}
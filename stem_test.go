@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// 测试用例取自 Snowball 项目发布的 Porter2 标准词表（voc.txt 和 output.txt）
+func TestStem(t *testing.T) {
+	tests := []struct{ word, want string }{
+		// 词首的撇号和 step 0 的所有格
+		{"'s", "'s"}, {"'aa", "aa"},
+		// step 1a
+		{"caresses", "caress"}, {"ponies", "poni"}, {"ties", "tie"}, {"cats", "cat"},
+		{"gas", "gas"}, {"this", "this"}, {"abyss", "abyss"}, {"bus", "bus"}, {"cried", "cri"}, {"cries", "cri"},
+		// step 1b
+		{"hoped", "hope"}, {"hopping", "hop"}, {"agreed", "agre"}, {"feed", "feed"}, {"filing", "file"},
+		{"luxuriating", "luxuri"}, {"skating", "skate"}, {"exceedingly", "exceed"}, {"enjoyed", "enjoy"},
+		// step 1c 以及元音之后的 y
+		{"cry", "cri"}, {"fly", "fli"}, {"flies", "fli"}, {"flying", "fli"}, {"sayings", "say"}, {"happily", "happili"},
+		// step 2 到 step 5
+		{"conditional", "condit"}, {"electricity", "electr"}, {"hopeful", "hope"}, {"hopefully", "hope"},
+		{"fluently", "fluentli"}, {"adjustment", "adjust"}, {"consistency", "consist"}, {"knackeries", "knackeri"},
+		{"knaves", "knave"}, {"yell", "yell"}, {"yelled", "yell"},
+		{"consign", "consign"}, {"consigned", "consign"}, {"consigning", "consign"}, {"consignment", "consign"},
+		// R1 的特殊前缀
+		{"generate", "generat"}, {"generously", "generous"}, {"communism", "communism"},
+		// 例外词表
+		{"skies", "sky"}, {"dying", "die"}, {"news", "news"}, {"succeeded", "succeed"}, {"exceeds", "exceed"},
+		// 过短或包含非 ASCII 字母的单词原样返回
+		{"a", "a"}, {"is", "is"}, {"naïvely", "naïvely"},
+	}
+	for _, tt := range tests {
+		if got := stem(tt.word); got != tt.want {
+			t.Errorf("stem(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+// TestShowForms 检查 -show-forms 在每个词干之后按计数从大到小列出计入的单词，不规则变化的 ran 不属于 run
+func TestShowForms(t *testing.T) {
+	stdout, stderr, code := runMain(t, "running runs ran run cat Running\n", "-f", "/dev/stdin", "-stem", "-show-forms")
+	if code != 0 {
+		t.Fatalf("exit status %d, stderr %q", code, stderr)
+	}
+	if want := "cat               1 (cat:1)\nran               1 (ran:1)\nrun               4 (running:2, run:1, runs:1)\n"; stdout != want {
+		t.Errorf("output %q, want %q", stdout, want)
+	}
+
+	if _, stderr, code := runMain(t, "running\n", "-f", "/dev/stdin", "-show-forms"); code != 1 || !strings.Contains(stderr, "-show-forms requires -stem or -bucket-regex") {
+		t.Errorf("-show-forms without -stem: exit status %d, stderr %q", code, stderr)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// streakMapper 按照输入的顺序跟踪每个文件中同一个 word 连续出现的次数，每段连续出现结束时输出一个
+// count 为连续次数的 wordCount（line 与 offset 为该段开始的位置）。不同文件的行可能交错到达，
+// 因此每个文件单独跟踪；input 中同一个文件的行需保持原有顺序，所以只能有一个 streakMapper。
+func streakMapper(ctx context.Context, eg *errgroup.Group, input <-chan inputLine, fn func(string) []wordCount) <-chan wordCount {
+	ch := make(chan wordCount)
+
+	eg.Go(func() error {
+		defer func() { close(ch); logger.Debug("streak mapper exits") }()
+		emit := func(wc wordCount) error {
+			select {
+			case ch <- wc:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		runs := make(map[int]wordCount)
+	loop:
+		for l := range input {
+			for _, wc := range fn(l.text) {
+				n := tokensMapped.Add(1)
+				if tokenLimitReached(n) {
+					break loop
+				}
+				run, ok := runs[l.file]
+				if ok && run.word == wc.word {
+					run.count++
+					runs[l.file] = run
+					continue
+				}
+				if ok {
+					if err := emit(run); err != nil {
+						return err
+					}
+				}
+				wc.line = l.num
+				wc.offset += l.offset
+				if trackFirstSeen() {
+					wc.seq = firstSeenSeq(l.file, wc.offset)
+				}
+				runs[l.file] = wc
+			}
+		}
+
+		// 输入结束后输出每个文件最后一段连续出现
+		for _, run := range runs {
+			if err := emit(run); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return ch
+}
+
+// streakReduceFn 合并同一个 word 的多段连续出现，count 取最长的一段
+func streakReduceFn(acc, next wordCount) wordCount {
+	count := max(acc.count, next.count)
+	acc = reduceFn(acc, next)
+	acc.count = count
+	return acc
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"testing"
+
+	"golang.org/x/sync/errgroup"
+)
+
+func TestMaxStreak(t *testing.T) {
+	lines := []inputLine{
+		{text: "the cat the the", file: 0, num: 1},
+		// 连续出现可以跨行，不同文件的行交错到达时每个文件单独计算
+		{text: "dog dog dog dog", file: 1, num: 1},
+		{text: "The sat", file: 0, num: 2},
+		{text: "the cat cat", file: 0, num: 3},
+	}
+	eg, ctx := errgroup.WithContext(context.Background())
+	input := make(chan inputLine, len(lines))
+	for _, l := range lines {
+		input <- l
+	}
+	close(input)
+	reduced := reducer(ctx, eg, sorter(ctx, eg, streakMapper(ctx, eg, input, mapFn)), streakReduceFn, nil)
+
+	got := make(map[string]int)
+	for wc := range reduced {
+		got[wc.word] = wc.count
+	}
+	if err := eg.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"the": 3, "cat": 2, "dog": 4, "sat": 1}
+	if !maps.Equal(got, want) {
+		t.Errorf("longest streaks %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// scanFields 是与默认分词规则一致的 bufio.SplitFunc：按照 isSeparator 拆分出字段，在原地去掉字段中的非 ASCII 字母
+// 并转换成小写（指定 -acronyms 时保留大小写），不包含字母的字段被跳过。行数由 countLinesSplit 统计。
+// bufio.Scanner 读到输入结尾后，拆分函数只要没有返回 token 就会停止扫描，因此不包含字母的字段需要在这里连续跳过，不能返回空的结果。
+func scanFields(data []byte, atEOF bool) (int, []byte, error) {
+	consumed := 0
+	for {
+		advance, token := scanField(data[consumed:], atEOF)
+		consumed += advance
+		if token != nil || advance == 0 {
+			return consumed, token, nil
+		}
+	}
+}
+
+// scanField 从 data 中拆分出一个字段并去掉其中的非 ASCII 字母，返回跳过的字节数和字段。
+// 字段不包含字母时返回 nil，需要更多数据时返回的字节数只包括已经跳过的分隔符。
+func scanField(data []byte, atEOF bool) (int, []byte) {
+	// 跳过字段之前的分隔符
+	start := 0
+	for start < len(data) {
+		if !atEOF && !utf8.FullRune(data[start:]) {
+			return start, nil
+		}
+		r, width := utf8.DecodeRune(data[start:])
+		if !isSeparator(r) {
+			break
+		}
+		start += width
+	}
+
+	// 找到字段的结尾，即下一个分隔符
+	end, advance := -1, 0
+	for i := start; i < len(data); {
+		if !atEOF && !utf8.FullRune(data[i:]) {
+			break
+		}
+		r, width := utf8.DecodeRune(data[i:])
+		if isSeparator(r) {
+			end, advance = i, i+width
+			break
+		}
+		i += width
+	}
+	if end < 0 {
+		if !atEOF {
+			// 字段可能还没有结束，需要更多数据
+			return start, nil
+		}
+		end, advance = len(data), len(data)
+	}
+
+	field := data[start:end]
+	n := 0
+	for _, b := range field {
+		if isASCIILetter(b) {
+			if !acronyms {
+				b |= 0x20
+			}
+			field[n] = b
+			n++
+		}
+	}
+	if n == 0 {
+		return advance, nil
+	}
+	return advance, field[:n]
+}
+
+// countLinesSplit 包装 split，将每次拆分跳过的输入中的换行计入 lines。输入结束时最后一行即使没有以换行结尾也计为一行，
+// 与按行读取输入时的行数一致。
+func countLinesSplit(split bufio.SplitFunc, lines *atomic.Int64) bufio.SplitFunc {
+	// midLine 表示已经跳过的输入在最后一个换行之后还有内容
+	var midLine bool
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := split(data, atEOF)
+		if advance > 0 {
+			lines.Add(int64(bytes.Count(data[:advance], []byte{'\n'})))
+			midLine = data[advance-1] != '\n'
+		}
+		if atEOF && advance == len(data) && midLine {
+			lines.Add(1)
+			midLine = false
+		}
+		return advance, token, err
+	}
+}
+
+// tokenMapper 读取 paths 中的文件，使用 scanFields 直接从字节流中拆分 token（不经过按行读取的 channel 和 mapper），
+// 每个文件在读取它的 goroutine 中通过 reduce 聚合，输入结束后输出该文件的部分结果，仍需经过 aggregate 或 sorter 和 reducer 合并。
+// 同时读取的文件数量不超过 limit。
+func tokenMapper(ctx context.Context, eg *errgroup.Group, paths []string, limit int, reduce func(acc, next wordCount) wordCount) <-chan wordCount {
+	sem := make(chan struct{}, limit)
+	streams := make([]<-chan wordCount, 0, len(paths))
+
+	for i, path := range paths {
+		i, path := i, path
+		ch := make(chan wordCount)
+		streams = append(streams, ch)
+
+		eg.Go(func() error {
+			defer func() { close(ch); logger.Debug("file has been tokenized", "file", path) }()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			agg := newCappedAggregator(reduce, lruCap)
+			err := tokenizeFile(ctx, path, i, agg)
+			if err != nil && ctx.Err() == nil && keepGoing {
+				// 指定 -keep-going 时单个文件读取失败不会取消整个 pipeline
+				logger.Error("failed to read file, skipping", "file", path, "err", err)
+				recordFailure(i)
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			for _, wc := range agg.counts {
+				select {
+				case ch <- wc:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		})
+	}
+
+	return mergeStreams(ctx, eg, streams...)
+}
+
+// tokenizeFile 使用 scanFields 拆分第 file 个输入文件 path 中的 token，并将计数聚合到 agg 中
+func tokenizeFile(ctx context.Context, path string, file int, agg *Aggregator) error {
+	f, err := openFile(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// 取消时关闭文件，使阻塞在 FIFO 等读取操作上的 goroutine 能够退出
+	stop := context.AfterFunc(ctx, func() { _ = f.Close() })
+	defer stop()
+
+	if err := tokenize(f, file, agg); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// tokenize 使用 scanFields 拆分 r 中的 token，经过 normalizeToken 处理后聚合到 agg 中
+func tokenize(r io.Reader, file int, agg *Aggregator) error {
+	br := bufio.NewReader(countingReader{r, &bytesRead})
+	if err := checkBinary(br); err != nil {
+		return err
+	}
+
+	sc := bufio.NewScanner(br)
+	sc.Split(countLinesSplit(scanFields, &linesRead))
+	// index 为 token 在文件中的序号
+	for index := int64(0); sc.Scan(); index++ {
+		w, surface, ok := normalizeToken(sc.Text(), "")
+		if !ok {
+			continue
+		}
+		tokensMapped.Add(1)
+		wc := wordCount{word: w, count: 1}
+		if weight, ok := weights[w]; ok {
+			wc.count *= weight
+		}
+		if trackFirstSeen() {
+			wc.seq = firstSeenSeq(file, index)
+		}
+		if trackFiles() {
+			wc.files = newFileSet(file)
+		}
+		if trackSources() {
+			wc.sources = map[int]int{file: wc.count}
+		}
+		if showForms {
+			wc.members = map[string]int{surface: 1}
+		}
+		agg.add(wc)
+	}
+	return sc.Err()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"maps"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// tokenizeText 使用 scanFields 拆分 text 中的 token，返回每个 word 的计数和读到的行数
+func tokenizeText(tb testing.TB, text string) (map[string]int, int64) {
+	tb.Helper()
+	defer resetCounters()
+	resetCounters()
+	agg := newAggregator(reduceFn)
+	if err := tokenize(strings.NewReader(text), 0, agg); err != nil {
+		tb.Fatal(err)
+	}
+	counts := make(map[string]int)
+	for _, wc := range agg.sorted() {
+		counts[wc.word] = wc.count
+	}
+	return counts, linesRead.Load()
+}
+
+// randomText 返回由 n 个随机片段组成的文本，包含大小写字母、数字、标点、非 ASCII 字母、空行和连续的分隔符
+func randomText(rng *rand.Rand, n int) string {
+	pieces := []string{"alpha", "Beta", "GAMMA", "don't", "x1y", "42", "--", "café", "naïve", ",", ".", " ", "  ", "\t", "\n", "\n\n", "\r\n"}
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		b.WriteString(pieces[rng.Intn(len(pieces))])
+	}
+	return b.String()
+}
+
+// TestScanFieldsEquivalence 检查 -fast-tokenize 使用的 scanFields 与按行读取后由 mapper 分词得到的计数和行数相同，
+// 包括最后一行没有换行结尾的输入
+func TestScanFieldsEquivalence(t *testing.T) {
+	tests := []string{"", "alpha", "alpha\n", "alpha\nbeta", "alpha \n  ", "\n\n", "alpha\n\nbeta gamma  "}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		tests = append(tests, randomText(rng, rng.Intn(200)))
+	}
+
+	for _, text := range tests {
+		resetCounters()
+		want := countText(t, text, "map")
+		wantLines := linesRead.Load()
+		got, gotLines := tokenizeText(t, text)
+		if !maps.Equal(got, want) {
+			t.Errorf("scanFields counts of %q = %v, want %v", text, got, want)
+		}
+		if gotLines != wantLines {
+			t.Errorf("scanFields read %d lines of %q, want %d", gotLines, text, wantLines)
+		}
+	}
+}
+
+// BenchmarkTokenize 比较按行读取后由 mapper 分词（lines）和使用 scanFields 直接从字节流中拆分 token（fast）的耗时
+func BenchmarkTokenize(b *testing.B) {
+	lines := zipfLines(20000, 8)
+	texts := make([]string, len(lines))
+	for i, l := range lines {
+		texts[i] = l.text
+	}
+	text := strings.Join(texts, "\n")
+	b.SetBytes(int64(len(text)))
+
+	b.Run("lines", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			countText(b, text, "map")
+		}
+	})
+	b.Run("fast", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tokenizeText(b, text)
+		}
+	})
+}
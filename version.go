@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	rtdebug "runtime/debug"
+)
+
+// 构建信息，发布时通过 -ldflags 设置，例如：
+//
+//	go build -ldflags "-X main.version=v1.0.0 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%FT%TZ)"
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// buildInfo 返回版本、提交和构建时间，没有通过 -ldflags 设置的字段从 Go 工具链嵌入的构建信息中读取
+func buildInfo() (string, string, string) {
+	v, c, d := version, commit, date
+	if info, ok := rtdebug.ReadBuildInfo(); ok {
+		if v == "" {
+			v = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && c == "":
+				c = s.Value
+			case s.Key == "vcs.time" && d == "":
+				d = s.Value
+			}
+		}
+	}
+
+	if v == "" {
+		v = "(devel)"
+	}
+	if c == "" {
+		c = "unknown"
+	}
+	if d == "" {
+		d = "unknown"
+	}
+	return v, c, d
+}
+
+func writeVersion(w io.Writer) error {
+	v, c, d := buildInfo()
+	_, err := fmt.Fprintf(w, "wc-example %s (commit %s, built %s)\n", v, c, d)
+	return err
+}
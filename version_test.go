@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteVersion(t *testing.T) {
+	defer func(v, c, d string) { version, commit, date = v, c, d }(version, commit, date)
+	version, commit, date = "v1.2.3", "abc123", "2024-01-02T03:04:05Z"
+
+	var out strings.Builder
+	if err := writeVersion(&out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "wc-example v1.2.3 (commit abc123, built 2024-01-02T03:04:05Z)\n"; out.String() != want {
+		t.Errorf("version %q, want %q", out.String(), want)
+	}
+}
+
+// TestVersionFlag 检查 -version 输出版本信息后以状态 0 退出，不需要指定输入
+func TestVersionFlag(t *testing.T) {
+	stdout, stderr, code := runMain(t, "", "-version")
+	if code != 0 || !strings.HasPrefix(stdout, "wc-example ") || stderr != "" {
+		t.Errorf("exit status %d, stdout %q, stderr %q, want the version and status 0", code, stdout, stderr)
+	}
+}
@@ -0,0 +1,147 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: wordcount.proto
+
+package wordcount
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	WordCounter_Count_FullMethodName = "/wordcount.WordCounter/Count"
+)
+
+// WordCounterClient is the client API for WordCounter service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type WordCounterClient interface {
+	// Count receives the input as a stream of lines and, once the client closes
+	// its side of the stream, sends back the final counts in output order.
+	// Counting options (-sort, -n, ...) are those of the server.
+	Count(ctx context.Context, opts ...grpc.CallOption) (WordCounter_CountClient, error)
+}
+
+type wordCounterClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewWordCounterClient(cc grpc.ClientConnInterface) WordCounterClient {
+	return &wordCounterClient{cc}
+}
+
+func (c *wordCounterClient) Count(ctx context.Context, opts ...grpc.CallOption) (WordCounter_CountClient, error) {
+	stream, err := c.cc.NewStream(ctx, &WordCounter_ServiceDesc.Streams[0], WordCounter_Count_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &wordCounterCountClient{stream}
+	return x, nil
+}
+
+type WordCounter_CountClient interface {
+	Send(*Line) error
+	Recv() (*WordCount, error)
+	grpc.ClientStream
+}
+
+type wordCounterCountClient struct {
+	grpc.ClientStream
+}
+
+func (x *wordCounterCountClient) Send(m *Line) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *wordCounterCountClient) Recv() (*WordCount, error) {
+	m := new(WordCount)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WordCounterServer is the server API for WordCounter service.
+// All implementations must embed UnimplementedWordCounterServer
+// for forward compatibility
+type WordCounterServer interface {
+	// Count receives the input as a stream of lines and, once the client closes
+	// its side of the stream, sends back the final counts in output order.
+	// Counting options (-sort, -n, ...) are those of the server.
+	Count(WordCounter_CountServer) error
+	mustEmbedUnimplementedWordCounterServer()
+}
+
+// UnimplementedWordCounterServer must be embedded to have forward compatible implementations.
+type UnimplementedWordCounterServer struct {
+}
+
+func (UnimplementedWordCounterServer) Count(WordCounter_CountServer) error {
+	return status.Errorf(codes.Unimplemented, "method Count not implemented")
+}
+func (UnimplementedWordCounterServer) mustEmbedUnimplementedWordCounterServer() {}
+
+// UnsafeWordCounterServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to WordCounterServer will
+// result in compilation errors.
+type UnsafeWordCounterServer interface {
+	mustEmbedUnimplementedWordCounterServer()
+}
+
+func RegisterWordCounterServer(s grpc.ServiceRegistrar, srv WordCounterServer) {
+	s.RegisterService(&WordCounter_ServiceDesc, srv)
+}
+
+func _WordCounter_Count_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(WordCounterServer).Count(&wordCounterCountServer{stream})
+}
+
+type WordCounter_CountServer interface {
+	Send(*WordCount) error
+	Recv() (*Line, error)
+	grpc.ServerStream
+}
+
+type wordCounterCountServer struct {
+	grpc.ServerStream
+}
+
+func (x *wordCounterCountServer) Send(m *WordCount) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *wordCounterCountServer) Recv() (*Line, error) {
+	m := new(Line)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WordCounter_ServiceDesc is the grpc.ServiceDesc for WordCounter service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var WordCounter_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "wordcount.WordCounter",
+	HandlerType: (*WordCounterServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Count",
+			Handler:       _WordCounter_Count_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "wordcount.proto",
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadWordSet 读取每行一个（或多个）单词的词表文件，经过与输入相同的分词处理后构造成集合，
+// 以保证词表与计数结果的大小写和规范化方式一致。
+func loadWordSet(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	set := make(map[string]bool)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		for _, wc := range mapFn(sc.Text()) {
+			set[wc.word] = true
+		}
+	}
+	return set, sc.Err()
+}
+
+// excludedWords 是 -exclude-word 指定的 word，不会出现在输出中
+var excludedWords map[string]bool
+
+// wordSetFromList 将命令行中逗号分隔的单词列表经过与输入相同的分词处理后构造成集合
+func wordSetFromList(list []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, item := range list {
+		for _, w := range strings.Split(item, ",") {
+			for _, wc := range mapFn(w) {
+				set[wc.word] = true
+			}
+		}
+	}
+	return set
+}
+
+// stopwords 是 -stopword-ratio 使用的停用词表，默认为 defaultStopwords，可以通过 -stopwords 指定
+var stopwords map[string]bool
+
+// defaultStopwords 是常见的英文停用词
+var defaultStopwords = []string{
+	"a,about,above,after,again,against,all,am,an,and,any,are,as,at,be,because,been,before,being,below",
+	"between,both,but,by,can,could,did,do,does,doing,down,during,each,few,for,from,further,had,has,have",
+	"having,he,her,here,hers,herself,him,himself,his,how,i,if,in,into,is,it,its,itself,just,me,more,most",
+	"my,myself,no,nor,not,now,of,off,on,once,only,or,other,our,ours,ourselves,out,over,own,same,she,should",
+	"so,some,such,than,that,the,their,theirs,them,themselves,then,there,these,they,this,those,through,to",
+	"too,under,until,up,very,was,we,were,what,when,where,which,while,who,whom,why,will,with,would,you,your",
+	"yours,yourself,yourselves",
+}
+
+// foldReplacer 是 -fold-map 指定的替换规则，不为 nil 时在分词之前对每一行进行替换
+var foldReplacer *strings.Replacer
+
+// loadFoldMap 读取每行为 `from<TAB>to` 的替换规则文件（to 可以为空），忽略空行和以 # 开头的注释行。
+// 多条规则的 from 有相同前缀时优先匹配先出现的规则。
+func loadFoldMap(path string) (*strings.Replacer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var pairs []string
+	sc := bufio.NewScanner(f)
+	for lineNum := 1; sc.Scan(); lineNum++ {
+		line := sc.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		from, to, ok := strings.Cut(line, "\t")
+		if !ok || from == "" {
+			return nil, fmt.Errorf("%s:%d: expected \"from<TAB>to\"", path, lineNum)
+		}
+		pairs = append(pairs, from, to)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return strings.NewReplacer(pairs...), nil
+}
+
+// weights 是 -weights 指定的 word 权重，未列出的 word 权重为 1
+var weights map[string]int
+
+// loadWeights 读取每行为 `word weight` 的权重文件，word 经过与输入相同的分词处理
+func loadWeights(path string) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	weights := make(map[string]int)
+	sc := bufio.NewScanner(f)
+	for lineNum := 1; sc.Scan(); lineNum++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"word weight\"", path, lineNum)
+		}
+		weight, err := strconv.Atoi(fields[1])
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("%s:%d: invalid weight %q", path, lineNum, fields[1])
+		}
+		for _, wc := range mapFn(fields[0]) {
+			weights[wc.word] = weight
+		}
+	}
+	return weights, sc.Err()
+}
+
+// loadCounts 读取之前某次运行保存的计数结果，支持文本输出（每行 `word count`，多余的列被忽略）
+// 和 JSON 输出（`[{"word": ..., "count": ...}]`）。其中的 word 经过 normalizeCounts 处理后才与新的输入合并。
+func loadCounts(path string) ([]wordCount, error) {
+	counts, err := decodeCounts(path)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeCounts(path, counts)
+}
+
+// normalizeCounts 将 counts 中的 word 经过与输入相同的分词和规范化处理，使 -preserve-case 等输出中保留的原始形式
+// 与新的输入计入相同的 word，合并的结果与直接统计所有输入相同。被当前选项过滤掉的 word 不再计数；
+// -redact 输出的星号无法还原，返回错误。
+func normalizeCounts(path string, counts []wordCount) ([]wordCount, error) {
+	normalized := make([]wordCount, 0, len(counts))
+	for _, wc := range counts {
+		if strings.Trim(wc.word, "*") == "" {
+			return nil, fmt.Errorf("%s: %q is a redacted word, output written with -redact cannot be merged", path, wc.word)
+		}
+		for _, m := range mapFn(wc.word) {
+			m.count, m.offset = wc.count, 0
+			for form := range m.forms {
+				m.forms[form] = wc.count
+			}
+			for member := range m.members {
+				m.members[member] = wc.count
+			}
+			normalized = append(normalized, m)
+		}
+	}
+	return normalized, nil
+}
+
+// decodeCounts 按照文件内容的格式解析 loadCounts 读取的计数结果，word 保持原样
+func decodeCounts(path string) ([]wordCount, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("[")) {
+		var results []jsonWordCount
+		if err := json.Unmarshal(trimmed, &results); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		counts := make([]wordCount, 0, len(results))
+		for _, r := range results {
+			counts = append(counts, wordCount{word: r.Word, count: r.Count})
+		}
+		return counts, nil
+	}
+
+	return readCounts(path, bytes.NewReader(data))
+}
+
+// readCounts 读取每行为 `word count` 的文本计数结果，忽略空行和以 # 开头的注释行
+func readCounts(path string, r io.Reader) ([]wordCount, error) {
+	var counts []wordCount
+	sc := bufio.NewScanner(r)
+	for lineNum := 1; sc.Scan(); lineNum++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"word count\"", path, lineNum)
+		}
+		count, err := strconv.Atoi(fields[1])
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("%s:%d: invalid count %q", path, lineNum, fields[1])
+		}
+		counts = append(counts, wordCount{word: fields[0], count: count})
+	}
+	return counts, sc.Err()
+}
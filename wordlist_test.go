@@ -0,0 +1,258 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMergeIn 检查将之前保存的文本或 JSON 输出与新的输入合并后，计数与直接统计两部分输入的拼接相同，
+// 包括 -preserve-case 输出中保留的原始大小写形式
+func TestMergeIn(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "t1.txt"), filepath.Join(dir, "t2.txt")
+	if err := os.WriteFile(first, []byte("The Dog\nThe dog, Dog\nthe\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("dog THE cat\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"text", nil},
+		{"json", []string{"-format", "json"}},
+		{"preserve-case text", []string{"-preserve-case"}},
+		{"preserve-case json", []string{"-preserve-case", "-format", "json"}},
+	}
+	for _, tt := range tests {
+		prev := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "-")+".out")
+		if _, stderr, code := runMain(t, "", append([]string{"-f", first, "-o", prev}, tt.args...)...); code != 0 {
+			t.Fatalf("%s: saving the first run: exit status %d, stderr %q", tt.name, code, stderr)
+		}
+		merged, stderr, code := runMain(t, "", "-f", second, "-merge-in", prev)
+		if code != 0 {
+			t.Fatalf("%s: exit status %d, stderr %q", tt.name, code, stderr)
+		}
+		want := map[string]int{"the": 4, "dog": 4, "cat": 1}
+		if got := parseCounts(t, merged); !maps.Equal(got, want) {
+			t.Errorf("%s: merged counts = %v, want %v", tt.name, got, want)
+		}
+		concatenated, _, _ := runMain(t, "", "-f", first, "-f", second)
+		if merged != concatenated {
+			t.Errorf("%s: merged output %q differs from the output for both files %q", tt.name, merged, concatenated)
+		}
+
+		// 指定 -preserve-case 时每个 word 仍然只输出一次，显示的形式可能与直接统计不同
+		merged, stderr, code = runMain(t, "", "-f", second, "-preserve-case", "-merge-in", prev)
+		if code != 0 {
+			t.Fatalf("%s: -preserve-case: exit status %d, stderr %q", tt.name, code, stderr)
+		}
+		folded := make(map[string]int)
+		for w, n := range parseCounts(t, merged) {
+			folded[strings.ToLower(w)] += n
+		}
+		if !maps.Equal(folded, want) || len(parseCounts(t, merged)) != len(want) {
+			t.Errorf("%s: -preserve-case merged output %q, want one row for each of %v", tt.name, merged, want)
+		}
+	}
+
+	// -redact 输出中的星号无法还原成原来的 word
+	redact, redacted := filepath.Join(dir, "redact.txt"), filepath.Join(dir, "redacted.out")
+	if err := os.WriteFile(redact, []byte("dog\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, code := runMain(t, "", "-f", first, "-redact", redact, "-o", redacted); code != 0 {
+		t.Fatalf("-redact: exit status %d, stderr %q", code, stderr)
+	}
+	if _, stderr, code := runMain(t, "", "-f", second, "-merge-in", redacted); code == 0 || !strings.Contains(stderr, "-redact") {
+		t.Errorf("-merge-in of redacted output: exit status %d, stderr %q, want an error mentioning -redact", code, stderr)
+	}
+}
+
+// TestSaveState 检查 -save-state 不受 -format 和 -n 影响，写入的完整计数合并到空的输入中后与原来的计数相同
+func TestSaveState(t *testing.T) {
+	dir := t.TempDir()
+	input, empty, state := filepath.Join(dir, "input.txt"), filepath.Join(dir, "empty.txt"), filepath.Join(dir, "state.tsv")
+	if err := os.WriteFile(input, []byte("the cat and the dog\nthe end\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, stderr, code := runMain(t, "", "-f", input, "-save-state", state, "-format", "json", "-sort", "count", "-n", "1"); code != 0 {
+		t.Fatalf("-save-state: exit status %d, stderr %q", code, stderr)
+	}
+	data, err := os.ReadFile(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "and\t1\ncat\t1\ndog\t1\nend\t1\nthe\t3\n"; string(data) != want {
+		t.Errorf("state file %q, want %q", data, want)
+	}
+
+	want, _, _ := runMain(t, "", "-f", input)
+	got, stderr, code := runMain(t, "", "-f", empty, "-merge-in", state)
+	if code != 0 || got != want {
+		t.Errorf("-merge-in of the saved state: exit status %d, output %q, want %q (stderr %q)", code, got, want, stderr)
+	}
+}
+
+// TestDict 检查 -dict 标记词典中没有的 word，-only-unknown 只输出它们，词典与输入经过相同的规范化
+func TestDict(t *testing.T) {
+	dir := t.TempDir()
+	dict := filepath.Join(dir, "dict.txt")
+	if err := os.WriteFile(dict, []byte("the\nCat\nsat\non\nmat\nRunning\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	input := "Teh cat sat on the mat\nthe CAT\n"
+
+	stdout, stderr, code := runMain(t, input, "-f", "/dev/stdin", "-dict", dict)
+	if code != 0 {
+		t.Fatalf("exit status %d, stderr %q", code, stderr)
+	}
+	want := "cat               2\nmat               1\non                1\nsat               1\nteh               1  (unknown)\nthe               2\n"
+	if stdout != want {
+		t.Errorf("-dict output %q, want %q", stdout, want)
+	}
+
+	stdout, _, _ = runMain(t, input, "-f", "/dev/stdin", "-dict", dict, "-only-unknown")
+	if want := map[string]int{"teh": 1}; !maps.Equal(parseCounts(t, stdout), want) {
+		t.Errorf("-only-unknown counts %v, want %v", parseCounts(t, stdout), want)
+	}
+	// 词典中的 Running 与输入的 runs 提取词干后都是 run
+	stdout, _, _ = runMain(t, "runs quickly\n", "-f", "/dev/stdin", "-dict", dict, "-stem", "-only-unknown")
+	if want := map[string]int{"quick": 1}; !maps.Equal(parseCounts(t, stdout), want) {
+		t.Errorf("-stem -only-unknown counts %v, want %v", parseCounts(t, stdout), want)
+	}
+
+	if _, stderr, code := runMain(t, input, "-f", "/dev/stdin", "-only-unknown"); code != 1 || !strings.Contains(stderr, "-only-unknown requires -dict") {
+		t.Errorf("-only-unknown without -dict: exit status %d, stderr %q", code, stderr)
+	}
+}
+
+// TestRedact 检查 -redact 只在输出中把列表中的 word 替换成星号，计数保持不变，列表与输入经过相同的规范化
+func TestRedact(t *testing.T) {
+	redact := filepath.Join(t.TempDir(), "redact.txt")
+	if err := os.WriteFile(redact, []byte("Damn\nheck\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	input := "Damn the damn heck cat\n"
+
+	stdout, stderr, code := runMain(t, input, "-f", "/dev/stdin", "-redact", redact)
+	if code != 0 {
+		t.Fatalf("exit status %d, stderr %q", code, stderr)
+	}
+	want := "cat               1\n****              2\n****              1\nthe               1\n"
+	if stdout != want {
+		t.Errorf("output %q, want %q", stdout, want)
+	}
+
+	stdout, _, _ = runMain(t, input, "-f", "/dev/stdin", "-redact", redact, "-format", "json", "-sort", "count", "-n", "1")
+	if want := `[{"word":"****","count":2}]` + "\n"; stdout != want {
+		t.Errorf("-format json -sort count -n 1 output %q, want %q", stdout, want)
+	}
+}
+
+// TestOnly 检查 -only 只输出列表中的 word，没有出现的 word 输出计数 0，列表与输入经过相同的规范化
+func TestOnly(t *testing.T) {
+	only := filepath.Join(t.TempDir(), "only.txt")
+	if err := os.WriteFile(only, []byte("Cat\nzebra\nthe\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	input := "the cat the dog cat the\n"
+
+	stdout, stderr, code := runMain(t, input, "-f", "/dev/stdin", "-only", only)
+	if code != 0 {
+		t.Fatalf("exit status %d, stderr %q", code, stderr)
+	}
+	if want := "cat               2\nthe               3\nzebra             0\n"; stdout != want {
+		t.Errorf("output %q, want %q", stdout, want)
+	}
+
+	stdout, _, _ = runMain(t, input, "-f", "/dev/stdin", "-only", only, "-sort", "count", "-format", "json")
+	if want := `[{"word":"the","count":3},{"word":"cat","count":2},{"word":"zebra","count":0}]` + "\n"; stdout != want {
+		t.Errorf("-sort count -format json output %q, want %q", stdout, want)
+	}
+}
+
+// TestWeights 检查 -weights 中的 word 每次出现计入它的权重，没有列出的 word 权重为 1，与聚合方式无关
+func TestWeights(t *testing.T) {
+	dir := t.TempDir()
+	weights := filepath.Join(dir, "weights.txt")
+	if err := os.WriteFile(weights, []byte("important 3\nHalf 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	input := "important cat Important half\ncat\n"
+	want := map[string]int{"cat": 2, "half": 2, "important": 6}
+	for _, extra := range [][]string{nil, {"-strategy", "heap"}, {"-map-workers", "3", "-local-aggregate"}, {"-fast-tokenize"}} {
+		stdout, stderr, code := runMain(t, input, append([]string{"-f", "/dev/stdin", "-weights", weights}, extra...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", extra, code, stderr)
+		}
+		if got := parseCounts(t, stdout); !maps.Equal(got, want) {
+			t.Errorf("%v: counts %v, want %v", extra, got, want)
+		}
+	}
+
+	invalid := filepath.Join(dir, "invalid.txt")
+	if err := os.WriteFile(invalid, []byte("important 3\nhalf 0.5\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, code := runMain(t, input, "-f", "/dev/stdin", "-weights", invalid); code != 1 || !strings.Contains(stderr, `invalid.txt:2: invalid weight "0.5"`) {
+		t.Errorf("invalid weight: exit status %d, stderr %q", code, stderr)
+	}
+}
+
+// TestExcludeWord 检查 -exclude-word 列出的 word 不出现在输出中，可以用逗号分隔或重复指定，与输入经过相同的规范化
+func TestExcludeWord(t *testing.T) {
+	tests := []struct {
+		input string
+		args  []string
+		want  map[string]int
+	}{
+		{"The a and cat A dog the And\n", []string{"-exclude-word", "the,a", "-exclude-word", "AND"}, map[string]int{"cat": 1, "dog": 1}},
+		{"running runs cat\n", []string{"-exclude-word", "run", "-stem"}, map[string]int{"cat": 1}},
+		{"The a and\n", []string{"-exclude-word", "the", "-preserve-case"}, map[string]int{"a": 1, "and": 1}},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(t, tt.input, append([]string{"-f", "/dev/stdin"}, tt.args...)...)
+		if code != 0 {
+			t.Fatalf("%v: exit status %d, stderr %q", tt.args, code, stderr)
+		}
+		if got := parseCounts(t, stdout); !maps.Equal(got, tt.want) {
+			t.Errorf("%v: counts %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+// TestFoldMap 检查 -fold-map 中的替换在分词之前应用，使 straße 与 strasse、ﬁne 与 fine 合并，格式错误的行报告行号
+func TestFoldMap(t *testing.T) {
+	dir := t.TempDir()
+	foldMap := filepath.Join(dir, "fold.txt")
+	if err := os.WriteFile(foldMap, []byte("ß\tss\nﬁ\tfi\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	input := "straße strasse Straße ﬁne fine\n"
+
+	stdout, stderr, code := runMain(t, input, "-f", "/dev/stdin", "-fold-map", foldMap)
+	if code != 0 {
+		t.Fatalf("exit status %d, stderr %q", code, stderr)
+	}
+	if want := map[string]int{"fine": 2, "strasse": 3}; !maps.Equal(parseCounts(t, stdout), want) {
+		t.Errorf("counts %v, want %v", parseCounts(t, stdout), want)
+	}
+
+	invalid := filepath.Join(dir, "invalid.txt")
+	if err := os.WriteFile(invalid, []byte("ß\tss\nbad line\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, code := runMain(t, input, "-f", "/dev/stdin", "-fold-map", invalid); code != 1 || !strings.Contains(stderr, `invalid.txt:2: expected "from<TAB>to"`) {
+		t.Errorf("invalid fold map: exit status %d, stderr %q", code, stderr)
+	}
+}